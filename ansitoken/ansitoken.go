@@ -1,11 +1,18 @@
-package main
+// Package ansitoken splits a terminal byte stream into text and escape
+// sequence tokens. It is safe to feed any chunking of the stream: a sequence
+// split across Feed calls is held until it is complete. Along the way it
+// tracks the SGR state (colors and text attributes), reporting on each SGR
+// token whether text after it is styled, and whether the stream is inside
+// an OSC 8 hyperlink.
+package ansitoken
 
 import "bytes"
 
+// TokenKind tells what a Token holds.
 type TokenKind int
 
 const (
-	TokenText  TokenKind = iota // Plain text, may contain symbols to link
+	TokenText  TokenKind = iota // Plain text, between escape sequences
 	TokenSGR                    // CSI Pm m - Select Graphic Rendition (colors, bold, etc.)
 	TokenCSI                    // CSI sequences other than SGR (cursor control, etc.)
 	TokenOSC8                   // OSC 8 hyperlink sequence
@@ -15,11 +22,21 @@ const (
 	TokenESC                    // ESC + single byte that's not a sequence introducer
 )
 
+// Token is one piece of the stream. Data holds its bytes exactly as fed:
+// concatenating the Data of every token returned gives back the input.
+// Data is a fresh copy that belongs to the caller, so it stays valid after
+// later Feed and Flush calls and may be modified or appended to; the slice
+// of Tokens holding it does not (see Feed).
 type Token struct {
 	Kind   TokenKind
 	Data   []byte
-	Styled bool // TokenSGR: true if styling remains active after this token
-	IsEnd  bool // TokenOSC8: true if this is a link-closing sequence (empty URI)
+	Styled bool   // TokenSGR: true if styling remains active after this token
+	FG     bool   // TokenSGR: a foreground color is active after this token
+	BG     bool   // TokenSGR: a background color is active after this token
+	Attrs  uint16 // TokenSGR: Attr* bits active after this token
+	IsEnd  bool   // TokenOSC8: true if this is a link-closing sequence (empty URI)
+	URI    string // TokenOSC8: the link target of an opening sequence
+	BEL    bool   // TokenOSC8, TokenOSC: terminated by BEL rather than ESC \\
 }
 
 type state int
@@ -48,20 +65,38 @@ type sgrState struct {
 	attrs    uint16
 }
 
+// Text attribute bits reported in Token.Attrs.
 const (
-	attrBold uint16 = 1 << iota
-	attrFaint
-	attrItalic
-	attrUnderline
-	attrBlinkSlow
-	attrBlinkRapid
-	attrInverse
-	attrConceal
-	attrStrikethrough
+	AttrBold uint16 = 1 << iota
+	AttrFaint
+	AttrItalic
+	AttrUnderline
+	AttrBlinkSlow
+	AttrBlinkRapid
+	AttrInverse
+	AttrConceal
+	AttrStrikethrough
 )
 
+// Trigger bits for foreground and background colors, placed above the attr
+// bits so a single mask can select any mix of colors and attributes.
+const (
+	TriggerFg uint16 = 1 << (iota + 14)
+	TriggerBg
+)
+
+// TriggerAll makes any active color or attribute count as styled.
+const TriggerAll = ^uint16(0)
+
 func (s *sgrState) styled() bool {
-	return s.fgActive || s.bgActive || s.attrs != 0
+	return s.styledFor(TriggerAll)
+}
+
+// styledFor reports whether any color or attribute selected by mask is active.
+func (s *sgrState) styledFor(mask uint16) bool {
+	return s.fgActive && mask&TriggerFg != 0 ||
+		s.bgActive && mask&TriggerBg != 0 ||
+		s.attrs&mask != 0
 }
 
 func (s *sgrState) reset() {
@@ -70,22 +105,43 @@ func (s *sgrState) reset() {
 	s.attrs = 0
 }
 
-type AnsiTokenizer struct {
+// Tokenizer turns a stream fed in chunks into Tokens. It is not safe for
+// concurrent use.
+type Tokenizer struct {
 	buf       []byte
 	state     state
 	prevState state
 	sgr       sgrState
+	trigger   uint16 // SGR state bits that make Token.Styled true
 	inOSC8    bool
+	tokens    []Token // reused by Feed and Flush for their results
+}
+
+// NewTokenizer returns a Tokenizer at the start of a stream, with no style
+// active and every color and attribute counting as styled.
+func NewTokenizer() *Tokenizer {
+	return &Tokenizer{
+		state:   stateGround,
+		trigger: TriggerAll,
+	}
 }
 
-func NewAnsiTokenizer() *AnsiTokenizer {
-	return &AnsiTokenizer{
-		state: stateGround,
+// SetTrigger limits which colors and attributes count as styled, e.g.
+// TriggerFg to ignore bold-only text. Zero restores the default, TriggerAll.
+func (t *Tokenizer) SetTrigger(mask uint16) {
+	if mask == 0 {
+		mask = TriggerAll
 	}
+	t.trigger = mask
 }
 
-func (t *AnsiTokenizer) Feed(p []byte) []Token {
-	var tokens []Token
+// Feed tokenizes the next chunk of the stream. Text and complete sequences
+// are returned at once; an escape sequence cut off at the end of p is held
+// until a later Feed completes it, or Flush gives up on it. p is not
+// retained. The returned slice is reused by the next Feed or Flush; copy
+// the Tokens out of it to keep them longer.
+func (t *Tokenizer) Feed(p []byte) []Token {
+	tokens := t.tokens[:0]
 
 	for i := 0; i < len(p); i++ {
 		b := p[i]
@@ -186,10 +242,15 @@ func (t *AnsiTokenizer) Feed(p []byte) []Token {
 		t.buf = t.buf[:0]
 	}
 
+	t.tokens = tokens
 	return tokens
 }
 
-func (t *AnsiTokenizer) Flush() []Token {
+// Flush returns an escape sequence left incomplete at the end of the
+// stream, as far as it got, and resets the Tokenizer to the ground state.
+// It returns nil if nothing is held. The returned slice is reused like
+// Feed's.
+func (t *Tokenizer) Flush() []Token {
 	if len(t.buf) == 0 {
 		return nil
 	}
@@ -200,30 +261,35 @@ func (t *AnsiTokenizer) Flush() []Token {
 	if kind == TokenCSI && len(t.buf) >= 2 {
 		params := t.buf[2:]
 		applySGRParams(params, &t.sgr)
-		tok.Styled = t.sgr.styled()
+		t.setStyle(&tok)
 	}
 
 	t.buf = t.buf[:0]
 	t.state = stateGround
 
-	return []Token{tok}
+	t.tokens = append(t.tokens[:0], tok)
+	return t.tokens
 }
 
-func (t *AnsiTokenizer) Styled() bool {
-	return t.sgr.styled()
+// Styled reports whether text fed now would be styled, as Token.Styled
+// reports on the last SGR token.
+func (t *Tokenizer) Styled() bool {
+	return t.sgr.styledFor(t.trigger)
 }
 
-func (t *AnsiTokenizer) InOSC8() bool {
+// InOSC8 reports whether the stream is inside an OSC 8 hyperlink: one was
+// opened and not yet closed.
+func (t *Tokenizer) InOSC8() bool {
 	return t.inOSC8
 }
 
-func (t *AnsiTokenizer) copyBuf() []byte {
+func (t *Tokenizer) copyBuf() []byte {
 	cp := make([]byte, len(t.buf))
 	copy(cp, t.buf)
 	return cp
 }
 
-func (t *AnsiTokenizer) inferIncompleteKind() TokenKind {
+func (t *Tokenizer) inferIncompleteKind() TokenKind {
 	if len(t.buf) == 0 {
 		return TokenText
 	}
@@ -245,7 +311,7 @@ func (t *AnsiTokenizer) inferIncompleteKind() TokenKind {
 	}
 }
 
-func (t *AnsiTokenizer) emitCSI() Token {
+func (t *Tokenizer) emitCSI() Token {
 	data := t.copyBuf()
 	tok := Token{Kind: TokenCSI, Data: data}
 
@@ -253,22 +319,32 @@ func (t *AnsiTokenizer) emitCSI() Token {
 		tok.Kind = TokenSGR
 		params := data[2 : len(data)-1]
 		applySGRParams(params, &t.sgr)
-		tok.Styled = t.sgr.styled()
+		t.setStyle(&tok)
 	}
 
 	return tok
 }
 
-func (t *AnsiTokenizer) emitOSC() Token {
+// setStyle records the SGR state after tok on tok.
+func (t *Tokenizer) setStyle(tok *Token) {
+	tok.Styled = t.sgr.styledFor(t.trigger)
+	tok.FG = t.sgr.fgActive
+	tok.BG = t.sgr.bgActive
+	tok.Attrs = t.sgr.attrs
+}
+
+func (t *Tokenizer) emitOSC() Token {
 	data := t.copyBuf()
 
 	oscData := extractOSCData(data)
-	if isEnd, ok := parseOSC8(oscData); ok {
+	bel := len(data) > 0 && data[len(data)-1] == belByte
+	if uri, ok := parseOSC8(oscData); ok {
+		isEnd := len(uri) == 0
 		t.inOSC8 = !isEnd
-		return Token{Kind: TokenOSC8, Data: data, IsEnd: isEnd}
+		return Token{Kind: TokenOSC8, Data: data, IsEnd: isEnd, URI: string(uri), BEL: bel}
 	}
 
-	return Token{Kind: TokenOSC, Data: data}
+	return Token{Kind: TokenOSC, Data: data, BEL: bel}
 }
 
 func extractOSCData(data []byte) []byte {
@@ -319,58 +395,62 @@ func applySGRParams(params []byte, st *sgrState) (explicit bool) {
 
 	codes := parseCSIParams(params)
 	for i := 0; i < len(codes); i++ {
-		code := codes[i]
+		code := codes[i].code
 		switch code {
 		case 0:
 			st.reset()
 			explicit = true
 		case 1:
-			st.attrs |= attrBold
+			st.attrs |= AttrBold
 			explicit = true
 		case 2:
-			st.attrs |= attrFaint
+			st.attrs |= AttrFaint
 			explicit = true
 		case 3:
-			st.attrs |= attrItalic
+			st.attrs |= AttrItalic
 			explicit = true
 		case 4:
-			st.attrs |= attrUnderline
+			if codes[i].hasSub && codes[i].firstSub == 0 {
+				st.attrs &^= AttrUnderline // 4:0 is "no underline"
+			} else {
+				st.attrs |= AttrUnderline
+			}
 			explicit = true
 		case 5:
-			st.attrs |= attrBlinkSlow
+			st.attrs |= AttrBlinkSlow
 			explicit = true
 		case 6:
-			st.attrs |= attrBlinkRapid
+			st.attrs |= AttrBlinkRapid
 			explicit = true
 		case 7:
-			st.attrs |= attrInverse
+			st.attrs |= AttrInverse
 			explicit = true
 		case 8:
-			st.attrs |= attrConceal
+			st.attrs |= AttrConceal
 			explicit = true
 		case 9:
-			st.attrs |= attrStrikethrough
+			st.attrs |= AttrStrikethrough
 			explicit = true
 		case 22:
-			st.attrs &^= attrBold | attrFaint
+			st.attrs &^= AttrBold | AttrFaint
 			explicit = true
 		case 23:
-			st.attrs &^= attrItalic
+			st.attrs &^= AttrItalic
 			explicit = true
 		case 24:
-			st.attrs &^= attrUnderline
+			st.attrs &^= AttrUnderline
 			explicit = true
 		case 25:
-			st.attrs &^= attrBlinkSlow | attrBlinkRapid
+			st.attrs &^= AttrBlinkSlow | AttrBlinkRapid
 			explicit = true
 		case 27:
-			st.attrs &^= attrInverse
+			st.attrs &^= AttrInverse
 			explicit = true
 		case 28:
-			st.attrs &^= attrConceal
+			st.attrs &^= AttrConceal
 			explicit = true
 		case 29:
-			st.attrs &^= attrStrikethrough
+			st.attrs &^= AttrStrikethrough
 			explicit = true
 		case 39:
 			st.fgActive = false
@@ -385,25 +465,29 @@ func applySGRParams(params []byte, st *sgrState) (explicit bool) {
 			} else if code == 38 {
 				st.fgActive = true
 				explicit = true
-				i += skipExtendedColor(codes, i+1)
+				if !codes[i].hasSub {
+					i += skipExtendedColor(codes, i+1)
+				}
 			} else if (code >= 40 && code <= 47) || (code >= 100 && code <= 107) {
 				st.bgActive = true
 				explicit = true
 			} else if code == 48 {
 				st.bgActive = true
 				explicit = true
-				i += skipExtendedColor(codes, i+1)
+				if !codes[i].hasSub {
+					i += skipExtendedColor(codes, i+1)
+				}
 			}
 		}
 	}
 	return explicit
 }
 
-func skipExtendedColor(codes []int, start int) int {
+func skipExtendedColor(codes []sgrParam, start int) int {
 	if start >= len(codes) {
 		return 0
 	}
-	switch codes[start] {
+	switch codes[start].code {
 	case 5:
 		return 2
 	case 2:
@@ -413,17 +497,31 @@ func skipExtendedColor(codes []int, start int) int {
 	}
 }
 
-func parseCSIParams(params []byte) []int {
-	var codes []int
+// sgrParam is one ';'-separated SGR parameter. ITU T.416 style parameters
+// carry ':'-separated sub-parameters inside the same field, e.g. "38:5:196"
+// or "4:3" (curly underline); firstSub holds the first of them.
+type sgrParam struct {
+	code     int
+	hasSub   bool
+	firstSub int
+}
+
+func parseCSIParams(params []byte) []sgrParam {
+	var codes []sgrParam
 	start := 0
 	for i := 0; i <= len(params); i++ {
 		if i == len(params) || params[i] == ';' {
-			if i > start {
-				code := parseNumber(params[start:i])
-				codes = append(codes, code)
+			field := params[start:i]
+			var p sgrParam
+			if head, tail, ok := bytes.Cut(field, []byte(":")); ok {
+				p.code = parseNumber(head)
+				p.hasSub = true
+				sub, _, _ := bytes.Cut(tail, []byte(":"))
+				p.firstSub = parseNumber(sub)
 			} else {
-				codes = append(codes, 0)
+				p.code = parseNumber(field)
 			}
+			codes = append(codes, p)
 			start = i + 1
 		}
 	}
@@ -440,14 +538,15 @@ func parseNumber(s []byte) int {
 	return n
 }
 
-func parseOSC8(data []byte) (isEnd bool, ok bool) {
+// parseOSC8 returns the URI of an OSC 8 payload ("8;params;URI"). An empty
+// URI closes the current link.
+func parseOSC8(data []byte) (uri []byte, ok bool) {
 	if !bytes.HasPrefix(data, []byte("8;")) {
-		return false, false
+		return nil, false
 	}
 	parts := bytes.SplitN(data, []byte(";"), 3)
 	if len(parts) < 3 {
-		return false, false
+		return nil, false
 	}
-	uri := parts[2]
-	return len(uri) == 0, true
+	return parts[2], true
 }
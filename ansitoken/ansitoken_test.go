@@ -1,4 +1,4 @@
-package main
+package ansitoken
 
 import (
 	"bytes"
@@ -44,8 +44,8 @@ func assertTokens(t *testing.T, got []Token, want []tokenExpectation) {
 	}
 }
 
-// TestAnsiTokenizerFeed exercises common tokenization paths with stepwise feeds.
-func TestAnsiTokenizerFeed(t *testing.T) {
+// TestTokenizerFeed exercises common tokenization paths with stepwise feeds.
+func TestTokenizerFeed(t *testing.T) {
 	type feedStep struct {
 		input string
 		want  []tokenExpectation
@@ -317,7 +317,7 @@ func TestAnsiTokenizerFeed(t *testing.T) {
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			tok := NewAnsiTokenizer()
+			tok := NewTokenizer()
 			for _, step := range tc.steps {
 				got := tok.Feed([]byte(step.input))
 				assertTokens(t, got, step.want)
@@ -334,6 +334,38 @@ func TestAnsiTokenizerFeed(t *testing.T) {
 	}
 }
 
+func TestTokenizerSGRSnapshot(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantFG  bool
+		wantBG  bool
+		wantAtt uint16
+	}{
+		{name: "bold", input: csi + "1m", wantAtt: AttrBold},
+		{name: "foreground", input: csi + "31m", wantFG: true},
+		{name: "background", input: csi + "44m", wantBG: true},
+		{name: "combined", input: csi + "1;4;38;5;196;48;2;0;0;0m", wantFG: true, wantBG: true, wantAtt: AttrBold | AttrUnderline},
+		{name: "accumulates", input: csi + "3m" + csi + "31m", wantFG: true, wantAtt: AttrItalic},
+		{name: "partial reset", input: csi + "1;31m" + csi + "39m", wantAtt: AttrBold},
+		{name: "full reset", input: csi + "1;31;44m" + csi + "0m"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := NewTokenizer().Feed([]byte(tt.input))
+			last := tokens[len(tokens)-1]
+			if last.Kind != TokenSGR {
+				t.Fatalf("last token kind = %d, want TokenSGR", last.Kind)
+			}
+			if last.FG != tt.wantFG || last.BG != tt.wantBG || last.Attrs != tt.wantAtt {
+				t.Errorf("got FG=%v BG=%v Attrs=%#x, want FG=%v BG=%v Attrs=%#x",
+					last.FG, last.BG, last.Attrs, tt.wantFG, tt.wantBG, tt.wantAtt)
+			}
+		})
+	}
+}
+
 func TestSgrSetsStyled(t *testing.T) {
 	tests := []struct {
 		params   string
@@ -359,6 +391,13 @@ func TestSgrSetsStyled(t *testing.T) {
 		{"22;1", true, true},
 		{"40", true, true},
 		{"100", true, true},
+		{"38:5:196", true, true},
+		{"38:5:196;39", false, true},
+		{"38:2::255:0:0", true, true},
+		{"38:2::255:0:0;39", false, true},
+		{"48:5:1;49", false, true},
+		{"4:3", true, true},
+		{"4:3;4:0", false, true},
 	}
 
 	for _, tt := range tests {
@@ -393,31 +432,83 @@ func TestApplySGRParamsStateful(t *testing.T) {
 	}
 }
 
+func TestSgrStateStyledFor(t *testing.T) {
+	tests := []struct {
+		params string
+		mask   uint16
+		want   bool
+	}{
+		{"1", TriggerAll, true},
+		{"1", TriggerFg, false},
+		{"1", AttrBold, true},
+		{"31", TriggerFg, true},
+		{"31", TriggerBg, false},
+		{"41", TriggerFg | TriggerBg, true},
+		{"1;31", TriggerFg, true},
+		{"4", AttrBold | AttrItalic, false},
+		{"0", TriggerAll, false},
+	}
+
+	for _, tt := range tests {
+		var st sgrState
+		applySGRParams([]byte(tt.params), &st)
+		if got := st.styledFor(tt.mask); got != tt.want {
+			t.Errorf("styledFor(%q, %#x) = %v, want %v", tt.params, tt.mask, got, tt.want)
+		}
+	}
+}
+
 func TestParseOSC8(t *testing.T) {
 	tests := []struct {
-		data  string
-		isEnd bool
-		ok    bool
+		data string
+		uri  string
+		ok   bool
 	}{
-		{"8;;https://example.com", false, true},
-		{"8;;", true, true},
-		{"8;id=foo;https://example.com", false, true},
-		{"8;id=foo;", true, true},
-		{"0;title", false, false},
-		{"8", false, false},
-		{"8;", false, false},
+		{"8;;https://example.com", "https://example.com", true},
+		{"8;;", "", true},
+		{"8;id=foo;https://example.com", "https://example.com", true},
+		{"8;id=foo;", "", true},
+		{"8;;https://example.com/?a=1;b=2", "https://example.com/?a=1;b=2", true},
+		{"0;title", "", false},
+		{"8", "", false},
+		{"8;", "", false},
 	}
 
 	for _, tt := range tests {
-		isEnd, ok := parseOSC8([]byte(tt.data))
-		if isEnd != tt.isEnd || ok != tt.ok {
-			t.Errorf("parseOSC8(%q): got (%v, %v), want (%v, %v)",
-				tt.data, isEnd, ok, tt.isEnd, tt.ok)
+		uri, ok := parseOSC8([]byte(tt.data))
+		if string(uri) != tt.uri || ok != tt.ok {
+			t.Errorf("parseOSC8(%q): got (%q, %v), want (%q, %v)",
+				tt.data, uri, ok, tt.uri, tt.ok)
 		}
 	}
 }
 
-func TestAnsiTokenizerBufferOverflow(t *testing.T) {
+func TestTokenizerOSCTerminator(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantBEL bool
+	}{
+		{name: "OSC 8 with ST", input: osc + "8;;https://example.com" + st, wantBEL: false},
+		{name: "OSC 8 with BEL", input: osc + "8;;https://example.com" + bel, wantBEL: true},
+		{name: "OSC 8 close with BEL", input: osc + "8;;" + bel, wantBEL: true},
+		{name: "other OSC with BEL", input: osc + "0;title" + bel, wantBEL: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := NewTokenizer().Feed([]byte(tt.input))
+			if len(tokens) != 1 {
+				t.Fatalf("expected 1 token, got %d", len(tokens))
+			}
+			if tokens[0].BEL != tt.wantBEL {
+				t.Errorf("BEL = %v, want %v", tokens[0].BEL, tt.wantBEL)
+			}
+		})
+	}
+}
+
+func TestTokenizerBufferOverflow(t *testing.T) {
 	tests := []struct {
 		name      string
 		input     []byte
@@ -448,7 +539,7 @@ func TestAnsiTokenizerBufferOverflow(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tok := NewAnsiTokenizer()
+			tok := NewTokenizer()
 			tokens := tok.Feed(tt.input)
 			if len(tokens) == 0 {
 				t.Fatal("expected tokens for overflow input")
@@ -476,8 +567,11 @@ func TestAnsiTokenizerBufferOverflow(t *testing.T) {
 	}
 }
 
-// TestAnsiTokenizerDataLifetime ensures copied token data stays stable after later feeds.
-func TestAnsiTokenizerDataLifetime(t *testing.T) {
+// TestTokenizerDataLifetime checks the Token.Data contract: data belongs to
+// the caller, stays stable after later feeds and can be modified without
+// affecting the tokenizer. The token slice itself is reused, so only Data is
+// kept across Feed calls.
+func TestTokenizerDataLifetime(t *testing.T) {
 	tests := []struct {
 		name   string
 		first  string
@@ -490,17 +584,33 @@ func TestAnsiTokenizerDataLifetime(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tok := NewAnsiTokenizer()
-			tokens1 := tok.Feed([]byte(tt.first))
-			// Copy token data to verify it is safe to retain across subsequent feeds.
-			data1Copy := make([]byte, len(tokens1[0].Data))
-			copy(data1Copy, tokens1[0].Data)
+			tok := NewTokenizer()
+			input := []byte(tt.first)
+			data1 := tok.Feed(input)[0].Data
+			clear(input) // Feed does not retain its argument
 
-			tok.Feed([]byte(tt.second))
+			tokens2 := tok.Feed([]byte(tt.second))
 
-			if !bytes.Equal(data1Copy, []byte(tt.want)) {
-				t.Errorf("expected copy %q, got %q", tt.want, data1Copy)
+			if !bytes.Equal(data1, []byte(tt.want)) {
+				t.Errorf("expected data %q, got %q", tt.want, data1)
+			}
+			data1[0] = 'X'
+			if string(tokens2[0].Data) != tt.second {
+				t.Errorf("expected later data %q, got %q", tt.second, tokens2[0].Data)
 			}
 		})
 	}
 }
+
+func BenchmarkTokenizer_Feed(b *testing.B) {
+	line := []byte("\x1b[1;32m   Compiling\x1b[0m osc8wrap v0.1.0 (\x1b[4m/src/osc8wrap\x1b[24m)\r\n" +
+		"\x1b]8;;https://example.com\x1b\\docs\x1b]8;;\x1b\\ plain text follows here\n")
+	chunk := bytes.Repeat(line, (32*1024)/len(line))
+
+	tokenizer := NewTokenizer()
+	b.SetBytes(int64(len(chunk)))
+	b.ReportAllocs()
+	for b.Loop() {
+		tokenizer.Feed(chunk)
+	}
+}
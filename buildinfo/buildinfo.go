@@ -0,0 +1,53 @@
+package buildinfo
+
+import (
+	"runtime/debug"
+	"strings"
+)
+
+// String describes the running binary for --version, e.g.
+// "osc8wrap v0.4.0 (commit 1a2b3c4d5e6f, go1.25.5)". version and commit are
+// the values release builds set with -ldflags "-X main.version=...";
+// whatever they leave empty is taken from the build info the go command
+// embeds, so "go install ...@v0.4.0" and source builds report sensibly too.
+func String(name, version, commit string) string {
+	info, _ := debug.ReadBuildInfo()
+	return format(name, version, commit, info)
+}
+
+func format(name, version, commit string, info *debug.BuildInfo) string {
+	goVersion := "unknown"
+	modified := false
+	if info != nil {
+		goVersion = info.GoVersion
+		if version == "" {
+			version = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if commit == "" {
+					commit = s.Value
+				}
+			case "vcs.modified":
+				modified = s.Value == "true"
+			}
+		}
+	}
+	if version == "" {
+		version = "(devel)"
+	}
+
+	var details []string
+	if commit != "" {
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		if modified {
+			commit += "-dirty"
+		}
+		details = append(details, "commit "+commit)
+	}
+	details = append(details, goVersion)
+	return name + " " + version + " (" + strings.Join(details, ", ") + ")"
+}
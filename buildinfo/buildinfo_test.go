@@ -0,0 +1,61 @@
+package buildinfo
+
+import (
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		commit  string
+		info    *debug.BuildInfo
+		want    string
+	}{
+		{
+			name:    "release build with ldflags",
+			version: "v0.4.0",
+			commit:  "1a2b3c4d5e6f7a8b9c0d",
+			info:    &debug.BuildInfo{GoVersion: "go1.25.5"},
+			want:    "osc8wrap v0.4.0 (commit 1a2b3c4d5e6f, go1.25.5)",
+		},
+		{
+			name: "go install of a tagged version",
+			info: &debug.BuildInfo{GoVersion: "go1.25.5", Main: debug.Module{Version: "v0.4.0"}},
+			want: "osc8wrap v0.4.0 (go1.25.5)",
+		},
+		{
+			name: "source build with uncommitted changes",
+			info: &debug.BuildInfo{
+				GoVersion: "go1.25.5",
+				Main:      debug.Module{Version: "(devel)"},
+				Settings: []debug.BuildSetting{
+					{Key: "vcs.revision", Value: "abcdef0123456789"},
+					{Key: "vcs.modified", Value: "true"},
+				},
+			},
+			want: "osc8wrap (devel) (commit abcdef012345-dirty, go1.25.5)",
+		},
+		{
+			name: "no build info",
+			want: "osc8wrap (devel) (unknown)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := format("osc8wrap", tt.version, tt.commit, tt.info); got != tt.want {
+				t.Errorf("format() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	got := String("osc8wrap", "", "")
+	if !strings.HasPrefix(got, "osc8wrap ") || !strings.Contains(got, "go1.") {
+		t.Errorf("String() = %q, want name and Go version", got)
+	}
+}
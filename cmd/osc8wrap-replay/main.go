@@ -5,27 +5,53 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"io"
+	"math"
 	"os"
 	"os/signal"
 	"strings"
+	"time"
 
+	"github.com/mash/osc8wrap/buildinfo"
+	"github.com/mash/osc8wrap/termreset"
 	"golang.org/x/term"
 )
 
+// version and commit are set by release builds, as for osc8wrap.
+var version, commit string
+
+// defaultSpeed is the --speed of --auto, in writes per second.
+const defaultSpeed = 10
+
 const usage = `Usage: osc8wrap-replay [options] <debug-log-file>
 
 Replay osc8wrap --debug-writes logs one write at a time.
-Press Enter to advance to the next write chunk.
+Press Enter to advance to the next write chunk, or use --auto or --realtime.
+Type :N and Enter to jump to write #N.
 
 Options:
   --file PATH           Path to debug log file (alternative to positional arg)
-  --stream MODE         Stream to replay: output, input (default: output)
+  --stream MODE         Stream to replay: output, input, or diff to show both
+                        as quoted text (default: output)
+  --lenient             Drop a truncated final write block instead of failing
+  --strict              Fail unless write numbers go up by one, as they do in
+                        a whole log from one session
+  --auto                Advance on a timer instead of waiting for Enter
+  --speed N             Writes per second with --auto; implies --auto (default: 10)
+  --realtime            Advance with the pauses between the writes as recorded
+  --all                 Write every record at once, without stepping, for
+                        piping the reconstructed stream into another program
+  --only-links          Replay only the writes whose output opens a link
+  --start N             Start at write #N, skipping the writes before it
+  --end N               Stop after write #N
+  --version             Print the version, commit and Go version, then exit
 
 Examples:
   osc8wrap-replay --file /tmp/osc8wrap-debug-foo-20260214-110857.log
   osc8wrap-replay --stream=input /tmp/osc8wrap-debug-foo-20260214-110857.log
   osc8wrap-replay --stream=output /tmp/osc8wrap-debug-foo-20260214-110857.log
+  osc8wrap-replay --stream=diff /tmp/osc8wrap-debug-foo-20260214-110857.log
+  osc8wrap-replay --speed=30 /tmp/osc8wrap-debug-foo-20260214-110857.log
+  osc8wrap-replay --all /tmp/osc8wrap-debug-foo-20260214-110857.log | aha > session.html
 `
 
 func main() {
@@ -35,6 +61,15 @@ func main() {
 func run() int {
 	var filePath string
 	var stream string
+	var lenient bool
+	var strict bool
+	var auto bool
+	var speed float64
+	var realtime bool
+	var start, end int
+	var all bool
+	var onlyLinks bool
+	var showVersion bool
 
 	fs := flag.NewFlagSet("osc8wrap-replay", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
@@ -42,12 +77,27 @@ func run() int {
 		_, _ = fmt.Fprint(os.Stderr, usage)
 	}
 	fs.StringVar(&filePath, "file", "", "Path to debug log file")
-	fs.StringVar(&stream, "stream", string(StreamOutput), "Replay stream: output, input")
+	fs.StringVar(&stream, "stream", string(StreamOutput), "Replay stream: output, input, diff")
+	fs.BoolVar(&lenient, "lenient", false, "Drop a truncated final write block instead of failing")
+	fs.BoolVar(&strict, "strict", false, "Fail unless write numbers go up by one")
+	fs.BoolVar(&auto, "auto", false, "Advance on a timer instead of waiting for Enter")
+	fs.Float64Var(&speed, "speed", defaultSpeed, "Writes per second with --auto; implies --auto")
+	fs.BoolVar(&realtime, "realtime", false, "Advance with the pauses between the writes as recorded")
+	fs.BoolVar(&all, "all", false, "Write every record at once, without stepping")
+	fs.BoolVar(&onlyLinks, "only-links", false, "Replay only the writes whose output opens a link")
+	fs.IntVar(&start, "start", 0, "Start at write #N, skipping the writes before it")
+	fs.IntVar(&end, "end", 0, "Stop after write #N")
+	fs.BoolVar(&showVersion, "version", false, "Print the version, commit and Go version")
 
 	if err := fs.Parse(os.Args[1:]); err != nil {
 		return 2
 	}
 
+	if showVersion {
+		_, _ = fmt.Println(buildinfo.String("osc8wrap-replay", version, commit))
+		return 0
+	}
+
 	if filePath != "" && fs.NArg() > 0 {
 		_, _ = fmt.Fprintf(os.Stderr, "osc8wrap-replay: unexpected positional arguments: %s\n\n", strings.Join(fs.Args(), " "))
 		fs.Usage()
@@ -64,6 +114,30 @@ func run() int {
 		filePath = fs.Arg(0)
 	}
 
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "speed" {
+			auto = true
+		}
+	})
+	if speed <= 0 || math.IsInf(speed, 0) || math.IsNaN(speed) {
+		_, _ = fmt.Fprintf(os.Stderr, "osc8wrap-replay: invalid --speed %v (expected a positive number of writes per second)\n", speed)
+		return 2
+	}
+
+	if realtime && auto {
+		_, _ = fmt.Fprintln(os.Stderr, "osc8wrap-replay: --realtime cannot be combined with --auto or --speed")
+		return 2
+	}
+
+	if all && (auto || realtime) {
+		_, _ = fmt.Fprintln(os.Stderr, "osc8wrap-replay: --all cannot be combined with --auto, --speed or --realtime")
+		return 2
+	}
+	if start < 0 || end < 0 {
+		_, _ = fmt.Fprintln(os.Stderr, "osc8wrap-replay: --start and --end take a write number")
+		return 2
+	}
+
 	mode, err := ParseStreamMode(stream)
 	if err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "osc8wrap-replay: %v\n", err)
@@ -77,30 +151,63 @@ func run() int {
 	}
 	defer f.Close() //nolint:errcheck
 
-	records, err := ParseDebugLog(f)
+	records, dropped, err := ParseDebugLogWithOptions(f, ParseOptions{Lenient: lenient, Strict: strict})
+	if dropped != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "osc8wrap-replay: warning: dropped %v\n", dropped)
+	}
 	if err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "osc8wrap-replay: parse %s: %v\n", filePath, err)
 		return 1
 	}
 
+	if all {
+		// Nothing is added to the stream, not even the terminal reset, so
+		// it can be fed to other programs as recorded.
+		opts := ReplayOptions{Mode: mode, Start: start, End: end, OnlyLinks: onlyLinks}
+		if err := WriteAll(os.Stdout, records, opts); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "osc8wrap-replay: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
 
+	if realtime && !hasTimes(records) {
+		_, _ = fmt.Fprintln(os.Stderr, "osc8wrap-replay: warning: the log has no Time lines; replaying without pauses")
+	}
+
+	// Timed modes need no keys, so they can run with stdin redirected;
+	// SIGINT then interrupts them instead of a Ctrl-C read from the terminal.
 	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
-	if err != nil {
+	if err == nil {
+		defer func() {
+			_ = term.Restore(int(os.Stdin.Fd()), oldState)
+		}()
+	} else if !auto && !realtime {
 		_, _ = fmt.Fprintf(os.Stderr, "osc8wrap-replay: make raw stdin: %v\n", err)
 		return 1
 	}
-	defer func() {
-		_ = term.Restore(int(os.Stdin.Fd()), oldState)
-	}()
-
-	_, _ = fmt.Fprintf(os.Stderr, "osc8wrap-replay: replaying %s. Press enter to proceed one step\n", filePath)
 
 	opts := ReplayOptions{
-		Mode: mode,
+		Mode:      mode,
+		Start:     start,
+		End:       end,
+		OnlyLinks: onlyLinks,
+		Echo:      os.Stderr,
 	}
-	defer resetTerminal(os.Stdout)
+	switch {
+	case realtime:
+		opts.Realtime = true
+		_, _ = fmt.Fprintf(os.Stderr, "osc8wrap-replay: replaying %s in real time. Press enter to skip ahead, Ctrl-C to stop\n", filePath)
+	case auto:
+		opts.Interval = max(time.Duration(float64(time.Second)/speed), 1)
+		_, _ = fmt.Fprintf(os.Stderr, "osc8wrap-replay: replaying %s at %g writes per second. Press enter to skip ahead, Ctrl-C to stop\n", filePath, speed)
+	default:
+		_, _ = fmt.Fprintf(os.Stderr, "osc8wrap-replay: replaying %s. Press enter to proceed one step\n", filePath)
+	}
+	defer termreset.Write(os.Stdout) //nolint:errcheck
 
 	if err := ReplayWrites(ctx, records, os.Stdin, os.Stdout, opts); err != nil {
 		if errors.Is(err, errInterrupted) {
@@ -113,14 +220,12 @@ func run() int {
 	return 0
 }
 
-func resetTerminal(w io.Writer) {
-	_, _ = w.Write([]byte(strings.Join([]string{
-		"\x1b[<u",     // pop keyboard mode (Kitty protocol)
-		"\x1b[?1004l", // disable focus reporting
-		"\x1b[?2004l", // disable bracketed paste
-		"\x1b[?2026l", // disable synchronized output
-		"\x1b[r",      // reset scroll region
-		"\x1b[0m",     // reset SGR attributes
-		"\x1b[?25h",   // show cursor
-	}, "")))
+// hasTimes reports whether any record has the Time that newer logs record.
+func hasTimes(records []WriteRecord) bool {
+	for _, rec := range records {
+		if !rec.Time.IsZero() {
+			return true
+		}
+	}
+	return false
 }
@@ -2,17 +2,22 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 type WriteRecord struct {
 	Seq    int
+	Time   time.Time // when osc8wrap received the write; zero in logs from before Time lines
 	Input  []byte
 	Output []byte
 }
@@ -22,13 +27,80 @@ type StreamMode string
 const (
 	StreamOutput StreamMode = "output"
 	StreamInput  StreamMode = "input"
+	StreamDiff   StreamMode = "diff" // input and output of each write as quoted text, see emitDiff
 )
 
 type ReplayOptions struct {
 	Mode StreamMode
+	// Interval, if positive, advances to the next record on a timer
+	// instead of waiting for Enter. Enter still advances at once, and
+	// Ctrl-C still interrupts.
+	Interval time.Duration
+	// Realtime, if set, advances after the time that passed between the
+	// recorded writes, see recordDelay, and overrides Interval.
+	Realtime bool
+	// Start and End, if positive, are the Seq of the first and last write
+	// to replay. Writes before Start are skipped, not emitted.
+	Start int
+	End   int
+	// OnlyLinks skips the writes whose output opens no OSC 8 link.
+	OnlyLinks bool
+	// Echo, if set, receives what the user types of a ":N" jump command,
+	// which raw mode does not echo.
+	Echo io.Writer
+	// After returns a channel that receives once d has passed. It is
+	// time.After if nil; tests replace it with a fake clock.
+	After func(d time.Duration) <-chan time.Time
+}
+
+// ParseErrorKind classifies why ParseDebugLog rejected a log.
+type ParseErrorKind int
+
+const (
+	ParseErrorIncompleteBlock    ParseErrorKind = iota + 1 // write block missing its Input or Output line
+	ParseErrorInvalidHeader                                // malformed "=== Write #N (M bytes) ===" line
+	ParseErrorInvalidPayload                               // Input/Output value is not a valid Go quoted string
+	ParseErrorDuplicateField                               // Input or Output repeated within one block
+	ParseErrorUnexpectedContent                            // unrecognized line inside or outside a block
+	ParseErrorNoBlocks                                     // log contains no write blocks at all
+	ParseErrorInvalidTime                                  // Time value is not an RFC 3339 timestamp
+	ParseErrorNonContiguous                                // with Strict, a write number does not follow the one before
+	ParseErrorUnsupportedVersion                           // "# osc8wrap-debug vN" header for a newer or unknown format
+)
+
+// ParseError reports a malformed debug log. Line is the 1-based line the
+// problem was detected on; for ParseErrorIncompleteBlock it is the line of
+// the offending block's header, and for ParseErrorNoBlocks it is zero.
+type ParseError struct {
+	Line int
+	Kind ParseErrorKind
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	switch e.Kind {
+	case ParseErrorIncompleteBlock:
+		return fmt.Sprintf("incomplete write block starting at line %d", e.Line)
+	case ParseErrorNoBlocks:
+		return "no write blocks found"
+	default:
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
 }
 
 var writeHeaderPattern = regexp.MustCompile(`^=== Write #(\d+) \(\d+ bytes\) ===$`)
+
+// logVersionPrefix starts the first line of a debug log, which names the
+// version of its format. Logs from before the line existed are version 0.
+const logVersionPrefix = "# osc8wrap-debug v"
+
+// maxLogVersion is the newest debug log format this package reads.
+const maxLogVersion = 1
+
 var errInterrupted = errors.New("interrupted")
 
 func ParseStreamMode(value string) (StreamMode, error) {
@@ -37,34 +109,60 @@ func ParseStreamMode(value string) (StreamMode, error) {
 		return StreamOutput, nil
 	case string(StreamInput):
 		return StreamInput, nil
+	case string(StreamDiff):
+		return StreamDiff, nil
 	default:
-		return "", fmt.Errorf("invalid --stream %q (expected: output, input)", value)
+		return "", fmt.Errorf("invalid --stream %q (expected: output, input, diff)", value)
 	}
 }
 
+// ParseOptions adjusts what ParseDebugLogWithOptions accepts.
+type ParseOptions struct {
+	// Lenient drops a truncated final write block, see ParseDebugLogLenient.
+	Lenient bool
+	// Strict requires each write number to be one more than the one
+	// before, so a log with gaps, or two logs run together, is rejected.
+	Strict bool
+}
+
 func ParseDebugLog(r io.Reader) ([]WriteRecord, error) {
+	records, _, err := ParseDebugLogWithOptions(r, ParseOptions{})
+	return records, err
+}
+
+// ParseDebugLogLenient is like ParseDebugLog but tolerates a truncated final
+// write block, as left behind by a crashed session. The incomplete block is
+// dropped and reported as dropped; the preceding records are returned.
+func ParseDebugLogLenient(r io.Reader) (records []WriteRecord, dropped *ParseError, err error) {
+	return ParseDebugLogWithOptions(r, ParseOptions{Lenient: true})
+}
+
+// ParseDebugLogWithOptions is ParseDebugLog with the checks of opts. dropped
+// is only ever set with opts.Lenient.
+func ParseDebugLogWithOptions(r io.Reader, opts ParseOptions) (records []WriteRecord, dropped *ParseError, err error) {
 	scanner := bufio.NewScanner(r)
 	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
 
-	var records []WriteRecord
 	var current WriteRecord
 	var lineNum int
 	var blockStartLine int
 	var inBlock bool
 	var hasInput bool
 	var hasOutput bool
+	var hasTime bool
 
 	finalize := func() error {
 		if !inBlock {
 			return nil
 		}
 		if !hasInput || !hasOutput {
-			return fmt.Errorf("incomplete write block starting at line %d", blockStartLine)
+			return &ParseError{Line: blockStartLine, Kind: ParseErrorIncompleteBlock}
 		}
 		records = append(records, current)
 		inBlock = false
 		hasInput = false
 		hasOutput = false
+		hasTime = false
 		return nil
 	}
 
@@ -72,14 +170,28 @@ func ParseDebugLog(r io.Reader) ([]WriteRecord, error) {
 		lineNum++
 		line := scanner.Text()
 
+		if lineNum == 1 && strings.HasPrefix(line, "# osc8wrap-debug ") {
+			version, err := strconv.Atoi(strings.TrimPrefix(line, logVersionPrefix))
+			if err != nil || !strings.HasPrefix(line, logVersionPrefix) || version < 0 {
+				return nil, nil, &ParseError{Line: lineNum, Kind: ParseErrorUnsupportedVersion, Err: fmt.Errorf("invalid format header %q", line)}
+			}
+			if version > maxLogVersion {
+				return nil, nil, &ParseError{Line: lineNum, Kind: ParseErrorUnsupportedVersion, Err: fmt.Errorf("log format v%d is newer than this osc8wrap-replay reads (up to v%d); update it", version, maxLogVersion)}
+			}
+			continue
+		}
+
 		if strings.HasPrefix(line, "=== Write #") {
 			if err := finalize(); err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 
 			seq, err := parseWriteHeader(line)
 			if err != nil {
-				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+				return nil, nil, &ParseError{Line: lineNum, Kind: ParseErrorInvalidHeader, Err: err}
+			}
+			if opts.Strict && blockStartLine > 0 && seq != current.Seq+1 {
+				return nil, nil, &ParseError{Line: lineNum, Kind: ParseErrorNonContiguous, Err: fmt.Errorf("write #%d follows write #%d", seq, current.Seq)}
 			}
 			current = WriteRecord{Seq: seq}
 			blockStartLine = lineNum
@@ -92,16 +204,29 @@ func ParseDebugLog(r io.Reader) ([]WriteRecord, error) {
 		}
 
 		if !inBlock {
-			return nil, fmt.Errorf("line %d: unexpected content outside write block", lineNum)
+			return nil, nil, &ParseError{Line: lineNum, Kind: ParseErrorUnexpectedContent, Err: errors.New("unexpected content outside write block")}
+		}
+
+		if strings.HasPrefix(line, "Time:   ") {
+			if hasTime {
+				return nil, nil, &ParseError{Line: lineNum, Kind: ParseErrorDuplicateField, Err: fmt.Errorf("duplicate Time line for write #%d", current.Seq)}
+			}
+			t, err := time.Parse(time.RFC3339Nano, strings.TrimPrefix(line, "Time:   "))
+			if err != nil {
+				return nil, nil, &ParseError{Line: lineNum, Kind: ParseErrorInvalidTime, Err: fmt.Errorf("invalid time for write #%d: %w", current.Seq, err)}
+			}
+			current.Time = t
+			hasTime = true
+			continue
 		}
 
 		if strings.HasPrefix(line, "Input:  ") {
 			if hasInput {
-				return nil, fmt.Errorf("line %d: duplicate Input line for write #%d", lineNum, current.Seq)
+				return nil, nil, &ParseError{Line: lineNum, Kind: ParseErrorDuplicateField, Err: fmt.Errorf("duplicate Input line for write #%d", current.Seq)}
 			}
 			decoded, err := parseQuotedPayload(strings.TrimPrefix(line, "Input:  "))
 			if err != nil {
-				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+				return nil, nil, &ParseError{Line: lineNum, Kind: ParseErrorInvalidPayload, Err: err}
 			}
 			current.Input = decoded
 			hasInput = true
@@ -110,31 +235,33 @@ func ParseDebugLog(r io.Reader) ([]WriteRecord, error) {
 
 		if strings.HasPrefix(line, "Output: ") {
 			if hasOutput {
-				return nil, fmt.Errorf("line %d: duplicate Output line for write #%d", lineNum, current.Seq)
+				return nil, nil, &ParseError{Line: lineNum, Kind: ParseErrorDuplicateField, Err: fmt.Errorf("duplicate Output line for write #%d", current.Seq)}
 			}
 			decoded, err := parseQuotedPayload(strings.TrimPrefix(line, "Output: "))
 			if err != nil {
-				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+				return nil, nil, &ParseError{Line: lineNum, Kind: ParseErrorInvalidPayload, Err: err}
 			}
 			current.Output = decoded
 			hasOutput = true
 			continue
 		}
 
-		return nil, fmt.Errorf("line %d: unexpected line inside write block", lineNum)
+		return nil, nil, &ParseError{Line: lineNum, Kind: ParseErrorUnexpectedContent, Err: errors.New("unexpected line inside write block")}
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if err := finalize(); err != nil {
-		return nil, err
+		if !opts.Lenient || !errors.As(err, &dropped) || dropped.Kind != ParseErrorIncompleteBlock {
+			return nil, nil, err
+		}
 	}
 	if len(records) == 0 {
-		return nil, errors.New("no write blocks found")
+		return nil, nil, &ParseError{Kind: ParseErrorNoBlocks}
 	}
 
-	return records, nil
+	return records, dropped, nil
 }
 
 func ReplayWrites(ctx context.Context, records []WriteRecord, stepInput io.Reader, streamOutput io.Writer, opts ReplayOptions) error {
@@ -148,6 +275,14 @@ func ReplayWrites(ctx context.Context, records []WriteRecord, stepInput io.Reade
 	if _, err := ParseStreamMode(string(opts.Mode)); err != nil {
 		return err
 	}
+	if opts.OnlyLinks {
+		records = slices.DeleteFunc(slices.Clone(records), func(rec WriteRecord) bool {
+			return !opensLink(rec.Output)
+		})
+		if len(records) == 0 {
+			return errors.New("no write in the log opens a link")
+		}
+	}
 	if stepInput == nil {
 		return errors.New("step input is nil")
 	}
@@ -155,38 +290,198 @@ func ReplayWrites(ctx context.Context, records []WriteRecord, stepInput io.Reade
 		streamOutput = io.Discard
 	}
 
-	reader := bufio.NewReader(stepInput)
+	after := opts.After
+	if after == nil {
+		after = time.After
+	}
 
-	for i, rec := range records {
+	first, last, err := replayRange(records, opts.Start, opts.End)
+	if err != nil {
+		return err
+	}
+	echo := opts.Echo
+	if echo == nil {
+		echo = io.Discard
+	}
+
+	steps := make(chan step)
+	done := make(chan struct{})
+	defer close(done)
+	go readSteps(bufio.NewReader(stepInput), echo, steps, done)
+
+	for i := first; ; {
+		rec := records[i]
 		if err := emitRecord(streamOutput, rec, opts.Mode); err != nil {
 			return err
 		}
 
-		if i == len(records)-1 {
+		if i == last {
 			break
 		}
 
-		errCh := make(chan error, 1)
-		go func() {
-			errCh <- waitForNextStep(reader)
-		}()
+		var timer <-chan time.Time
+		switch {
+		case opts.Realtime:
+			timer = after(recordDelay(rec, records[i+1]))
+		case opts.Interval > 0:
+			timer = after(opts.Interval)
+		}
 
-		select {
-		case <-ctx.Done():
-			return errInterrupted
-		case err := <-errCh:
-			if errors.Is(err, io.EOF) {
-				return nil
-			}
-			if err != nil {
-				return err
+		next := i + 1
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return errInterrupted
+			case <-timer:
+				break wait
+			case st := <-steps:
+				if errors.Is(st.err, io.EOF) {
+					if timer == nil {
+						return nil
+					}
+					// Without step input, auto mode runs on the timer alone.
+					steps = nil
+					continue
+				}
+				if st.err != nil {
+					return st.err
+				}
+				if st.seek {
+					j := seekRecord(records, st.seq)
+					if j < 0 || j > last {
+						_, _ = fmt.Fprintf(echo, "no write #%d to jump to\r\n", st.seq)
+						continue
+					}
+					next = j
+				}
+				break wait
 			}
 		}
+		i = next
 	}
 
 	return nil
 }
 
+// WriteAll writes the records in opts.Start..End back to back, without
+// stepping, reconstructing the stream a session wrote. Only opts.Mode,
+// Start, End and OnlyLinks apply.
+func WriteAll(w io.Writer, records []WriteRecord, opts ReplayOptions) error {
+	if len(records) == 0 {
+		return errors.New("no records to replay")
+	}
+	if opts.Mode == "" {
+		opts.Mode = StreamOutput
+	}
+	if _, err := ParseStreamMode(string(opts.Mode)); err != nil {
+		return err
+	}
+	if opts.OnlyLinks {
+		records = slices.DeleteFunc(slices.Clone(records), func(rec WriteRecord) bool {
+			return !opensLink(rec.Output)
+		})
+		if len(records) == 0 {
+			return errors.New("no write in the log opens a link")
+		}
+	}
+	first, last, err := replayRange(records, opts.Start, opts.End)
+	if err != nil {
+		return err
+	}
+	for _, rec := range records[first : last+1] {
+		if err := emitRecord(w, rec, opts.Mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// opensLink reports whether b holds an OSC 8 sequence that opens a link,
+// as opposed to one that closes it with an empty URI.
+func opensLink(b []byte) bool {
+	for {
+		i := bytes.Index(b, []byte("\x1b]8;"))
+		if i < 0 {
+			return false
+		}
+		b = b[i+len("\x1b]8;"):]
+		// The parameters, such as id=x, end at the first ';'.
+		j := bytes.IndexByte(b, ';')
+		if j < 0 {
+			return false
+		}
+		if j+1 < len(b) && b[j+1] != '\x1b' && b[j+1] != '\a' {
+			return true
+		}
+	}
+}
+
+// replayRange returns the indexes of the first and last records to replay
+// for ReplayOptions.Start and End.
+func replayRange(records []WriteRecord, start, end int) (first, last int, err error) {
+	first, last = 0, len(records)-1
+	if start > 0 {
+		if first = seekRecord(records, start); first < 0 {
+			return 0, 0, fmt.Errorf("no write #%d or later in the log (last is #%d)", start, records[last].Seq)
+		}
+	}
+	if end > 0 {
+		if end < start {
+			return 0, 0, fmt.Errorf("end write #%d is before start write #%d", end, start)
+		}
+		for last > first && records[last].Seq > end {
+			last--
+		}
+	}
+	return first, last, nil
+}
+
+// seekRecord returns the index of the record numbered seq, or of the first
+// one after it if it is missing, as when --lenient dropped it; -1 if there
+// is none.
+func seekRecord(records []WriteRecord, seq int) int {
+	for i, rec := range records {
+		if rec.Seq >= seq {
+			return i
+		}
+	}
+	return -1
+}
+
+// recordDelay is how long after prev osc8wrap received next: zero if
+// either has no Time, or if the clock went backwards between them.
+func recordDelay(prev, next WriteRecord) time.Duration {
+	if prev.Time.IsZero() || next.Time.IsZero() {
+		return 0
+	}
+	return max(next.Time.Sub(prev.Time), 0)
+}
+
+// step is what the user asked for at a pause: the next write, or with seek
+// set the write numbered seq. err ends the replay.
+type step struct {
+	seek bool
+	seq  int
+	err  error
+}
+
+// readSteps sends each step read by waitForNextStep on steps until one
+// fails or done is closed.
+func readSteps(reader *bufio.Reader, echo io.Writer, steps chan<- step, done <-chan struct{}) {
+	for {
+		st := waitForNextStep(reader, echo)
+		select {
+		case steps <- st:
+		case <-done:
+			return
+		}
+		if st.err != nil {
+			return
+		}
+	}
+}
+
 func parseWriteHeader(line string) (int, error) {
 	matches := writeHeaderPattern.FindStringSubmatch(line)
 	if len(matches) != 2 {
@@ -212,32 +507,98 @@ func emitRecord(w io.Writer, rec WriteRecord, mode StreamMode) error {
 	case StreamInput:
 		_, err := w.Write(rec.Input)
 		return err
+	case StreamDiff:
+		return emitDiff(w, rec)
 	default:
 		_, err := w.Write(rec.Output)
 		return err
 	}
 }
 
-func waitForNextStep(reader *bufio.Reader) error {
+// emitDiff writes the input and output of rec one above the other, quoted
+// so that escape sequences show as text, with a caret under the first byte
+// of output that differs from the input. Lines end in "\r\n" because the
+// terminal is in raw mode, where "\n" alone does not return the carriage.
+func emitDiff(w io.Writer, rec WriteRecord) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "=== Write #%d ===\r\n", rec.Seq)
+	fmt.Fprintf(&b, "in:  %q\r\n", rec.Input)
+	if bytes.Equal(rec.Input, rec.Output) {
+		b.WriteString("out: (unchanged)\r\n")
+	} else {
+		fmt.Fprintf(&b, "out: %q\r\n", rec.Output)
+		fmt.Fprintf(&b, "     %s^\r\n", strings.Repeat(" ", diffColumn(rec.Input, rec.Output)))
+	}
+	b.WriteString("\r\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// diffColumn returns where the first difference between a and b is in
+// their quoted forms, which are the same up to there. The common prefix is
+// cut at a rune boundary so that it quotes the way it does in full.
+func diffColumn(a, b []byte) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	for n > 0 && (n < len(a) && !utf8.RuneStart(a[n]) || n < len(b) && !utf8.RuneStart(b[n])) {
+		n--
+	}
+	return len(strconv.Quote(string(a[:n]))) - 1
+}
+
+// waitForNextStep reads keys up to Enter, or Ctrl-C. A ":" followed by
+// digits before the Enter asks to jump to that write; it is echoed to echo
+// as it is typed, and any other key abandons it.
+func waitForNextStep(reader *bufio.Reader, echo io.Writer) step {
+	var cmd []byte // the ":N" being typed, nil if none
+	cancel := func() {
+		if cmd != nil {
+			_, _ = io.WriteString(echo, "\r\x1b[K")
+			cmd = nil
+		}
+	}
 	for {
 		b, err := reader.ReadByte()
 		if err != nil {
-			return err
+			return step{err: err}
 		}
 
-		switch b {
-		case '\n', '\r':
-			return nil
-		case 0x03:
-			return errInterrupted
-		case 0x1b:
+		switch {
+		case b == '\n' || b == '\r':
+			if len(cmd) > 1 {
+				_, _ = io.WriteString(echo, "\r\n")
+				seq, err := strconv.Atoi(string(cmd[1:]))
+				if err != nil {
+					return step{err: fmt.Errorf("invalid write number %s", cmd[1:])}
+				}
+				return step{seek: true, seq: seq}
+			}
+			cancel()
+			return step{}
+		case b == 0x03:
+			return step{err: errInterrupted}
+		case b == ':' && cmd == nil:
+			cmd = []byte{':'}
+			_, _ = io.WriteString(echo, ":")
+		case cmd != nil && '0' <= b && b <= '9':
+			cmd = append(cmd, b)
+			_, _ = echo.Write([]byte{b})
+		case cmd != nil && (b == 0x7f || b == 0x08) && len(cmd) > 1:
+			cmd = cmd[:len(cmd)-1]
+			_, _ = io.WriteString(echo, "\b \b")
+		case b == 0x1b:
+			cancel()
 			interrupted, err := parseEscapedInterrupt(reader)
 			if err != nil {
-				return err
+				return step{err: err}
 			}
 			if interrupted {
-				return errInterrupted
+				return step{err: errInterrupted}
 			}
+		default:
+			cancel()
 		}
 	}
 }
@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -35,18 +37,71 @@ Output: "bar\n"
 	}
 }
 
+func TestParseDebugLogTimes(t *testing.T) {
+	// Write #2 is from a log written before Time lines existed.
+	input := `=== Write #1 (1 bytes) ===
+Time:   2026-02-14T11:08:57.123456789+09:00
+Input:  "a"
+Output: "a"
+
+=== Write #2 (1 bytes) ===
+Input:  "b"
+Output: "b"
+`
+
+	records, err := ParseDebugLog(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseDebugLog() error = %v", err)
+	}
+
+	want := time.Date(2026, 2, 14, 2, 8, 57, 123456789, time.UTC)
+	if !records[0].Time.Equal(want) {
+		t.Errorf("records[0].Time = %v, want %v", records[0].Time, want)
+	}
+	if !records[1].Time.IsZero() {
+		t.Errorf("records[1].Time = %v, want zero", records[1].Time)
+	}
+}
+
 func TestParseDebugLogErrors(t *testing.T) {
 	tests := []struct {
-		name    string
-		input   string
-		wantErr string
+		name     string
+		input    string
+		wantErr  string
+		wantKind ParseErrorKind
+		wantLine int
 	}{
 		{
 			name: "incomplete block",
 			input: `=== Write #1 (1 bytes) ===
 Input:  "a"
 `,
-			wantErr: "incomplete write block",
+			wantErr:  "incomplete write block starting at line 1",
+			wantKind: ParseErrorIncompleteBlock,
+			wantLine: 1,
+		},
+		{
+			name: "incomplete block before next header",
+			input: `=== Write #1 (1 bytes) ===
+Input:  "a"
+Output: "a"
+
+=== Write #2 (1 bytes) ===
+Output: "b"
+
+=== Write #3 (1 bytes) ===
+`,
+			wantErr:  "incomplete write block starting at line 5",
+			wantKind: ParseErrorIncompleteBlock,
+			wantLine: 5,
+		},
+		{
+			name: "invalid header",
+			input: `=== Write #x (1 bytes) ===
+`,
+			wantErr:  "line 1: invalid write header",
+			wantKind: ParseErrorInvalidHeader,
+			wantLine: 1,
 		},
 		{
 			name: "invalid quoted payload",
@@ -54,19 +109,63 @@ Input:  "a"
 Input:  "a"
 Output: "\xZZ"
 `,
-			wantErr: "invalid quoted payload",
+			wantErr:  "line 3: invalid quoted payload",
+			wantKind: ParseErrorInvalidPayload,
+			wantLine: 3,
+		},
+		{
+			name: "duplicate input",
+			input: `=== Write #1 (1 bytes) ===
+Input:  "a"
+Input:  "b"
+`,
+			wantErr:  "line 3: duplicate Input line for write #1",
+			wantKind: ParseErrorDuplicateField,
+			wantLine: 3,
+		},
+		{
+			name: "invalid time",
+			input: `=== Write #1 (1 bytes) ===
+Time:   yesterday
+`,
+			wantErr:  "line 2: invalid time for write #1",
+			wantKind: ParseErrorInvalidTime,
+			wantLine: 2,
+		},
+		{
+			name: "duplicate time",
+			input: `=== Write #1 (1 bytes) ===
+Time:   2026-02-14T11:08:57Z
+Time:   2026-02-14T11:08:58Z
+`,
+			wantErr:  "line 3: duplicate Time line for write #1",
+			wantKind: ParseErrorDuplicateField,
+			wantLine: 3,
+		},
+		{
+			name: "unexpected line inside block",
+			input: `=== Write #1 (1 bytes) ===
+Bogus: "a"
+`,
+			wantErr:  "line 2: unexpected line inside write block",
+			wantKind: ParseErrorUnexpectedContent,
+			wantLine: 2,
 		},
 		{
 			name: "unexpected content outside block",
 			input: `hello
 `,
-			wantErr: "outside write block",
+			wantErr:  "line 1: unexpected content outside write block",
+			wantKind: ParseErrorUnexpectedContent,
+			wantLine: 1,
 		},
 		{
 			name: "no blocks",
 			input: `
 `,
-			wantErr: "no write blocks found",
+			wantErr:  "no write blocks found",
+			wantKind: ParseErrorNoBlocks,
+			wantLine: 0,
 		},
 	}
 
@@ -79,10 +178,206 @@ Output: "\xZZ"
 			if !strings.Contains(err.Error(), tc.wantErr) {
 				t.Fatalf("ParseDebugLog() error = %q, want containing %q", err.Error(), tc.wantErr)
 			}
+
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("ParseDebugLog() error = %T, want *ParseError", err)
+			}
+			if perr.Kind != tc.wantKind {
+				t.Errorf("ParseError.Kind = %v, want %v", perr.Kind, tc.wantKind)
+			}
+			if perr.Line != tc.wantLine {
+				t.Errorf("ParseError.Line = %d, want %d", perr.Line, tc.wantLine)
+			}
+		})
+	}
+}
+
+func TestParseDebugLogStrict(t *testing.T) {
+	block := func(seq int) string {
+		return fmt.Sprintf("=== Write #%d (1 bytes) ===\nInput:  \"a\"\nOutput: \"a\"\n\n", seq)
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		opts     ParseOptions
+		wantSeqs []int
+		wantErr  string
+		wantLine int
+	}{
+		{
+			name:     "contiguous",
+			input:    block(3) + block(4) + block(5),
+			opts:     ParseOptions{Strict: true},
+			wantSeqs: []int{3, 4, 5},
+		},
+		{
+			name:     "gap",
+			input:    block(1) + block(2) + block(5),
+			opts:     ParseOptions{Strict: true},
+			wantErr:  "line 9: write #5 follows write #2",
+			wantLine: 9,
+		},
+		{
+			name:     "two logs run together",
+			input:    block(1) + block(2) + block(1),
+			opts:     ParseOptions{Strict: true},
+			wantErr:  "line 9: write #1 follows write #2",
+			wantLine: 9,
+		},
+		{
+			name:     "gap without strict",
+			input:    block(1) + block(5),
+			wantSeqs: []int{1, 5},
+		},
+		{
+			name:     "strict and lenient",
+			input:    block(1) + block(2) + "=== Write #3 (1 bytes) ===\nInput:  \"a\"\n",
+			opts:     ParseOptions{Strict: true, Lenient: true},
+			wantSeqs: []int{1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, _, err := ParseDebugLogWithOptions(strings.NewReader(tt.input), tt.opts)
+			if tt.wantErr != "" {
+				var perr *ParseError
+				if !errors.As(err, &perr) || perr.Kind != ParseErrorNonContiguous {
+					t.Fatalf("ParseDebugLogWithOptions() error = %v, want a non-contiguous ParseError", err)
+				}
+				if err.Error() != tt.wantErr {
+					t.Errorf("ParseDebugLogWithOptions() error = %q, want %q", err.Error(), tt.wantErr)
+				}
+				if perr.Line != tt.wantLine {
+					t.Errorf("ParseError.Line = %d, want %d", perr.Line, tt.wantLine)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseDebugLogWithOptions() error = %v", err)
+			}
+			var seqs []int
+			for _, rec := range records {
+				seqs = append(seqs, rec.Seq)
+			}
+			if diff := cmp.Diff(tt.wantSeqs, seqs); diff != "" {
+				t.Errorf("Seqs mismatch (-want +got):\n%s", diff)
+			}
 		})
 	}
 }
 
+func TestParseDebugLogVersion(t *testing.T) {
+	const block = "=== Write #1 (1 bytes) ===\nInput:  \"a\"\nOutput: \"a\"\n\n"
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{
+			name:  "v1 header",
+			input: "# osc8wrap-debug v1\n" + block,
+		},
+		{
+			name:  "no header",
+			input: block,
+		},
+		{
+			name:    "newer version",
+			input:   "# osc8wrap-debug v2\n" + block,
+			wantErr: "line 1: log format v2 is newer than this osc8wrap-replay reads (up to v1); update it",
+		},
+		{
+			name:    "malformed header",
+			input:   "# osc8wrap-debug vx\n" + block,
+			wantErr: `line 1: invalid format header "# osc8wrap-debug vx"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := ParseDebugLog(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				var perr *ParseError
+				if !errors.As(err, &perr) || perr.Kind != ParseErrorUnsupportedVersion {
+					t.Fatalf("ParseDebugLog() error = %v, want an unsupported version ParseError", err)
+				}
+				if err.Error() != tt.wantErr {
+					t.Errorf("ParseDebugLog() error = %q, want %q", err.Error(), tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseDebugLog() error = %v", err)
+			}
+			if len(records) != 1 || records[0].Seq != 1 {
+				t.Errorf("ParseDebugLog() = %+v, want write #1", records)
+			}
+		})
+	}
+}
+
+func TestParseDebugLogLenient(t *testing.T) {
+	truncated := `=== Write #1 (3 bytes) ===
+Input:  "foo"
+Output: "bar"
+
+=== Write #2 (3 bytes) ===
+Input:  "baz"
+`
+
+	t.Run("strict mode fails", func(t *testing.T) {
+		_, err := ParseDebugLog(strings.NewReader(truncated))
+		var perr *ParseError
+		if !errors.As(err, &perr) || perr.Kind != ParseErrorIncompleteBlock {
+			t.Fatalf("ParseDebugLog() error = %v, want incomplete block", err)
+		}
+	})
+
+	t.Run("lenient mode drops trailing block", func(t *testing.T) {
+		records, dropped, err := ParseDebugLogLenient(strings.NewReader(truncated))
+		if err != nil {
+			t.Fatalf("ParseDebugLogLenient() error = %v", err)
+		}
+		want := []WriteRecord{
+			{Seq: 1, Input: []byte("foo"), Output: []byte("bar")},
+		}
+		if diff := cmp.Diff(want, records); diff != "" {
+			t.Fatalf("ParseDebugLogLenient() mismatch (-want +got):\n%s", diff)
+		}
+		if dropped == nil || dropped.Line != 5 {
+			t.Fatalf("ParseDebugLogLenient() dropped = %v, want block at line 5", dropped)
+		}
+	})
+
+	t.Run("lenient mode still rejects incomplete block in the middle", func(t *testing.T) {
+		input := truncated + `
+=== Write #3 (3 bytes) ===
+Input:  "qux"
+Output: "qux"
+`
+		_, _, err := ParseDebugLogLenient(strings.NewReader(input))
+		var perr *ParseError
+		if !errors.As(err, &perr) || perr.Kind != ParseErrorIncompleteBlock {
+			t.Fatalf("ParseDebugLogLenient() error = %v, want incomplete block", err)
+		}
+	})
+
+	t.Run("lenient mode with only a truncated block has no records", func(t *testing.T) {
+		input := `=== Write #1 (3 bytes) ===
+Input:  "foo"
+`
+		_, _, err := ParseDebugLogLenient(strings.NewReader(input))
+		var perr *ParseError
+		if !errors.As(err, &perr) || perr.Kind != ParseErrorNoBlocks {
+			t.Fatalf("ParseDebugLogLenient() error = %v, want no blocks", err)
+		}
+	})
+}
+
 func TestReplayWrites(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -116,6 +411,26 @@ func TestReplayWrites(t *testing.T) {
 			},
 			wantOut: "in1in2",
 		},
+		{
+			name: "diff mode shows input and output quoted",
+			records: []WriteRecord{
+				{Seq: 1, Input: []byte("a.go\r\n"), Output: []byte("\x1b]8;;file:///a.go\x1b\\a.go\x1b]8;;\x1b\\\r\n")},
+				{Seq: 2, Input: []byte("\x1b[0m"), Output: []byte("\x1b[0m")},
+			},
+			stepInput: "\n",
+			opts: ReplayOptions{
+				Mode: StreamDiff,
+			},
+			wantOut: "=== Write #1 ===\r\n" +
+				`in:  "a.go\r\n"` + "\r\n" +
+				`out: "\x1b]8;;file:///a.go\x1b\\a.go\x1b]8;;\x1b\\\r\n"` + "\r\n" +
+				"      ^\r\n" +
+				"\r\n" +
+				"=== Write #2 ===\r\n" +
+				`in:  "\x1b[0m"` + "\r\n" +
+				"out: (unchanged)\r\n" +
+				"\r\n",
+		},
 		{
 			name: "stops on EOF before next step",
 			records: []WriteRecord{
@@ -211,3 +526,300 @@ func TestReplayWritesContextCancellation(t *testing.T) {
 		t.Fatalf("ReplayWrites() output mismatch (-want +got):\n%s", diff)
 	}
 }
+
+func TestReplayWritesAuto(t *testing.T) {
+	records := []WriteRecord{
+		{Seq: 1, Output: []byte("one")},
+		{Seq: 2, Output: []byte("two")},
+		{Seq: 3, Output: []byte("three")},
+	}
+	never := make(chan time.Time)
+
+	tests := []struct {
+		name      string
+		stepInput string
+		fires     bool
+		wantOut   string
+		wantWaits int
+		wantErr   error
+	}{
+		{
+			name:      "timer advances without step input",
+			fires:     true,
+			wantOut:   "onetwothree",
+			wantWaits: 2,
+		},
+		{
+			name:      "enter skips the wait",
+			stepInput: "\n\n",
+			wantOut:   "onetwothree",
+			wantWaits: 2,
+		},
+		{
+			name:      "ctrl-c interrupts",
+			stepInput: "\x03",
+			wantOut:   "one",
+			wantWaits: 1,
+			wantErr:   errInterrupted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var waits []time.Duration
+			after := func(d time.Duration) <-chan time.Time {
+				waits = append(waits, d)
+				if !tt.fires {
+					return never
+				}
+				ch := make(chan time.Time, 1)
+				ch <- time.Time{}
+				return ch
+			}
+
+			var out bytes.Buffer
+			err := ReplayWrites(context.Background(), records, strings.NewReader(tt.stepInput), &out, ReplayOptions{
+				Mode:     StreamOutput,
+				Interval: 100 * time.Millisecond,
+				After:    after,
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ReplayWrites() error = %v, want %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.wantOut, out.String()); diff != "" {
+				t.Errorf("ReplayWrites() output mismatch (-want +got):\n%s", diff)
+			}
+			if len(waits) != tt.wantWaits {
+				t.Errorf("waited %d times, want %d", len(waits), tt.wantWaits)
+			}
+			for _, d := range waits {
+				if d != 100*time.Millisecond {
+					t.Errorf("waited %v, want 100ms", d)
+				}
+			}
+		})
+	}
+}
+
+func TestReplayWritesRealtime(t *testing.T) {
+	start := time.Date(2026, 2, 14, 11, 8, 57, 0, time.UTC)
+	records := []WriteRecord{
+		{Seq: 1, Time: start, Output: []byte("one")},
+		{Seq: 2, Time: start.Add(250 * time.Millisecond), Output: []byte("two")},
+		{Seq: 3, Time: start.Add(200 * time.Millisecond), Output: []byte("three")},
+		{Seq: 4, Output: []byte("four")},
+	}
+
+	var waits []time.Duration
+	after := func(d time.Duration) <-chan time.Time {
+		waits = append(waits, d)
+		ch := make(chan time.Time, 1)
+		ch <- time.Time{}
+		return ch
+	}
+
+	var out bytes.Buffer
+	err := ReplayWrites(context.Background(), records, strings.NewReader(""), &out, ReplayOptions{
+		Mode:     StreamOutput,
+		Realtime: true,
+		Interval: time.Hour, // overridden by Realtime
+		After:    after,
+	})
+	if err != nil {
+		t.Fatalf("ReplayWrites() error = %v", err)
+	}
+	if diff := cmp.Diff("onetwothreefour", out.String()); diff != "" {
+		t.Errorf("ReplayWrites() output mismatch (-want +got):\n%s", diff)
+	}
+	// The clock going backwards and a record without a Time both mean no
+	// pause.
+	if diff := cmp.Diff([]time.Duration{250 * time.Millisecond, 0, 0}, waits); diff != "" {
+		t.Errorf("waits mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDiffColumn(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want int
+	}{
+		{name: "differ at start", a: "abc", b: "xbc", want: 1},
+		{name: "escape before difference", a: "\x1b[0ma", b: "\x1b[0mb", want: 8},
+		{name: "prefix", a: "ab", b: "abc", want: 3},
+		{name: "inside a multibyte rune", a: "é", b: "\xc3\xa8", want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffColumn([]byte(tt.a), []byte(tt.b)); got != tt.want {
+				t.Errorf("diffColumn(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplayWritesSeek(t *testing.T) {
+	// Write #3 is missing, as if --lenient had dropped it.
+	records := []WriteRecord{
+		{Seq: 1, Output: []byte("1")},
+		{Seq: 2, Output: []byte("2")},
+		{Seq: 4, Output: []byte("4")},
+		{Seq: 5, Output: []byte("5")},
+	}
+
+	tests := []struct {
+		name      string
+		stepInput string
+		start     int
+		end       int
+		wantOut   string
+		wantEcho  string
+		wantErr   string
+	}{
+		{
+			name:      "start and end",
+			stepInput: "\n\n\n",
+			start:     2,
+			end:       4,
+			wantOut:   "24",
+		},
+		{
+			name:      "start at a missing write",
+			stepInput: "\n",
+			start:     3,
+			wantOut:   "45",
+		},
+		{
+			name:    "start past the last write",
+			start:   6,
+			wantErr: "no write #6 or later in the log (last is #5)",
+		},
+		{
+			name:    "end before start",
+			start:   4,
+			end:     2,
+			wantErr: "end write #2 is before start write #4",
+		},
+		{
+			name:      "jump forward",
+			stepInput: ":4\n\n",
+			wantOut:   "145",
+			wantEcho:  ":4\r\n",
+		},
+		{
+			name:      "jump back",
+			stepInput: "\n:1\n\n",
+			wantOut:   "1212",
+			wantEcho:  ":1\r\n",
+		},
+		{
+			name:      "jump past end is refused",
+			stepInput: ":5\n\n",
+			end:       4,
+			wantOut:   "12",
+			wantEcho:  ":5\r\nno write #5 to jump to\r\n",
+		},
+		{
+			name:      "backspace",
+			stepInput: ":54\x7f\n",
+			wantOut:   "15",
+			wantEcho:  ":54\b \b\r\n",
+		},
+		{
+			name:      "other key abandons the jump",
+			stepInput: ":5x\n",
+			wantOut:   "12",
+			wantEcho:  ":5\r\x1b[K",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out, echo bytes.Buffer
+			err := ReplayWrites(context.Background(), records, strings.NewReader(tt.stepInput), &out, ReplayOptions{
+				Start: tt.start,
+				End:   tt.end,
+				Echo:  &echo,
+			})
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("ReplayWrites() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReplayWrites() error = %v", err)
+			}
+			if diff := cmp.Diff(tt.wantOut, out.String()); diff != "" {
+				t.Errorf("ReplayWrites() output mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantEcho, echo.String()); diff != "" {
+				t.Errorf("echo mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteAll(t *testing.T) {
+	records := []WriteRecord{
+		{Seq: 1, Input: []byte("a"), Output: []byte("A")},
+		{Seq: 2, Input: []byte("b"), Output: []byte("B")},
+		{Seq: 3, Input: []byte("c"), Output: []byte("C")},
+	}
+
+	tests := []struct {
+		name    string
+		opts    ReplayOptions
+		wantOut string
+	}{
+		{name: "output", wantOut: "ABC"},
+		{name: "input", opts: ReplayOptions{Mode: StreamInput}, wantOut: "abc"},
+		{name: "start and end", opts: ReplayOptions{Start: 2, End: 2}, wantOut: "B"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := WriteAll(&out, records, tt.opts); err != nil {
+				t.Fatalf("WriteAll() error = %v", err)
+			}
+			if diff := cmp.Diff(tt.wantOut, out.String()); diff != "" {
+				t.Errorf("WriteAll() output mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestOnlyLinks(t *testing.T) {
+	records := []WriteRecord{
+		{Seq: 1, Output: []byte("plain\r\n")},
+		{Seq: 2, Output: []byte("\x1b]8;;file:///a.go\x1b\\a.go\x1b]8;;\x1b\\\r\n")},
+		{Seq: 3, Output: []byte("\x1b]8;;\x1b\\ closing only\r\n")},
+		{Seq: 4, Output: []byte("\x1b]8;id=1;vscode://file/b.go\ab.go\x1b]8;;\a\r\n")},
+	}
+	want := "\x1b]8;;file:///a.go\x1b\\a.go\x1b]8;;\x1b\\\r\n" +
+		"\x1b]8;id=1;vscode://file/b.go\ab.go\x1b]8;;\a\r\n"
+
+	var out bytes.Buffer
+	if err := WriteAll(&out, records, ReplayOptions{OnlyLinks: true}); err != nil {
+		t.Fatalf("WriteAll() error = %v", err)
+	}
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Errorf("WriteAll() output mismatch (-want +got):\n%s", diff)
+	}
+
+	out.Reset()
+	err := ReplayWrites(context.Background(), records, strings.NewReader("\n"), &out, ReplayOptions{OnlyLinks: true})
+	if err != nil {
+		t.Fatalf("ReplayWrites() error = %v", err)
+	}
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Errorf("ReplayWrites() output mismatch (-want +got):\n%s", diff)
+	}
+
+	err = WriteAll(&out, records[:1], ReplayOptions{OnlyLinks: true})
+	if err == nil || err.Error() != "no write in the log opens a link" {
+		t.Errorf("WriteAll() without links: error = %v", err)
+	}
+}
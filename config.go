@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+)
+
+// configDefaults are the values NewLinker substitutes for zero fields, shown
+// in their place so the output reflects what the linker will actually do.
+var configDefaults = map[string]string{
+	"Scheme":       "file",
+	"Terminator":   "st",
+	"IndexWorkers": "1",
+}
+
+// writeConfig prints every LinkerOptions field resolved from flags and the
+// environment, one per line, for --print-config. Output, Environ and
+// PostProcess are runtime plumbing rather than configuration and are left
+// out.
+func writeConfig(w io.Writer, opts LinkerOptions) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	v := reflect.ValueOf(opts)
+	for i := range v.NumField() {
+		name := v.Type().Field(i).Name
+		switch name {
+		case "Output", "Environ", "PostProcess":
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", name, formatConfigValue(name, v.Field(i)))
+	}
+	return tw.Flush()
+}
+
+func formatConfigValue(name string, v reflect.Value) string {
+	if def, ok := configDefaults[name]; ok && v.IsZero() {
+		return def
+	}
+	if name == "SymbolTrigger" {
+		return formatStyleTrigger(uint16(v.Uint()))
+	}
+	if name == "DisableMatchers" {
+		return formatMatchers(uint8(v.Uint()))
+	}
+	switch x := v.Interface().(type) {
+	case string:
+		if strings.ContainsFunc(x, func(r rune) bool { return !unicode.IsGraphic(r) }) {
+			return fmt.Sprintf("%+q", x) // e.g. an invisible LinkMarker
+		}
+		if x == "" {
+			return `""`
+		}
+		return x
+	case []string:
+		if len(x) == 0 {
+			return "(none)"
+		}
+		return strings.Join(x, ",")
+	case time.Duration:
+		return x.String()
+	default:
+		return fmt.Sprint(x)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mash/osc8wrap/ansitoken"
+)
+
+func TestWriteConfig(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeConfig(&buf, LinkerOptions{
+		Output:        &buf,
+		Scheme:        "cursor",
+		Domains:       []string{"github.com", "gitlab.com"},
+		SymbolLinks:   true,
+		IdleFlush:     50 * time.Millisecond,
+		LinkMarker:    "\u200b",
+		SymbolTrigger: ansitoken.TriggerFg | ansitoken.AttrBold,
+		Environ:       []string{"TERM=xterm"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+
+	for _, want := range []string{
+		"Scheme           cursor\n",
+		"Domains          github.com,gitlab.com\n",
+		"SymbolLinks      true\n",
+		"IdleFlush        50ms\n",
+		"LinkMarker       \"\\u200b\"\n",
+		"SymbolTrigger    bold,fg\n",
+		"Terminator       st\n",
+		"IndexWorkers     1\n",
+		"ExcludeDirs      (none)\n",
+		"ExtractDir       \"\"\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("writeConfig() output missing %q:\n%s", want, got)
+		}
+	}
+	for _, skipped := range []string{"Output", "Environ", "PostProcess"} {
+		if strings.Contains(got, skipped) {
+			t.Errorf("writeConfig() output contains %s:\n%s", skipped, got)
+		}
+	}
+}
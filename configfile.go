@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// defaultConfigPath is where the config file is looked for when --config
+// and OSC8WRAP_CONFIG are not given: $XDG_CONFIG_HOME/osc8wrap/config.toml,
+// falling back to ~/.config.
+func defaultConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "osc8wrap", "config.toml")
+}
+
+// configKeys maps config file keys to LinkerOptions fields: each field name
+// in snake_case, e.g. ExcludeDirs is exclude_dirs. Fields that are filled
+// in at runtime rather than configured, and the --cat mode, have no key.
+var configKeys = func() map[string]string {
+	keys := make(map[string]string)
+	t := reflect.TypeFor[LinkerOptions]()
+	for i := range t.NumField() {
+		switch name := t.Field(i).Name; name {
+		case "Output", "Cwd", "Environ", "PostProcess", "Cat":
+		default:
+			keys[snakeCase(name)] = name
+		}
+	}
+	return keys
+}()
+
+// snakeCase converts a Go field name to snake_case, keeping acronyms
+// together: NoLinkCRLines becomes no_link_cr_lines.
+func snakeCase(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) &&
+			(unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// loadConfigFile reads a config file into opts and returns the keys it set.
+// The file is a small subset of TOML: top-level `key = value` lines whose
+// values are strings, booleans, integers or arrays of strings, plus
+// comments. Durations are strings such as "50ms", and symbol_trigger and
+// disable_matchers take the --symbol-trigger and --disable names as a
+// string or an array.
+func loadConfigFile(path string, opts *LinkerOptions) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck
+
+	set := make(map[string]bool)
+	v := reflect.ValueOf(opts).Elem()
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		start := lineNo
+		// Arrays may span lines until the closing bracket.
+		for !strings.HasPrefix(line, "#") && strings.HasPrefix(afterEquals(line), "[") &&
+			!arrayClosed(afterEquals(line)) && scanner.Scan() {
+			lineNo++
+			line += " " + strings.TrimSpace(scanner.Text())
+		}
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		errorf := func(format string, args ...any) error {
+			return fmt.Errorf("%s:%d: %s", path, start, fmt.Sprintf(format, args...))
+		}
+		if line[0] == '[' {
+			return nil, errorf("tables are not supported; set options at the top level")
+		}
+		key, raw, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, errorf("expected key = value")
+		}
+		key = strings.TrimSpace(key)
+		field, ok := configKeys[key]
+		if !ok {
+			return nil, errorf("unknown key %q", key)
+		}
+		value, err := parseConfigValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, errorf("%s: %v", key, err)
+		}
+		if err := setConfigField(v.FieldByName(field), field, value); err != nil {
+			return nil, errorf("%s: %v", key, err)
+		}
+		set[key] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+func afterEquals(line string) string {
+	_, raw, _ := strings.Cut(line, "=")
+	return strings.TrimSpace(raw)
+}
+
+var errUnterminatedArray = errors.New("unterminated array")
+
+// arrayClosed reports whether s, which starts with '[', holds its closing
+// bracket outside of strings.
+func arrayClosed(s string) bool {
+	_, _, err := scanConfigArray(s)
+	return !errors.Is(err, errUnterminatedArray)
+}
+
+// parseConfigValue parses a value into a string, bool, int64 or []string.
+// A comment may follow it.
+func parseConfigValue(s string) (any, error) {
+	var value any
+	var rest string
+	var err error
+	switch {
+	case s == "":
+		return nil, fmt.Errorf("missing value")
+	case s[0] == '"' || s[0] == '\'':
+		value, rest, err = scanConfigString(s)
+	case s[0] == '[':
+		value, rest, err = scanConfigArray(s)
+	default:
+		word, comment, _ := strings.Cut(s, "#")
+		word, rest = strings.TrimSpace(word), ""
+		if comment != "" {
+			rest = "#" + comment
+		}
+		switch word {
+		case "true":
+			value = true
+		case "false":
+			value = false
+		default:
+			value, err = strconv.ParseInt(strings.ReplaceAll(word, "_", ""), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q", word)
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if rest = strings.TrimSpace(rest); rest != "" && rest[0] != '#' {
+		return nil, fmt.Errorf("unexpected %q after value", rest)
+	}
+	return value, nil
+}
+
+// scanConfigString reads a "basic" or 'literal' string from the start of s
+// and returns it with the text after it.
+func scanConfigString(s string) (string, string, error) {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quote == '"':
+			i++
+		case s[i] == quote:
+			if quote == '\'' {
+				return s[1:i], s[i+1:], nil
+			}
+			str, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", "", fmt.Errorf("invalid string %s", s[:i+1])
+			}
+			return str, s[i+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string")
+}
+
+// scanConfigArray reads an array of strings from the start of s.
+func scanConfigArray(s string) ([]string, string, error) {
+	values := []string{}
+	s = strings.TrimSpace(s[1:])
+	for {
+		if s == "" {
+			return nil, "", errUnterminatedArray
+		}
+		if s[0] == ']' {
+			return values, s[1:], nil
+		}
+		if s[0] != '"' && s[0] != '\'' {
+			return nil, "", fmt.Errorf("arrays may only hold strings")
+		}
+		str, rest, err := scanConfigString(s)
+		if err != nil {
+			return nil, "", err
+		}
+		values = append(values, str)
+		s = strings.TrimSpace(rest)
+		if strings.HasPrefix(s, ",") {
+			s = strings.TrimSpace(s[1:])
+		} else if !strings.HasPrefix(s, "]") && s != "" {
+			return nil, "", fmt.Errorf("expected , or ] in array")
+		}
+	}
+}
+
+// setConfigField stores a parsed value in the LinkerOptions field name,
+// validating it the way the matching flag does.
+func setConfigField(field reflect.Value, name string, value any) error {
+	wrongType := func(want string) error {
+		return fmt.Errorf("want %s, got %v", want, value)
+	}
+	switch field.Interface().(type) {
+	case string:
+		s, ok := value.(string)
+		if !ok {
+			return wrongType("a string")
+		}
+		switch name {
+		case "LinkMarker":
+			marker, err := parseLinkMarker(s)
+			if err != nil {
+				return err
+			}
+			s = marker
+		case "RemoteMap":
+			template, err := parseRemoteMap(s)
+			if err != nil {
+				return err
+			}
+			s = template
+		case "RequireLocation":
+			if _, err := parseRequireLocation(s); err != nil {
+				return err
+			}
+		case "Size":
+			if _, err := parseSize(s); err != nil {
+				return err
+			}
+		}
+		field.SetString(s)
+	case bool:
+		b, ok := value.(bool)
+		if !ok {
+			return wrongType("true or false")
+		}
+		field.SetBool(b)
+	case []string:
+		list, ok := value.([]string)
+		if !ok {
+			return wrongType("an array of strings")
+		}
+		if name == "LinkLines" {
+			if _, err := parseLinkLines(list); err != nil {
+				return err
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+	case time.Duration:
+		s, ok := value.(string)
+		if !ok {
+			return wrongType(`a duration string such as "50ms"`)
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid duration %q", s)
+		}
+		field.SetInt(int64(d))
+	case int:
+		n, ok := value.(int64)
+		if !ok || n < 1 {
+			return wrongType("a positive integer")
+		}
+		field.SetInt(n)
+	case uint16: // SymbolTrigger
+		var names string
+		switch x := value.(type) {
+		case string:
+			names = x
+		case []string:
+			names = strings.Join(x, ",")
+		default:
+			return wrongType("style names")
+		}
+		mask, err := parseStyleTrigger(names)
+		if err != nil {
+			return err
+		}
+		field.SetUint(uint64(mask))
+	case uint8: // DisableMatchers
+		var names string
+		switch x := value.(type) {
+		case string:
+			names = x
+		case []string:
+			names = strings.Join(x, ",")
+		default:
+			return wrongType("matcher names")
+		}
+		set, err := parseMatchers(names)
+		if err != nil {
+			return err
+		}
+		field.SetUint(uint64(set))
+	default:
+		return fmt.Errorf("cannot be set from a config file")
+	}
+	return nil
+}
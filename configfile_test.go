@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/mash/osc8wrap/ansitoken"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := writeConfigFile(t, `# osc8wrap settings
+scheme = "cursor"
+domains = ["github.com", 'gitlab.internal'] # trailing comment
+exclude_dirs = [
+  "vendor",
+  "dist",
+]
+resolve_basename = false
+no_link_cr_lines = true
+idle_flush = "100ms"
+index_workers = 4
+symbol_trigger = ["fg", "bold"]
+link_marker = "U+200B"
+remote_map = "vscode"
+symbol_links = false
+disable_matchers = ["domain", "hunk"]
+`)
+
+	opts := LinkerOptions{ResolveBasename: true, Terminator: "bel"}
+	set, err := loadConfigFile(path, &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := LinkerOptions{
+		Scheme:          "cursor",
+		Domains:         []string{"github.com", "gitlab.internal"},
+		ExcludeDirs:     []string{"vendor", "dist"},
+		ResolveBasename: false,
+		NoLinkCRLines:   true,
+		IdleFlush:       100 * time.Millisecond,
+		IndexWorkers:    4,
+		SymbolTrigger:   ansitoken.TriggerFg | ansitoken.AttrBold,
+		LinkMarker:      "\u200b",
+		RemoteMap:       "vscode://vscode-remote/ssh-remote+{host}{path}{loc}",
+		DisableMatchers: matchDomain | matchHunk,
+		Terminator:      "bel", // not in the file, left alone
+	}
+	if diff := cmp.Diff(want, opts, cmpopts.IgnoreFields(LinkerOptions{}, "PostProcess")); diff != "" {
+		t.Errorf("loadConfigFile() options mismatch (-want +got):\n%s", diff)
+	}
+	if !set["symbol_links"] || set["terminator"] {
+		t.Errorf("loadConfigFile() set = %v, want symbol_links and not terminator", set)
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "unknown key", content: "schme = \"cursor\"\n", wantErr: `:1: unknown key "schme"`},
+		{name: "runtime field", content: "cwd = \"/tmp\"\n", wantErr: `unknown key "cwd"`},
+		{name: "table", content: "\n[linker]\n", wantErr: ":2: tables are not supported"},
+		{name: "missing equals", content: "scheme\n", wantErr: "expected key = value"},
+		{name: "wrong type", content: "line_buffered = \"yes\"\n", wantErr: "line_buffered: want true or false"},
+		{name: "list as string", content: "domains = \"github.com\"\n", wantErr: "domains: want an array of strings"},
+		{name: "bad duration", content: "idle_flush = \"soon\"\n", wantErr: `idle_flush: invalid duration "soon"`},
+		{name: "zero workers", content: "index_workers = 0\n", wantErr: "index_workers: want a positive integer"},
+		{name: "bad style", content: "symbol_trigger = \"colour\"\n", wantErr: `unknown style "colour"`},
+		{name: "bad mode", content: "require_location = \"some\"\n", wantErr: `require_location: unknown mode "some"`},
+		{name: "bad link line", content: "link_lines = [\"a.md\"]\n", wantErr: `link_lines: "a.md" is not NAME:LINE`},
+		{name: "bad matcher", content: "disable_matchers = \"email\"\n", wantErr: `disable_matchers: unknown matcher "email"`},
+		{name: "bad marker", content: "link_marker = \"x\"\n", wantErr: "not a zero-width character"},
+		{name: "unterminated string", content: "scheme = \"cursor\n", wantErr: "unterminated string"},
+		{name: "unterminated array", content: "domains = [\"a\",\n", wantErr: ":1: domains: unterminated array"},
+		{name: "text after value", content: "scheme = \"cursor\" zed\n", wantErr: "unexpected"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts LinkerOptions
+			_, err := loadConfigFile(writeConfigFile(t, tt.content), &opts)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("loadConfigFile() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigKeys(t *testing.T) {
+	for key, field := range map[string]string{
+		"scheme":           "Scheme",
+		"exclude_dirs":     "ExcludeDirs",
+		"no_link_cr_lines": "NoLinkCRLines",
+		"link_go_mod":      "LinkGoMod",
+		"index_workers":    "IndexWorkers",
+	} {
+		if got := configKeys[key]; got != field {
+			t.Errorf("configKeys[%q] = %q, want %q", key, got, field)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// editorPreset is what --editor selects: the URL scheme to link files with,
+// which also picks the URL format in formatFileURL and, through
+// schemeRegistry, whether symbol links are emitted.
+type editorPreset struct {
+	Scheme string
+}
+
+// editorPresets maps --editor names to their presets. Editors other than
+// VS Code, Cursor, Zed, JetBrains IDEs and TextMate register no URL handler
+// of their own; see the README for the companion handler each one needs.
+var editorPresets = map[string]editorPreset{
+	"vscode":   {Scheme: "vscode"},
+	"cursor":   {Scheme: "cursor"},
+	"zed":      {Scheme: "zed"},
+	"idea":     {Scheme: "idea"},
+	"sublime":  {Scheme: "subl"},
+	"textmate": {Scheme: "txmt"},
+	"emacs":    {Scheme: "emacs"},
+	"nvim":     {Scheme: "nvim"},
+	"helix":    {Scheme: "file"}, // no URL handler exists; leave opening to the terminal
+}
+
+// parseEditor looks up an --editor value.
+func parseEditor(name string) (editorPreset, error) {
+	preset, ok := editorPresets[name]
+	if !ok {
+		names := make([]string, 0, len(editorPresets))
+		for n := range editorPresets {
+			names = append(names, n)
+		}
+		slices.Sort(names)
+		return editorPreset{}, fmt.Errorf("unknown editor %q (want one of %s)", name, strings.Join(names, ", "))
+	}
+	return preset, nil
+}
+
+// schemeInfo records what the editor behind a URL scheme can do.
+type schemeInfo struct {
+	supportsSymbolOpener bool // the editor runs the symbol-opener extension
+}
+
+// schemeRegistry lists the schemes known to open symbol links. Any scheme
+// missing here, including the JetBrains and open?url= schemes that
+// formatFileURL knows, gets no symbol links unless they are forced.
+var schemeRegistry = map[string]schemeInfo{
+	"vscode":          {supportsSymbolOpener: true},
+	"vscode-insiders": {supportsSymbolOpener: true},
+	"vscodium":        {supportsSymbolOpener: true},
+	"cursor":          {supportsSymbolOpener: true},
+	"windsurf":        {supportsSymbolOpener: true},
+}
+
+// symbolLinksEnabled decides LinkerOptions.SymbolLinks for scheme. force
+// (--force-symbol-links) enables them for schemes not known to support the
+// symbol-opener extension, but never for file, which cannot carry them.
+func symbolLinksEnabled(scheme string, force bool) bool {
+	if scheme == "" || scheme == "file" {
+		return false
+	}
+	return force || schemeRegistry[scheme].supportsSymbolOpener
+}
+
+// remoteMapPresets are the --remote-map names for editors that open files
+// on an SSH host themselves. The host is Hostname, so --file-host can set
+// it to the SSH alias the local machine knows the remote by.
+var remoteMapPresets = map[string]string{
+	"vscode": "vscode://vscode-remote/ssh-remote+{host}{path}{loc}",
+	"cursor": "cursor://vscode-remote/ssh-remote+{host}{path}{loc}",
+}
+
+// parseRemoteMap turns a --remote-map value into a URL template: either a
+// preset name or a template using {host}, {path}, {loc} (":line:col", or
+// empty), {line} and {col}. A template must use {path}.
+func parseRemoteMap(s string) (string, error) {
+	if template, ok := remoteMapPresets[s]; ok {
+		return template, nil
+	}
+	if !strings.Contains(s, "{path}") {
+		return "", fmt.Errorf("%q is neither a preset (vscode, cursor) nor a template containing {path}", s)
+	}
+	return s, nil
+}
+
+// expandRemoteTemplate fills in a template from parseRemoteMap.
+func expandRemoteTemplate(template, host, absPath, loc string) string {
+	line, col, _ := strings.Cut(strings.TrimPrefix(loc, ":"), ":")
+	return strings.NewReplacer(
+		"{host}", host,
+		"{path}", absPath,
+		"{loc}", loc,
+		"{line}", line,
+		"{col}", col,
+	).Replace(template)
+}
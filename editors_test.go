@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseEditor(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    editorPreset
+		wantErr string
+	}{
+		{name: "vscode", want: editorPreset{Scheme: "vscode"}},
+		{name: "sublime", want: editorPreset{Scheme: "subl"}},
+		{name: "helix", want: editorPreset{Scheme: "file"}},
+		{name: "subl", wantErr: `unknown editor "subl" (want one of cursor, emacs, helix, idea, nvim, sublime, textmate, vscode, zed)`},
+		{name: "", wantErr: "unknown editor"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseEditor(tt.name)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseEditor(%q) error = %v, want containing %q", tt.name, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseEditor(%q) error = %v", tt.name, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseEditor(%q) = %+v, want %+v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSymbolLinksEnabled(t *testing.T) {
+	tests := []struct {
+		scheme string
+		force  bool
+		want   bool
+	}{
+		{scheme: "vscode", want: true},
+		{scheme: "cursor", want: true},
+		{scheme: "vscodium", want: true},
+		{scheme: "myeditor", want: false},
+		{scheme: "myeditor", force: true, want: true},
+		{scheme: "zed", want: false},
+		{scheme: "idea", want: false},
+		{scheme: "subl", want: false},
+		{scheme: "file", want: false},
+		{scheme: "file", force: true, want: false},
+		{scheme: "", force: true, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := symbolLinksEnabled(tt.scheme, tt.force); got != tt.want {
+			t.Errorf("symbolLinksEnabled(%q, %v) = %v, want %v", tt.scheme, tt.force, got, tt.want)
+		}
+	}
+}
+
+func TestParseRemoteMap(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "vscode", want: "vscode://vscode-remote/ssh-remote+{host}{path}{loc}"},
+		{input: "cursor", want: "cursor://vscode-remote/ssh-remote+{host}{path}{loc}"},
+		{input: "myeditor://ssh/{host}{path}?line={line}", want: "myeditor://ssh/{host}{path}?line={line}"},
+		{input: "zed", wantErr: true},
+		{input: "myeditor://ssh/{host}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseRemoteMap(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRemoteMap(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseRemoteMap(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// exitStatus returns the exit code of a finished process. Only Unix has
+// signal deaths to map to 128 plus the signal number.
+func exitStatus(state *os.ProcessState) int {
+	return state.ExitCode()
+}
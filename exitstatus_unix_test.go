@@ -0,0 +1,31 @@
+//go:build unix
+
+package main
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestExitStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   int
+	}{
+		{name: "success", script: "exit 0", want: 0},
+		{name: "exit code", script: "exit 3", want: 3},
+		{name: "SIGSEGV", script: "kill -SEGV $$", want: 128 + 11},
+		{name: "SIGTERM", script: "kill -TERM $$", want: 128 + 15},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command("sh", "-c", tt.script)
+			_ = cmd.Run()
+			if got := exitStatus(cmd.ProcessState); got != tt.want {
+				t.Errorf("exitStatus() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
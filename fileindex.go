@@ -1,7 +1,11 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"os/exec"
@@ -27,10 +31,18 @@ type FileIndex struct {
 	cwd         string
 	excludeSet  map[string]bool
 	ignoredDirs map[string]bool
+	noWatch     []string // globs for directories that are indexed but not watched
+	statWorkers int      // concurrent stat calls during the initial build
 	watcher     *fsnotify.Watcher
+	debugLog    io.Writer  // receives watcher events and index changes; nil disables
+	debugMu     sync.Mutex // serializes debugLog writes from the build and the watch loop
 }
 
-func NewFileIndex(cwd string, excludeDirs []string) *FileIndex {
+// NewFileIndex creates an index rooted at cwd. Directories whose basename is
+// in excludeDirs are skipped entirely; directories matching a noWatchDirs
+// glob are indexed once at startup but get no fsnotify watch, so changes
+// under them are not picked up live.
+func NewFileIndex(cwd string, excludeDirs, noWatchDirs []string) *FileIndex {
 	excludeSet := make(map[string]bool)
 	for _, d := range excludeDirs {
 		excludeSet[d] = true
@@ -40,9 +52,32 @@ func NewFileIndex(cwd string, excludeDirs []string) *FileIndex {
 		readyChan:  make(chan struct{}),
 		cwd:        cwd,
 		excludeSet: excludeSet,
+		noWatch:    noWatchDirs,
 	}
 }
 
+// SetConcurrency sets how many stat calls the initial build runs in
+// parallel. It must be called before Start; n < 1 means 1.
+func (idx *FileIndex) SetConcurrency(n int) {
+	idx.statWorkers = n
+}
+
+// SetDebugLog makes the index describe every fsnotify event, watch it adds
+// or fails to add, and file it adds or removes to w, to diagnose files
+// that are not picked up. It must be called before Start.
+func (idx *FileIndex) SetDebugLog(w io.Writer) {
+	idx.debugLog = w
+}
+
+func (idx *FileIndex) debugf(format string, args ...any) {
+	if idx.debugLog == nil {
+		return
+	}
+	idx.debugMu.Lock()
+	defer idx.debugMu.Unlock()
+	fmt.Fprintf(idx.debugLog, "osc8wrap: watch: "+format+"\n", args...)
+}
+
 func (idx *FileIndex) Start(ctx context.Context) {
 	idx.ignoredDirs = loadGitIgnoredDirs(ctx, idx.cwd)
 	idx.buildFromFilesystem(ctx)
@@ -56,6 +91,8 @@ func (idx *FileIndex) Start(ctx context.Context) {
 }
 
 func (idx *FileIndex) buildFromFilesystem(ctx context.Context) {
+	var paths []string
+	var entries []fs.DirEntry
 	_ = symwalk.WalkDir(idx.cwd, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return nil
@@ -71,19 +108,54 @@ func (idx *FileIndex) buildFromFilesystem(ctx context.Context) {
 			}
 			return nil
 		}
-		info, err := d.Info()
-		if err != nil {
-			return nil
+		paths = append(paths, path)
+		entries = append(entries, d)
+		return nil
+	})
+
+	infos := idx.statEntries(ctx, entries)
+
+	// Add in walk order so candidates with equal mtimes resolve the same
+	// way regardless of how many stat workers ran.
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for i, info := range infos {
+		if info == nil {
+			continue
 		}
-		basename := filepath.Base(path)
-		idx.mu.Lock()
+		basename := filepath.Base(paths[i])
 		idx.files[basename] = append(idx.files[basename], FileInfo{
-			path:  path,
+			path:  paths[i],
 			mtime: info.ModTime(),
 		})
-		idx.mu.Unlock()
-		return nil
-	})
+	}
+}
+
+// statEntries calls Info on every entry using up to idx.statWorkers
+// goroutines; on network filesystems the stat round trips dominate the
+// build. Entries whose Info fails are left nil.
+func (idx *FileIndex) statEntries(ctx context.Context, entries []fs.DirEntry) []fs.FileInfo {
+	infos := make([]fs.FileInfo, len(entries))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range max(idx.statWorkers, 1) {
+		wg.Go(func() {
+			for i := range next {
+				if info, err := entries[i].Info(); err == nil {
+					infos[i] = info
+				}
+			}
+		})
+	}
+	for i := range entries {
+		if ctx.Err() != nil {
+			break
+		}
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return infos
 }
 
 func (idx *FileIndex) Wait(ctx context.Context) error {
@@ -137,9 +209,62 @@ func (idx *FileIndex) Resolve(path string) string {
 	return newest.path
 }
 
+// FindGoTestFunc locates the declaration of a Go test function (e.g.
+// "TestFoo") by scanning indexed _test.go files. It returns the file path and
+// 1-based line number, or "" when the index isn't ready or nothing matches.
+// When several packages declare the same name, the most recently modified
+// file wins, as in Resolve.
+func (idx *FileIndex) FindGoTestFunc(name string) (string, int) {
+	idx.mu.RLock()
+	if !idx.ready {
+		idx.mu.RUnlock()
+		return "", 0
+	}
+	var candidates []FileInfo
+	for basename, files := range idx.files {
+		if strings.HasSuffix(basename, "_test.go") {
+			candidates = append(candidates, files...)
+		}
+	}
+	idx.mu.RUnlock()
+
+	decl := []byte("func " + name + "(")
+	var found FileInfo
+	var foundLine int
+	for _, c := range candidates {
+		if foundLine != 0 && !c.mtime.After(found.mtime) {
+			continue
+		}
+		if line := findLinePrefix(c.path, decl); line != 0 {
+			found = c
+			foundLine = line
+		}
+	}
+	return found.path, foundLine
+}
+
+// findLinePrefix returns the 1-based number of the first line in path that
+// starts with prefix, or 0.
+func findLinePrefix(path string, prefix []byte) int {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close() //nolint:errcheck
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if bytes.HasPrefix(scanner.Bytes(), prefix) {
+			return line
+		}
+	}
+	return 0
+}
+
 func (idx *FileIndex) startWatcher(ctx context.Context) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
+		idx.debugf("cannot create watcher: %v", err)
 		return
 	}
 	idx.watcher = watcher
@@ -157,14 +282,44 @@ func (idx *FileIndex) watchDirRecursive(root string) {
 		if !d.IsDir() {
 			return nil
 		}
-		if idx.isIgnoredDir(path) {
+		if idx.isIgnoredDir(path) || idx.isNoWatchDir(path) {
+			idx.debugf("not watching %s (excluded)", path)
 			return filepath.SkipDir
 		}
-		_ = idx.watcher.Add(path)
+		// Add fails with ENOSPC once fs.inotify.max_user_watches is used up.
+		if err := idx.watcher.Add(path); err != nil {
+			idx.debugf("cannot watch %s: %v", path, err)
+		} else {
+			idx.debugf("watching %s", path)
+		}
 		return nil
 	})
 }
 
+// isNoWatchDir reports whether path matches one of the no-watch globs. A
+// glob containing a slash is matched against the path relative to cwd, one
+// without against the directory's basename.
+func (idx *FileIndex) isNoWatchDir(path string) bool {
+	if len(idx.noWatch) == 0 {
+		return false
+	}
+	rel, err := filepath.Rel(idx.cwd, path)
+	if err != nil {
+		rel = path
+	}
+	base := filepath.Base(path)
+	for _, pattern := range idx.noWatch {
+		name := base
+		if strings.Contains(pattern, "/") {
+			name = rel
+		}
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
 func (idx *FileIndex) watchLoop(ctx context.Context) {
 	defer idx.watcher.Close() //nolint:errcheck
 
@@ -177,18 +332,21 @@ func (idx *FileIndex) watchLoop(ctx context.Context) {
 				return
 			}
 			idx.handleEvent(event)
-		case _, ok := <-idx.watcher.Errors:
+		case err, ok := <-idx.watcher.Errors:
 			if !ok {
 				return
 			}
+			idx.debugf("error: %v", err)
 		}
 	}
 }
 
 func (idx *FileIndex) handleEvent(event fsnotify.Event) {
 	if idx.isIgnoredDir(event.Name) {
+		idx.debugf("event %s %s (excluded)", event.Op, event.Name)
 		return
 	}
+	idx.debugf("event %s %s", event.Op, event.Name)
 
 	switch {
 	case event.Has(fsnotify.Create):
@@ -204,6 +362,7 @@ func (idx *FileIndex) handleCreate(path string) {
 	}
 	info, err := os.Stat(path)
 	if err != nil {
+		idx.debugf("cannot stat %s: %v", path, err)
 		return
 	}
 
@@ -214,6 +373,7 @@ func (idx *FileIndex) handleCreate(path string) {
 	}
 
 	idx.addFile(path, info.ModTime())
+	idx.debugf("added %s", path)
 }
 
 func (idx *FileIndex) handleRemove(path string) {
@@ -226,6 +386,7 @@ func (idx *FileIndex) handleRemove(path string) {
 	for i, f := range files {
 		if f.path == path {
 			idx.files[basename] = append(files[:i], files[i+1:]...)
+			idx.debugf("removed %s", path)
 			break
 		}
 	}
@@ -249,6 +410,7 @@ func (idx *FileIndex) indexDir(dir string) {
 		}
 
 		idx.addFile(path, info.ModTime())
+		idx.debugf("added %s", path)
 		return nil
 	})
 }
@@ -2,13 +2,18 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
-func initGitRepo(t *testing.T, dir string) {
+func initGitRepo(t testing.TB, dir string) {
 	t.Helper()
 	for _, args := range [][]string{
 		{"init"},
@@ -124,7 +129,7 @@ func TestFileIndex_GitignoreDirsExcludedFromIndex(t *testing.T) {
 	os.MkdirAll(filepath.Join(tmp, "src"), 0o755)
 	os.WriteFile(filepath.Join(tmp, "src", "main.go"), []byte("package main"), 0o644)
 
-	idx := NewFileIndex(tmp, []string{})
+	idx := NewFileIndex(tmp, []string{}, nil)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go idx.Start(ctx)
@@ -142,3 +147,178 @@ func TestFileIndex_GitignoreDirsExcludedFromIndex(t *testing.T) {
 		t.Errorf("expected app.go to not be in index, got %q", resolved)
 	}
 }
+
+func TestFileIndex_NoWatchDirs(t *testing.T) {
+	tmp := t.TempDir()
+	tmp, _ = filepath.EvalSymlinks(tmp)
+
+	os.MkdirAll(filepath.Join(tmp, "src"), 0o755)
+	os.MkdirAll(filepath.Join(tmp, "generated", "deep"), 0o755)
+	os.MkdirAll(filepath.Join(tmp, "third_party", "lib"), 0o755)
+	os.WriteFile(filepath.Join(tmp, "generated", "existing.go"), []byte("package gen"), 0o644)
+
+	idx := NewFileIndex(tmp, []string{}, []string{"generated", "third_party/*"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go idx.Start(ctx)
+	if err := idx.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// The watcher is set up right after the index becomes ready.
+	time.Sleep(50 * time.Millisecond)
+
+	// Files present at startup are still indexed.
+	if resolved := idx.Resolve("existing.go"); resolved == "" {
+		t.Error("expected existing.go in unwatched dir to be indexed at startup")
+	}
+
+	os.WriteFile(filepath.Join(tmp, "src", "live.go"), []byte("package src"), 0o644)
+	os.WriteFile(filepath.Join(tmp, "generated", "gen.go"), []byte("package gen"), 0o644)
+	os.WriteFile(filepath.Join(tmp, "generated", "deep", "deep.go"), []byte("package deep"), 0o644)
+	os.WriteFile(filepath.Join(tmp, "third_party", "lib", "lib.go"), []byte("package lib"), 0o644)
+
+	time.Sleep(100 * time.Millisecond)
+
+	if resolved := idx.Resolve("live.go"); resolved == "" {
+		t.Error("expected live.go in watched dir to be picked up")
+	}
+	for _, name := range []string{"gen.go", "deep.go", "lib.go"} {
+		if resolved := idx.Resolve(name); resolved != "" {
+			t.Errorf("expected %s in unwatched dir not to be picked up, got %q", name, resolved)
+		}
+	}
+}
+
+// syncBuffer is a strings.Builder safe to write from the watch loop while the
+// test reads it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestFileIndex_DebugLog(t *testing.T) {
+	tmp := t.TempDir()
+	tmp, _ = filepath.EvalSymlinks(tmp)
+	os.MkdirAll(filepath.Join(tmp, "src"), 0o755)
+	os.MkdirAll(filepath.Join(tmp, "vendor"), 0o755)
+
+	var log syncBuffer
+	idx := NewFileIndex(tmp, []string{"vendor"}, nil)
+	idx.SetDebugLog(&log)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go idx.Start(ctx)
+	if err := idx.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	created := filepath.Join(tmp, "src", "new.go")
+	os.WriteFile(created, []byte("package src"), 0o644)
+	time.Sleep(100 * time.Millisecond)
+
+	got := log.String()
+	for _, want := range []string{
+		"osc8wrap: watch: watching " + filepath.Join(tmp, "src") + "\n",
+		"osc8wrap: watch: not watching " + filepath.Join(tmp, "vendor") + " (excluded)\n",
+		"osc8wrap: watch: event CREATE " + created + "\n",
+		"osc8wrap: watch: added " + created + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("debug log missing %q; got:\n%s", want, got)
+		}
+	}
+}
+
+func TestFileIndex_IsNoWatchDir(t *testing.T) {
+	idx := NewFileIndex("/repo", nil, []string{"generated", "third_party/*"})
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/repo/generated", true},
+		{"/repo/a/b/generated", true},
+		{"/repo/third_party/lib", true},
+		{"/repo/third_party", false},
+		{"/repo/x/third_party/lib", false},
+		{"/repo/src", false},
+	}
+	for _, tt := range tests {
+		if got := idx.isNoWatchDir(tt.path); got != tt.want {
+			t.Errorf("isNoWatchDir(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+// writeIndexTree creates dirs x files files, with some basenames shared
+// across directories so candidate ordering matters.
+func writeIndexTree(tb testing.TB, root string, dirs, files int) {
+	tb.Helper()
+	for d := range dirs {
+		dir := filepath.Join(root, fmt.Sprintf("pkg%03d", d))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			tb.Fatal(err)
+		}
+		for f := range files {
+			name := fmt.Sprintf("file%03d.go", f)
+			if f%4 == 0 {
+				name = "shared.go"
+			}
+			if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestFileIndex_ConcurrencyIndependentResults(t *testing.T) {
+	tmp := t.TempDir()
+	tmp, _ = filepath.EvalSymlinks(tmp)
+	writeIndexTree(t, tmp, 20, 25)
+
+	build := func(workers int) map[string][]FileInfo {
+		idx := NewFileIndex(tmp, []string{}, nil)
+		idx.SetConcurrency(workers)
+		idx.buildFromFilesystem(context.Background())
+		return idx.files
+	}
+
+	want := build(1)
+	if len(want["shared.go"]) != 20 {
+		t.Fatalf("expected 20 shared.go candidates, got %d", len(want["shared.go"]))
+	}
+	for _, workers := range []int{0, 2, 8, 64} {
+		if got := build(workers); !reflect.DeepEqual(got, want) {
+			t.Errorf("index built with %d workers differs from sequential build", workers)
+		}
+	}
+}
+
+func BenchmarkFileIndex_Build(b *testing.B) {
+	tmp := b.TempDir()
+	initGitRepo(b, tmp)
+	writeIndexTree(b, tmp, 50, 100)
+
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for b.Loop() {
+				idx := NewFileIndex(tmp, []string{}, nil)
+				idx.SetConcurrency(workers)
+				idx.buildFromFilesystem(context.Background())
+			}
+		})
+	}
+}
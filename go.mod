@@ -5,10 +5,7 @@ go 1.25.5
 require (
 	github.com/creack/pty v1.1.24
 	github.com/fsnotify/fsnotify v1.9.0
+	github.com/google/go-cmp v0.7.0
+	golang.org/x/sys v0.40.0
 	golang.org/x/term v0.39.0
 )
-
-require (
-	github.com/google/go-cmp v0.7.0 // indirect
-	golang.org/x/sys v0.40.0 // indirect
-)
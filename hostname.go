@@ -0,0 +1,46 @@
+package main
+
+import "strings"
+
+// defaultFileHost picks the host name put in file:// URLs unless
+// --file-host or OSC8WRAP_FILE_HOST says otherwise: $OSC8WRAP_HOSTNAME from
+// environ (in os.Environ form), else the system host name, else $HOSTNAME,
+// else none, which gives file:///path. Sandboxes may fail to report a host
+// name or report one such as "(none)" that cannot go in a URL; such names
+// are skipped.
+func defaultFileHost(hostname func() (string, error), environ []string) string {
+	if name := lookupEnv(environ, "OSC8WRAP_HOSTNAME"); validHostname(name) {
+		return name
+	}
+	if name, err := hostname(); err == nil && validHostname(name) {
+		return name
+	}
+	if name := lookupEnv(environ, "HOSTNAME"); validHostname(name) {
+		return name
+	}
+	return ""
+}
+
+// lookupEnv returns the value of key in environ, or "" if it is not set.
+func lookupEnv(environ []string, key string) string {
+	for _, kv := range environ {
+		if value, ok := strings.CutPrefix(kv, key+"="); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// validHostname reports whether name can be the authority of a file:// URL:
+// letters, digits, '-', '_' and '.', at most 253 bytes.
+func validHostname(name string) bool {
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, c := range []byte(name) {
+		if !isWordChar(c) && c != '-' && c != '.' {
+			return false
+		}
+	}
+	return true
+}
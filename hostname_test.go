@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestDefaultFileHost(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "main.go"))
+
+	system := func(name string, err error) func() (string, error) {
+		return func() (string, error) { return name, err }
+	}
+
+	tests := []struct {
+		name     string
+		hostname func() (string, error)
+		environ  []string
+		want     string
+	}{
+		{
+			name:     "OSC8WRAP_HOSTNAME over the system name and HOSTNAME",
+			hostname: system("devbox", nil),
+			environ:  []string{"HOSTNAME=other", "OSC8WRAP_HOSTNAME=laptop"},
+			want:     "laptop",
+		},
+		{
+			name:     "OSC8WRAP_HOSTNAME when the system call fails",
+			hostname: system("", errors.New("uname failed")),
+			environ:  []string{"OSC8WRAP_HOSTNAME=laptop", "HOSTNAME=sandbox-1"},
+			want:     "laptop",
+		},
+		{
+			name:     "unusable OSC8WRAP_HOSTNAME",
+			hostname: system("devbox", nil),
+			environ:  []string{"OSC8WRAP_HOSTNAME=my host"},
+			want:     "devbox",
+		},
+		{
+			name:     "system host name",
+			hostname: system("devbox", nil),
+			environ:  []string{"HOSTNAME=other"},
+			want:     "devbox",
+		},
+		{
+			name:     "HOSTNAME when the system call fails",
+			hostname: system("", errors.New("uname failed")),
+			environ:  []string{"PATH=/bin", "HOSTNAME=sandbox-1"},
+			want:     "sandbox-1",
+		},
+		{
+			name:     "HOSTNAME when the system name is unusable",
+			hostname: system("(none)", nil),
+			environ:  []string{"HOSTNAME=sandbox-1"},
+			want:     "sandbox-1",
+		},
+		{
+			name:     "no host name at all",
+			hostname: system("", nil),
+			environ:  nil,
+			want:     "",
+		},
+		{
+			name:     "unusable HOSTNAME too",
+			hostname: system("", errors.New("uname failed")),
+			environ:  []string{"HOSTNAME=my host"},
+			want:     "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host := defaultFileHost(tt.hostname, tt.environ)
+			if host != tt.want {
+				t.Fatalf("defaultFileHost() = %q, want %q", host, tt.want)
+			}
+
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:   &buf,
+				Cwd:      tmpDir,
+				Hostname: host,
+				Domains:  []string{"github.com"},
+			})
+			assertWrite(t, linker, "main.go\n",
+				"\x1b]8;;file://"+tt.want+testFile+"\x1b\\main.go\x1b]8;;\x1b\\\n")
+		})
+	}
+}
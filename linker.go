@@ -4,12 +4,21 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"hash/fnv"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mash/osc8wrap/ansitoken"
 )
 
 type LinkerOptions struct {
@@ -20,16 +29,71 @@ type LinkerOptions struct {
 	Domains         []string
 	ResolveBasename bool
 	ExcludeDirs     []string
-	Terminator      string // "st" (default, ESC \) or "bel" (0x07)
+	NoWatchDirs     []string // globs for directories indexed at startup but not watched for changes
+	Terminator      string   // "st" (default, ESC \), "bel" (0x07), or "auto" (mirror rewritten links)
 	SymbolLinks     bool
 	DebugWrites     bool
+	DebugWritesFile string        // path for the DebugWrites log instead of a name in /tmp; implies DebugWrites
+	DebugWatch      bool          // log file index watcher events and changes to stderr, or the DebugWrites log
+	ShortenHome     bool          // display absolute paths under $HOME as ~/...
+	NoLinkCRLines   bool          // leave lines redrawn with a bare \r (progress bars) unlinked
+	LinkTestNames   bool          // link test names in `go test` result lines to their declaration
+	LinkGoMod       bool          // link module paths and versions in go.mod and `go get` output to pkg.go.dev
+	LinkGoPkgErrors bool          // link the path in Go's "open PATH: errno" errors, spaces and all
+	LinkGoRace      bool          // link stack frames in race reports and panics by their path's longest existing tail
+	JSONPaths       bool          // link JSON strings holding escaped paths, e.g. "C:\\src\\main.go" (see findJSONPath)
+	LineBuffered    bool          // hold back a trailing partial line until its newline arrives
+	IdleFlush       time.Duration // LineBuffered: emit the held line after this much silence; 0 disables
+	ExtractDir      string        // also resolve relative paths here (archive extraction target)
+	PathRoots       []string      // directories to resolve relative paths against, in order; replaces the defaults (see resolutionRoots)
+	LinkLine        bool          // extend a leading file:line link over the rest of its line
+	LinkMarker      string        // zero-width text emitted after each link (see parseLinkMarker)
+	LineSeparators  string        // characters besides ':' that may precede a line number, e.g. "@"
+	SymbolTrigger   uint16        // SGR colors/attributes that enable symbol linking (see parseStyleTrigger); 0 means any
+	IndexWorkers    int           // parallel stat calls while building the file index; 0 means 1
+	RelinkExisting  bool          // retarget existing non-file: OSC 8 links whose text is a file path
+	StripLinks      bool          // drop existing OSC 8 links and link their text like any other (see stripOSC8)
+	StripSGR        bool          // drop SGR sequences from the output; they still drive symbol linking
+	JoinStyledPaths bool          // link paths that SGR sequences split, e.g. a differently colored extension (see linkSplitPath)
+	LineTimeout     time.Duration // write a line unlinked once linking it takes longer than this; 0 disables
+	AssetScheme     string        // scheme for image, font and media files (see assetExtensions); "" means Scheme
+	RemoteMap       string        // URL template for files on this (remote) host, see parseRemoteMap; overrides Scheme
+	LinkHead        int           // link only the first N lines and pass the rest through raw; 0 links everything
+	MaxLinksTotal   int           // pass everything through raw once this many links are written; 0 means no limit
+	MaxLineLen      int           // pass the rest of a line through raw once it is longer than this many bytes; 0 means no limit
+	LinkExt         []string      // link only files with these extensions, e.g. "go"; see extensionLinked
+	NoLinkExt       []string      // never link files with these extensions; wins over LinkExt
+	RequireLocation string        // "all" or "bare": which paths need a :line to be linked (see parseRequireLocation); "" links all
+	BatHeader       bool          // link the file named in bat's "File: name" header, spaces and all
+	ResolverCmd     string        // shell command that resolves paths nothing else could, see externalResolver
+	LinkLines       []string      // "NAME:LINE" entries: the line to open NAME at when no line is printed (see parseLinkLines)
+	GroupFileLinks  bool          // give file links an OSC 8 id per file, reset at each "diff --git" line (see fileLinkID)
+	Tee             string        // file that main copies the raw, unlinked input to (see SetTee)
+	Size            string        // COLSxROWS that main gives the pty when stdin is not a terminal (see fallbackSize)
+	SeparateStderr  bool          // main gives the command a pipe for stderr and links it to os.Stderr (see runPTYMode)
+	NoPTY           bool          // main runs the command with pipes instead of a pty (see runNoPTYMode)
+	Manifest        string        // file that main has the links written to as JSON at exit (see SetManifest)
+	Cat             bool          // main links the files named as arguments instead of running a command (see runCatMode)
+	DisableMatchers uint8         // matcher categories turned off (see matcherNames)
+	DetectTerminal  bool          // pass output through unlinked if Environ suggests no OSC 8 support
+	ProbeTerminal   bool          // main asks the terminal itself before DetectTerminal guesses (see probeTerminal)
+	Environ         []string      // environment (os.Environ form) consulted by DetectTerminal
+
+	// PostProcess, if set, is called for every token the ANSI tokenizer
+	// produces and returns the bytes to use in place of tok.Data. It runs
+	// before linking, so text it returns is still scanned for links, and
+	// tok.Kind, tok.Styled etc. keep driving the linker's state.
+	PostProcess func(tok ansitoken.Token) []byte
 }
 
 type Linker struct {
 	output          io.Writer
 	cwd             string
+	roots           []string // resolutionRoots: where relative paths are looked up, in order
 	hostname        string
 	scheme          string
+	assetScheme     string
+	remoteMap       string
 	domains         []string
 	urlPattern      *regexp.Regexp
 	resolveBasename bool
@@ -38,10 +102,78 @@ type Linker struct {
 	symbolLinks     bool
 	debugFile       *os.File
 	writeSeq        int
-	tokenizer       *AnsiTokenizer
-	styled          bool   // true when inside SGR-styled text; enables symbol linking
-	inOSC8          bool   // true when inside OSC8 hyperlink; disables all processing
-	pendingWord     []byte // trailing styled token chars from previous Write, awaiting continuation
+	tokenizer       *ansitoken.Tokenizer
+	styled          bool         // true when inside SGR-styled text; enables symbol linking
+	inOSC8          bool         // true when inside OSC8 hyperlink; disables all processing
+	altScreen       bool         // true while a full-screen program uses the alternate screen; disables all processing
+	inPaste         bool         // true between the bracketed paste markers; disables all processing
+	pendingWord     []byte       // trailing styled token chars from previous Write, awaiting continuation
+	homeDir         string       // non-empty when ShortenHome is enabled
+	out             bytes.Buffer // reused across Write calls to avoid per-write allocation
+	noLinkCRLines   bool
+	crLine          bool // current line follows a bare \r, i.e. it is a progress redraw
+	pendingCR       bool // previous text ended with \r; the next byte decides CRLF vs redraw
+	linkTestNames   bool
+	linkGoMod       bool
+	linkGoPkgErrors bool
+	linkGoRace      bool
+	jsonPaths       bool
+	lineBuffered    bool
+	heldLine        []byte // LineBuffered: input after the last newline, not yet processed
+	completeLines   []byte // LineBuffered: scratch buffer for the released complete lines
+	idleFlush       time.Duration
+	idleTimer       stopper
+	idleGen         int                                 // bumped on every re-arm so a stale timer callback is a no-op
+	afterFunc       func(time.Duration, func()) stopper // time.AfterFunc, replaceable in tests
+	mu              sync.Mutex                          // serializes Write/Flush with the idle flush timer
+	extractDir      string
+	linkLine        bool
+	linkMarker      string // written after every link's closing sequence
+	lineSeparators  string // accepted before a line number in addition to ':'
+	passthrough     bool   // terminal detection decided against emitting OSC 8
+	postProcess     func(ansitoken.Token) []byte
+	relinkExisting  bool
+	joinStyledPaths bool
+	stripLinks      bool
+	stripSGR        bool
+	relinkOpen      []byte       // RelinkExisting: opening sequence of the link being held, nil if none
+	relinkBody      bytes.Buffer // RelinkExisting: tokens inside the held link, as written
+	relinkText      bytes.Buffer // RelinkExisting: text tokens inside the held link
+	relinkBEL       bool         // RelinkExisting: the held link's opening sequence ended in BEL
+	lineTimeout     time.Duration
+	lineDeadline    time.Time        // LineTimeout: when the line being processed gives up; zero if none
+	lineTimedOut    bool             // LineTimeout: the line being processed passed lineDeadline
+	now             func() time.Time // time.Now, replaceable in tests
+	manifest        *linkManifest    // SetManifest: the links written so far; nil if unset
+	linkHead        int
+	maxLinksTotal   int
+	linesSeen       int             // LinkHead: newlines processed so far
+	linksWritten    int             // MaxLinksTotal: links written so far
+	headDone        bool            // LinkHead, MaxLinksTotal: linking is over; the rest passes through raw
+	linkExt         map[string]bool // LinkExt, lowercased without the dot
+	noLinkExt       map[string]bool // NoLinkExt, lowercased without the dot
+	requireLocation string
+	diffFile        string // file named by the last "+++ b/path" diff line, which hunk headers link to
+	batHeader       bool
+	batNamePending  bool              // BatHeader: text ended with "File: ", so the next text is the file name
+	resolver        *externalResolver // ResolverCmd; nil if unset
+	linkLines       map[string]string // LinkLines: NAME to ":LINE"
+	groupFileLinks  bool
+	diffBlock       int       // GroupFileLinks: "diff --git" lines seen so far
+	tee             io.Writer // SetTee: receives every Write's input before linking; nil if unset
+	disabled        uint8     // DisableMatchers
+	maxLineLen      int
+	lineLen         int // MaxLineLen: text bytes of the current line processed so far
+}
+
+// debugLogVersion is the version of the --debug-writes log format, named
+// in the log's first line. Bump it when osc8wrap-replay needs to know about
+// a change. v1 added the Time line of each write.
+const debugLogVersion = 1
+
+// stopper is the part of *time.Timer the idle flush needs.
+type stopper interface {
+	Stop() bool
 }
 
 func NewLinker(opts LinkerOptions) *Linker {
@@ -56,26 +188,91 @@ func NewLinker(opts LinkerOptions) *Linker {
 	l := &Linker{
 		output:          opts.Output,
 		cwd:             opts.Cwd,
+		roots:           resolutionRoots(opts.Cwd, opts.PathRoots),
 		hostname:        opts.Hostname,
 		scheme:          scheme,
+		assetScheme:     opts.AssetScheme,
+		remoteMap:       opts.RemoteMap,
 		domains:         opts.Domains,
 		resolveBasename: opts.ResolveBasename,
-		index:           NewFileIndex(opts.Cwd, opts.ExcludeDirs),
+		index:           NewFileIndex(opts.Cwd, opts.ExcludeDirs, opts.NoWatchDirs),
 		terminator:      terminator,
-		symbolLinks:     opts.SymbolLinks,
-		tokenizer:       NewAnsiTokenizer(),
+		symbolLinks:     opts.SymbolLinks && opts.DisableMatchers&matchSymbol == 0,
+		tokenizer:       ansitoken.NewTokenizer(),
+		noLinkCRLines:   opts.NoLinkCRLines,
+		linkTestNames:   opts.LinkTestNames,
+		linkGoMod:       opts.LinkGoMod,
+		linkGoPkgErrors: opts.LinkGoPkgErrors,
+		linkGoRace:      opts.LinkGoRace,
+		jsonPaths:       opts.JSONPaths,
+		lineBuffered:    opts.LineBuffered,
+		idleFlush:       opts.IdleFlush,
+		linkLine:        opts.LinkLine,
+		linkMarker:      opts.LinkMarker,
+		postProcess:     opts.PostProcess,
+		relinkExisting:  opts.RelinkExisting,
+		joinStyledPaths: opts.JoinStyledPaths,
+		stripLinks:      opts.StripLinks,
+		stripSGR:        opts.StripSGR,
+		lineTimeout:     opts.LineTimeout,
+		now:             time.Now,
+		linkHead:        opts.LinkHead,
+		maxLinksTotal:   opts.MaxLinksTotal,
+		maxLineLen:      opts.MaxLineLen,
+		linkExt:         extensionSet(opts.LinkExt),
+		noLinkExt:       extensionSet(opts.NoLinkExt),
+		requireLocation: opts.RequireLocation,
+		batHeader:       opts.BatHeader,
+		groupFileLinks:  opts.GroupFileLinks,
+		disabled:        opts.DisableMatchers,
+		afterFunc: func(d time.Duration, f func()) stopper {
+			return time.AfterFunc(d, f)
+		},
 	}
+	l.lineSeparators = strings.ReplaceAll(opts.LineSeparators, ":", "")
+	l.tokenizer.SetTrigger(opts.SymbolTrigger)
+	l.index.SetConcurrency(opts.IndexWorkers)
 	l.urlPattern = l.buildPattern()
-	if opts.DebugWrites {
-		dir := filepath.Base(opts.Cwd)
-		ts := time.Now().Format("20060102-150405")
-		name := fmt.Sprintf("/tmp/osc8wrap-debug-%s-%s.log", dir, ts)
+	l.passthrough = opts.DetectTerminal && !terminalSupportsOSC8(opts.Environ)
+	if opts.ExtractDir != "" {
+		l.extractDir = opts.ExtractDir
+		if !filepath.IsAbs(l.extractDir) {
+			l.extractDir = filepath.Join(opts.Cwd, l.extractDir)
+		}
+	}
+	if opts.ShortenHome {
+		if home, err := os.UserHomeDir(); err == nil {
+			l.homeDir = home
+		}
+	}
+	if opts.DebugWrites || opts.DebugWritesFile != "" {
+		name := opts.DebugWritesFile
+		if name == "" {
+			dir := filepath.Base(opts.Cwd)
+			ts := time.Now().Format("20060102-150405")
+			name = fmt.Sprintf("/tmp/osc8wrap-debug-%s-%s.log", dir, ts)
+		}
 		f, err := os.Create(name)
+		if err != nil && opts.DebugWritesFile != "" {
+			fmt.Fprintf(os.Stderr, "osc8wrap: --debug-writes-file: %v\n", err)
+		}
 		if err == nil {
 			l.debugFile = f
+			fmt.Fprintf(f, "# osc8wrap-debug v%d\n", debugLogVersion)
 			fmt.Fprintf(os.Stderr, "osc8wrap: debug writes log: %s\n", f.Name())
 		}
 	}
+	l.linkLines, _ = parseLinkLines(opts.LinkLines) // validated when the options were read
+	if opts.ResolverCmd != "" {
+		l.resolver = newExternalResolver(opts.ResolverCmd, opts.Cwd)
+	}
+	if opts.DebugWatch {
+		var w io.Writer = os.Stderr
+		if l.debugFile != nil {
+			w = l.debugFile
+		}
+		l.index.SetDebugLog(w)
+	}
 	return l
 }
 
@@ -97,38 +294,282 @@ func (l *Linker) buildPattern() *regexp.Regexp {
 
 	// file path pattern
 	pattern += `|` +
-		`(?:^|[^/\w.%+@\x{0080}-\x{10FFFF}-]|\x1b\[[0-9;]*m)` + // boundary: start of line, non-path char, or ANSI SGR
+		`(?:(?:^|\s)-[IL]|^|[^/\w.%+@\x{0080}-\x{10FFFF}-]|\x1b\[[0-9;]*m)` + // boundary: compiler -I/-L flag (tried first, as '-' is a path char), start of line, non-path char, or ANSI SGR
 		`(` + // group 3: path
-		`(?:~|\.{0,2})/[\w./%+@\x{0080}-\x{10FFFF}-]+(?:\.\w+)?` + // starts with ~/, /, ./, or ../: extension optional
+		`(?:file://|~|\.{0,2})/[\w./%+@\x{0080}-\x{10FFFF}-]+(?:\.\w+)?` + // starts with file:///, ~/, /, ./, or ../: extension optional
 		`|` +
 		`[\w./%+@\x{0080}-\x{10FFFF}-]+\.\w+` + // no path prefix: extension required
 		`|` +
 		`\w+file` + // files ending with "file" (Makefile, Dockerfile, etc.)
 		`)` +
-		`(:\d+(?:[-:]\d+)?)?` // group 4: optional :line, :line:col, or :line-line
+		`(::\d+(?:::\d+)?|[:` + escapeClass(l.lineSeparators) + `]\d+(?:[-:]\d+)?)?` // group 4: optional ::line::col, :line, :line:col, or :line-line (never the ':' ripgrep puts before match text)
 
 	return regexp.MustCompile(pattern)
 }
 
+// copyBufferSize is larger than io.Copy's 32KB default so high-throughput
+// commands reach the Linker in fewer, bigger writes.
+const copyBufferSize = 256 * 1024
+
+// ReadFrom implements io.ReaderFrom: it links everything read from r, in
+// copyBufferSize chunks, and flushes what Write still holds once r ends,
+// whether at io.EOF or with an error. Errors other than io.EOF are
+// returned, so a caller can tell the EIO that ends a pty's output from a
+// real failure.
+func (l *Linker) ReadFrom(r io.Reader) (n int64, err error) {
+	buf := make([]byte, copyBufferSize)
+	for {
+		nr, rerr := r.Read(buf)
+		if nr > 0 {
+			if _, err := l.Write(buf[:nr]); err != nil {
+				return n, err
+			}
+			n += int64(nr)
+		}
+		if rerr != nil {
+			if err := l.Flush(); err != nil {
+				return n, err
+			}
+			if rerr == io.EOF {
+				return n, nil
+			}
+			return n, rerr
+		}
+	}
+}
+
 func (l *Linker) Write(p []byte) (n int, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.tee != nil {
+		if _, err := l.tee.Write(p); err != nil {
+			// Losing the copy must not cost the terminal its output.
+			fmt.Fprintf(os.Stderr, "osc8wrap: tee: %v\n", err)
+			l.tee = nil
+		}
+	}
+
 	l.writeSeq++
 	if l.debugFile != nil {
 		_, _ = fmt.Fprintf(l.debugFile, "=== Write #%d (%d bytes) ===\n", l.writeSeq, len(p))
+		_, _ = fmt.Fprintf(l.debugFile, "Time:   %s\n", time.Now().Format(time.RFC3339Nano))
 		_, _ = fmt.Fprintf(l.debugFile, "Input:  %q\n", p)
 	}
 
-	tokens := l.tokenizer.Feed(p)
-	var result bytes.Buffer
+	if l.passthrough || l.headDone {
+		l.logOutput(p)
+		if _, err := l.writeOutput(p); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
 
-	for _, tok := range tokens {
+	data := p
+	if l.lineBuffered && l.altScreen {
+		// Full-screen programs redraw without newlines: hold nothing back.
+		if len(l.heldLine) > 0 {
+			l.completeLines = append(append(l.completeLines[:0], l.heldLine...), p...)
+			l.heldLine = l.heldLine[:0]
+			data = l.completeLines
+		}
+	} else if l.lineBuffered {
+		data = l.takeCompleteLines(p)
+		l.resetIdleTimer()
+	}
+
+	result := &l.out
+	result.Reset()
+	head, tail := l.takeHead(data)
+	l.processChunk(result, head)
+	if l.linkHead > 0 && l.linesSeen >= l.linkHead {
+		l.finishHead(result, tail)
+	}
+	if l.maxLinksTotal > 0 && l.linksWritten >= l.maxLinksTotal && !l.headDone {
+		fmt.Fprintf(os.Stderr, "osc8wrap: wrote %d links, the --max-links-total limit; no more links from here on\n", l.linksWritten)
+		l.finishHead(result, nil)
+	}
+
+	l.logOutput(result.Bytes())
+
+	if result.Len() == 0 {
+		return len(p), nil
+	}
+	_, err = l.writeOutput(result.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// logOutput ends the debug log block of the current Write with its output.
+// Every block needs one, or osc8wrap-replay cannot read the log.
+func (l *Linker) logOutput(out []byte) {
+	if l.debugFile != nil {
+		_, _ = fmt.Fprintf(l.debugFile, "Output: %q\n\n", out)
+		_ = l.debugFile.Sync()
+	}
+}
+
+// writeOutput writes linked output, keeping track of where in it the
+// links made since the last call landed for SetManifest.
+func (l *Linker) writeOutput(b []byte) (int, error) {
+	n, err := l.output.Write(b)
+	if l.manifest != nil {
+		l.manifest.wrote(b[:n])
+	}
+	return n, err
+}
+
+// SetManifest makes Close write a JSON list of every link the Linker
+// wrote to w: its target, display text, kind and offset in the output.
+// Links in the command's own output are not listed unless RelinkExisting
+// rewrote them.
+func (l *Linker) SetManifest(w io.Writer) {
+	l.manifest = &linkManifest{w: w}
+}
+
+// SetTee makes every Write also copy its input to w as received: without
+// the links osc8wrap adds, and before any line buffering. Call it before
+// the first Write.
+func (l *Linker) SetTee(w io.Writer) {
+	l.tee = w
+}
+
+// maxHeldLine bounds how much of an unterminated line LineBuffered mode holds
+// back, so output without newlines (a spinner, a huge minified line) still
+// streams through.
+const maxHeldLine = 64 * 1024
+
+// takeCompleteLines appends p to the held partial line and returns everything
+// up to and including the last newline, keeping the remainder held.
+func (l *Linker) takeCompleteLines(p []byte) []byte {
+	l.heldLine = append(l.heldLine, p...)
+	i := bytes.LastIndexByte(l.heldLine, '\n')
+	if i < 0 && len(l.heldLine) <= maxHeldLine {
+		return nil
+	}
+	if i < 0 {
+		i = len(l.heldLine) - 1
+	}
+	l.completeLines = append(l.completeLines[:0], l.heldLine[:i+1]...)
+	l.heldLine = append(l.heldLine[:0], l.heldLine[i+1:]...)
+	return l.completeLines
+}
+
+// takeHead splits data after the last of the first LinkHead lines, counting
+// the newlines it passes. Without LinkHead, all of data is head.
+func (l *Linker) takeHead(data []byte) (head, tail []byte) {
+	if l.linkHead <= 0 {
+		return data, nil
+	}
+	i := 0
+	for l.linesSeen < l.linkHead {
+		j := bytes.IndexByte(data[i:], '\n')
+		if j < 0 {
+			return data, nil
+		}
+		i += j + 1
+		l.linesSeen++
+	}
+	return data[:i], data[i:]
+}
+
+// finishHead ends linking once the first LinkHead lines or MaxLinksTotal
+// links are written: state held for the next Write is flushed, then tail
+// and any held partial line are written as-is, as is everything after
+// them.
+func (l *Linker) finishHead(result *bytes.Buffer, tail []byte) {
+	l.flushState(result)
+	result.Write(tail)
+	result.Write(l.heldLine)
+	l.heldLine = l.heldLine[:0]
+	l.headDone = true
+}
+
+// resetIdleTimer (re)arms the idle flush while a partial line is held, so a
+// prompt printed without a trailing newline still shows up promptly.
+func (l *Linker) resetIdleTimer() {
+	if l.idleTimer != nil {
+		l.idleTimer.Stop()
+		l.idleTimer = nil
+	}
+	l.idleGen++
+	if l.idleFlush <= 0 || len(l.heldLine) == 0 {
+		return
+	}
+	gen := l.idleGen
+	l.idleTimer = l.afterFunc(l.idleFlush, func() { l.flushHeldLine(gen) })
+}
+
+// flushHeldLine emits the held partial line as-is. Unlike Flush it leaves
+// incomplete escape sequences in the tokenizer, since more output may follow.
+func (l *Linker) flushHeldLine(gen int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if gen != l.idleGen || len(l.heldLine) == 0 {
+		return
+	}
+	l.idleTimer = nil
+	buf := &l.out
+	buf.Reset()
+	l.processChunk(buf, l.heldLine)
+	l.heldLine = l.heldLine[:0]
+	l.flushPendingWord(buf)
+	if buf.Len() > 0 {
+		_, _ = l.writeOutput(buf.Bytes())
+	}
+}
+
+// processChunk tokenizes data and writes the linked result.
+func (l *Linker) processChunk(result *bytes.Buffer, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	tokens := l.tokenizer.Feed(data)
+	if l.stripLinks {
+		tokens = stripOSC8(tokens)
+	}
+	if l.postProcess != nil {
+		// Up front, so linkSplitPath looks ahead at processed tokens.
+		for i := range tokens {
+			tokens[i].Data = l.postProcess(tokens[i])
+		}
+	}
+	if l.stripSGR {
+		// The tokens stay, so tok.Styled still tracks the styled state.
+		for i := range tokens {
+			if tokens[i].Kind == ansitoken.TokenSGR {
+				tokens[i].Data = nil
+			}
+		}
+	}
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		if l.relinkOpen != nil && l.holdForRelink(result, tok) {
+			continue
+		}
 		switch tok.Kind {
-		case TokenText:
+		case ansitoken.TokenText:
+			if l.altScreen || l.inPaste {
+				result.Write(tok.Data)
+				break
+			}
 			data := tok.Data
 			if len(l.pendingWord) > 0 {
 				data = append(l.pendingWord, data...)
 				l.pendingWord = nil
 			}
-			if l.symbolLinks && l.styled && !l.inOSC8 {
+			if l.joinStyledPaths && !l.inOSC8 {
+				if n, tail := l.linkSplitPath(result, data, tokens[i+1:]); n > 0 {
+					i += n
+					if data = tail; len(data) == 0 {
+						break
+					}
+				}
+			}
+			if l.symbolLinks && l.styled && !l.inOSC8 && !isDiffHeader(data) && !l.batNamePending {
 				head, tail := splitTrailingStyledToken(data)
 				if len(tail) > 0 {
 					l.pendingWord = make([]byte, len(tail))
@@ -137,180 +578,1347 @@ func (l *Linker) Write(p []byte) (n int, err error) {
 				data = head
 			}
 			if len(data) > 0 {
-				result.Write(l.processTextWithState(data, l.styled, l.inOSC8))
+				l.processText(result, data)
 			}
-		case TokenSGR:
-			l.flushPendingWord(&result)
+		case ansitoken.TokenSGR:
+			l.flushPendingWord(result)
 			result.Write(tok.Data)
 			l.styled = tok.Styled
-		case TokenOSC8:
-			l.flushPendingWord(&result)
-			result.Write(tok.Data)
+		case ansitoken.TokenOSC8:
+			l.flushPendingWord(result)
 			l.inOSC8 = !tok.IsEnd
+			if l.scheme != "file" && strings.HasPrefix(tok.URI, "file://") {
+				if target, ok := l.rewriteFileURI(tok.URI); ok {
+					i := bytes.LastIndex(tok.Data, []byte(tok.URI))
+					result.Write(tok.Data[:i])
+					result.WriteString(target)
+					result.Write(tok.Data[i+len(tok.URI):])
+					break
+				}
+			}
+			if l.relinkExisting && !tok.IsEnd && !strings.HasPrefix(tok.URI, "file:") {
+				l.relinkOpen = tok.Data
+				l.relinkBEL = tok.BEL
+				break
+			}
+			result.Write(tok.Data)
+		case ansitoken.TokenCSI:
+			l.flushPendingWord(result)
+			if on, ok := altScreenSwitch(tok.Data); ok {
+				l.altScreen = on
+			}
+			// Pasted text echoed by a REPL is the user's, not output to link.
+			switch string(tok.Data) {
+			case "\x1b[200~":
+				l.inPaste = true
+			case "\x1b[201~":
+				l.inPaste = false
+			}
+			result.Write(tok.Data)
 		default:
-			l.flushPendingWord(&result)
+			l.flushPendingWord(result)
 			result.Write(tok.Data)
 		}
 	}
+}
 
-	if l.debugFile != nil {
-		_, _ = fmt.Fprintf(l.debugFile, "Output: %q\n\n", result.Bytes())
-		_ = l.debugFile.Sync()
+// altScreenSwitch reports whether the CSI sequence seq switches to the
+// alternate screen (on) or back, through any of the DEC private modes for
+// it: 1049, which vim, less and htop use, and the older 1047 and 47.
+func altScreenSwitch(seq []byte) (on, ok bool) {
+	params, found := bytes.CutPrefix(seq, []byte("\x1b[?"))
+	if !found || len(params) < 2 {
+		return false, false
 	}
+	final := params[len(params)-1]
+	if final != 'h' && final != 'l' {
+		return false, false
+	}
+	for p := range bytes.SplitSeq(params[:len(params)-1], []byte(";")) {
+		switch string(p) {
+		case "1049", "1047", "47":
+			return final == 'h', true
+		}
+	}
+	return false, false
+}
 
-	_, err = l.output.Write(result.Bytes())
-	if err != nil {
-		return 0, err
+// stripOSC8 drops the OSC 8 sequences from tokens for StripLinks, openers
+// with an id= or nested in another link as well as closers, and joins the
+// text around them. Display text such as "main.go" followed by ":12" after
+// the link then reaches the matchers as one "main.go:12".
+func stripOSC8(tokens []ansitoken.Token) []ansitoken.Token {
+	out := tokens[:0]
+	for _, tok := range tokens {
+		if tok.Kind == ansitoken.TokenOSC8 {
+			continue
+		}
+		if n := len(out); tok.Kind == ansitoken.TokenText && n > 0 && out[n-1].Kind == ansitoken.TokenText {
+			out[n-1].Data = append(slices.Clip(out[n-1].Data), tok.Data...)
+			continue
+		}
+		out = append(out, tok)
 	}
-	return len(p), nil
+	return out
+}
+
+// linkSplitPath handles a path that SGR sequences split into several text
+// tokens for JoinStyledPaths, as highlighters write
+// "src/main\x1b[36m.go\x1b[0m:10". text is the current text token and rest
+// the tokens after it. While SGR sequences stand between two path
+// characters, the text around them is joined, up to the end of the word
+// in the last text token, and linked as one. If a link then spans one of
+// the sequences, the result is written with the sequences put back where
+// they were, inside the link, and linkSplitPath returns how many tokens of
+// rest it consumed and the unprocessed tail of the last one. Otherwise it
+// writes nothing and returns 0, and the tokens are processed one by one.
+func (l *Linker) linkSplitPath(result *bytes.Buffer, text []byte, rest []ansitoken.Token) (int, []byte) {
+	type sgrAt struct {
+		offset int
+		data   []byte
+	}
+	joined := slices.Clone(text)
+	var sgrs []sgrAt
+	var styled bool
+	var tail []byte
+	consumed := 0
+	for i := 0; i < len(rest); {
+		j := i
+		for j < len(rest) && rest[j].Kind == ansitoken.TokenSGR {
+			j++
+		}
+		if j == i || j == len(rest) || rest[j].Kind != ansitoken.TokenText || len(rest[j].Data) == 0 ||
+			len(joined) == 0 || !isStyledTrailingTokenChar(joined[len(joined)-1]) ||
+			!isStyledTrailingTokenChar(rest[j].Data[0]) {
+			break
+		}
+		for _, tok := range rest[i:j] {
+			sgrs = append(sgrs, sgrAt{len(joined), tok.Data})
+			styled = tok.Styled
+		}
+		i = j + 1
+		consumed = i
+		word := rest[j].Data
+		if end := slices.IndexFunc(word, func(b byte) bool { return !isStyledTrailingTokenChar(b) }); end >= 0 {
+			joined = append(joined, word[:end]...)
+			tail = word[end:]
+			break
+		}
+		joined = append(joined, word...)
+	}
+	if consumed == 0 {
+		return 0, nil
+	}
+	// Only link the joined text if a path candidate spans a sequence, to
+	// spare most text the trial run below.
+	candidate := false
+	for _, m := range l.urlPattern.FindAllSubmatchIndex(joined, -1) {
+		if start, _, ok := submatch(m, 3); ok {
+			for _, sgr := range sgrs {
+				candidate = candidate || start < sgr.offset && sgr.offset < m[1]
+			}
+		}
+	}
+	if !candidate {
+		return 0, nil
+	}
+
+	// The trial run changes state, such as the diff block or the links
+	// counted for MaxLinksTotal, that the tokens change again when
+	// processed one by one; undo it if out is dropped.
+	saved := l.saveLinkState()
+	discard := func() (int, []byte) {
+		l.restoreLinkState(saved)
+		return 0, nil
+	}
+	var linked bytes.Buffer
+	l.processTextWithState(&linked, joined, l.styled, false)
+	out := linked.Bytes()
+
+	// Walk the output, numbering the links each byte of joined ends up in
+	// (0 for none), to find where the sequences go back in.
+	linkOf := make([]int, 0, len(joined))
+	links, inLink := 0, false
+	for k := 0; k < len(out); {
+		if out[k] == '\x1b' {
+			n, uri, ok := scanOSC8(out[k:])
+			if !ok {
+				return discard()
+			}
+			if inLink = uri != ""; inLink {
+				links++
+			}
+			k += n
+			continue
+		}
+		if len(linkOf) == len(joined) || out[k] != joined[len(linkOf)] {
+			return discard() // text changed, e.g. by ShortenHome or LinkMarker
+		}
+		if inLink {
+			linkOf = append(linkOf, links)
+		} else {
+			linkOf = append(linkOf, 0)
+		}
+		k++
+	}
+	spans := false
+	for _, sgr := range sgrs {
+		if p := sgr.offset; linkOf[p] != 0 && linkOf[p-1] == linkOf[p] {
+			spans = true
+		}
+	}
+	if !spans {
+		return discard()
+	}
+
+	// A sequence at the edge of a link goes outside it: after a closing
+	// OSC 8 and before an opening one.
+	plain := 0
+	for k := 0; k < len(out); {
+		if out[k] == '\x1b' {
+			n, uri, _ := scanOSC8(out[k:])
+			if uri != "" {
+				for len(sgrs) > 0 && sgrs[0].offset == plain {
+					result.Write(sgrs[0].data)
+					sgrs = sgrs[1:]
+				}
+			}
+			result.Write(out[k : k+n])
+			k += n
+			continue
+		}
+		for len(sgrs) > 0 && sgrs[0].offset == plain {
+			result.Write(sgrs[0].data)
+			sgrs = sgrs[1:]
+		}
+		result.WriteByte(out[k])
+		plain++
+		k++
+	}
+	l.styled = styled
+	return consumed, tail
+}
+
+// linkState is the part of the Linker that linking text changes, beyond
+// what it writes.
+type linkState struct {
+	linksWritten   int
+	diffFile       string
+	diffBlock      int
+	batNamePending bool
+	manifestLinks  int // links pending in the manifest
+}
+
+// saveLinkState returns the linkState for restoreLinkState, to take back
+// the output of a run whose result is dropped.
+func (l *Linker) saveLinkState() linkState {
+	s := linkState{
+		linksWritten:   l.linksWritten,
+		diffFile:       l.diffFile,
+		diffBlock:      l.diffBlock,
+		batNamePending: l.batNamePending,
+	}
+	if l.manifest != nil {
+		s.manifestLinks = len(l.manifest.pending)
+	}
+	return s
+}
+
+func (l *Linker) restoreLinkState(s linkState) {
+	l.linksWritten = s.linksWritten
+	l.diffFile, l.diffBlock, l.batNamePending = s.diffFile, s.diffBlock, s.batNamePending
+	if l.manifest != nil {
+		l.manifest.pending = l.manifest.pending[:s.manifestLinks]
+	}
+}
+
+// scanOSC8 returns the length and URI of the OSC 8 sequence at the start of
+// b, which ends in ST or BEL.
+func scanOSC8(b []byte) (n int, uri string, ok bool) {
+	const prefix = "\x1b]8;"
+	if !bytes.HasPrefix(b, []byte(prefix)) {
+		return 0, "", false
+	}
+	for i := len(prefix); i < len(b); i++ {
+		switch {
+		case b[i] == '\x07':
+			n = i + 1
+		case b[i] == '\x1b' && i+1 < len(b) && b[i+1] == '\\':
+			n = i + 2
+		default:
+			continue
+		}
+		_, uri, _ = strings.Cut(string(b[len(prefix):i]), ";")
+		return n, uri, true
+	}
+	return 0, "", false
+}
+
+// rewriteFileURI converts a file:// URI from an existing link to the
+// configured scheme so it opens in the same editor as osc8wrap's own links.
+// URIs naming another host are left alone.
+func (l *Linker) rewriteFileURI(uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" || u.Path == "" {
+		return "", false
+	}
+	if u.Host != "" && u.Host != "localhost" && u.Host != l.hostname {
+		return "", false
+	}
+	return l.formatFileURL(u.Path, ""), true
+}
+
+// holdForRelink buffers the tokens of an existing link held for
+// RelinkExisting until its closing sequence arrives. It reports whether tok
+// was consumed; otherwise the held link is written unchanged and tok is left
+// for normal processing.
+func (l *Linker) holdForRelink(result *bytes.Buffer, tok ansitoken.Token) bool {
+	switch {
+	case tok.Kind == ansitoken.TokenOSC8 && tok.IsEnd:
+		l.finishRelink(result, tok.Data)
+		l.inOSC8 = false
+		return true
+	case tok.Kind == ansitoken.TokenOSC8, l.relinkBody.Len()+len(tok.Data) > maxHeldLine:
+		// Another link opening ends this one implicitly; too long a
+		// display text is not a file path. Either way, keep the original.
+		l.finishRelink(result, nil)
+		return false
+	}
+	if tok.Kind == ansitoken.TokenText {
+		l.relinkText.Write(tok.Data)
+	}
+	if tok.Kind == ansitoken.TokenSGR {
+		l.styled = tok.Styled
+	}
+	l.relinkBody.Write(tok.Data)
+	return true
+}
+
+// finishRelink writes the held link, pointing it at the file its display
+// text names if there is one and the link was closed (closeSeq != nil).
+func (l *Linker) finishRelink(result *bytes.Buffer, closeSeq []byte) {
+	url, ok := "", false
+	if closeSeq != nil {
+		url, ok = l.relinkTarget(l.relinkText.Bytes())
+	}
+	// Past MaxLinksTotal the command's own link is kept as it was.
+	if ok && l.countLink() {
+		if l.manifest != nil {
+			l.manifest.add("file", url, l.relinkText.Bytes())
+		}
+		result.WriteString("\x1b]8;;" + url + l.stFor(l.relinkBEL))
+	} else {
+		result.Write(l.relinkOpen)
+	}
+	result.Write(l.relinkBody.Bytes())
+	result.Write(closeSeq)
+	l.relinkOpen = nil
+	l.relinkBody.Reset()
+	l.relinkText.Reset()
+}
+
+// relinkTarget returns the link target for display text that consists of
+// exactly one existing file path, with an optional location.
+func (l *Linker) relinkTarget(display []byte) (string, bool) {
+	text := bytes.TrimSpace(display)
+	m := l.urlPattern.FindSubmatchIndex(text)
+	pathStart, pathEnd, ok := submatch(m, 3)
+	if !ok || pathStart != 0 || m[1] != len(text) {
+		return "", false
+	}
+	var locSuffix []byte
+	if start, end, ok := submatch(m, 4); ok {
+		locSuffix = text[start:end]
+	}
+	pathPart, loc := l.splitLocation(text[pathStart:pathEnd], locSuffix)
+	absPath, ok := l.resolveFilePath(fileURLPath(pathPart))
+	if !ok {
+		return "", false
+	}
+	return l.formatFileURL(absPath, loc), true
 }
 
 func (l *Linker) flushPendingWord(buf *bytes.Buffer) {
 	if len(l.pendingWord) == 0 {
 		return
 	}
-	buf.Write(l.processTextWithState(l.pendingWord, l.styled, l.inOSC8))
-	l.pendingWord = nil
+	l.processText(buf, l.pendingWord)
+	l.pendingWord = nil
+}
+
+func splitTrailingStyledToken(data []byte) (head, tail []byte) {
+	end := len(data)
+	for end > 0 {
+		b := data[end-1]
+		if isStyledTrailingTokenChar(b) {
+			end--
+		} else {
+			break
+		}
+	}
+	return data[:end], data[end:]
+}
+
+func isStyledTrailingTokenChar(b byte) bool {
+	// Keep UTF-8 bytes in the pending token so styled non-ASCII file paths
+	// remain intact for file-path matching before symbol fallback.
+	if b >= 0x80 {
+		return true
+	}
+	if isWordChar(b) {
+		return true
+	}
+	switch b {
+	case '.', '/', '-', '%', '+', '@', ':', '~':
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *Linker) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.idleTimer != nil {
+		l.idleTimer.Stop()
+		l.idleTimer = nil
+	}
+	l.idleGen++
+	buf := &l.out
+	buf.Reset()
+	if len(l.heldLine) > 0 {
+		l.processChunk(buf, l.heldLine)
+		l.heldLine = l.heldLine[:0]
+	}
+	l.flushState(buf)
+	if buf.Len() > 0 {
+		_, err := l.writeOutput(buf.Bytes())
+		return err
+	}
+	return nil
+}
+
+// flushState writes out everything held back for a following Write: the
+// pending styled word, a link held for relinking and incomplete escape
+// sequences in the tokenizer.
+func (l *Linker) flushState(buf *bytes.Buffer) {
+	l.flushPendingWord(buf)
+	if l.relinkOpen != nil {
+		l.finishRelink(buf, nil)
+	}
+
+	for _, tok := range l.tokenizer.Flush() {
+		if l.postProcess != nil {
+			tok.Data = l.postProcess(tok)
+		}
+		buf.Write(tok.Data)
+	}
+}
+
+func (l *Linker) Close() error {
+	if err := l.Flush(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	manifest := l.manifest
+	l.manifest = nil // written once, even if Close is called again
+	l.mu.Unlock()
+	if manifest != nil {
+		if err := manifest.write(); err != nil {
+			return err
+		}
+	}
+	if l.debugFile != nil {
+		return l.debugFile.Close()
+	}
+	return nil
+}
+
+// processText links data using the current styled/OSC 8 state. With
+// MaxLineLen, a line is written raw from the text that takes it past the
+// limit on, so a minified bundle or a base64 blob on one line is not
+// scanned for links at all; the lines around it are linked as usual.
+func (l *Linker) processText(result *bytes.Buffer, data []byte) {
+	if l.maxLineLen <= 0 {
+		l.processLines(result, data)
+		return
+	}
+	start := 0 // lines from here on are not written yet
+	for i := 0; i < len(data); {
+		end, n := len(data), len(data)-i
+		if j := bytes.IndexByte(data[i:], '\n'); j >= 0 {
+			end, n = i+j+1, j
+		}
+		if l.lineLen+n > l.maxLineLen {
+			l.processLines(result, data[start:i])
+			result.Write(data[i:end])
+			start = end
+		}
+		if data[end-1] == '\n' {
+			l.lineLen = 0
+		} else {
+			l.lineLen += n
+		}
+		i = end
+	}
+	l.processLines(result, data[start:])
+}
+
+// processLines links data using the current styled/OSC 8 state. With
+// NoLinkCRLines, lines terminated by a bare \r and lines redrawn after one
+// are passed through unlinked, so progress bars that rewrite the current
+// line do not accumulate links. With LineTimeout, each line is processed
+// on its own so a line that runs out of time can fall back to raw text.
+func (l *Linker) processLines(result *bytes.Buffer, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	if !l.noLinkCRLines {
+		if l.lineTimeout <= 0 {
+			l.processTextWithState(result, data, l.styled, l.inOSC8)
+			return
+		}
+		for len(data) > 0 {
+			n := bytes.IndexByte(data, '\n') + 1
+			if n == 0 {
+				n = len(data)
+			}
+			l.processLine(result, data[:n], false)
+			data = data[n:]
+		}
+		return
+	}
+
+	if l.pendingCR && len(data) > 0 {
+		l.pendingCR = false
+		if data[0] != '\n' {
+			l.crLine = true
+		}
+	}
+
+	for len(data) > 0 {
+		i := bytes.IndexAny(data, "\r\n")
+		if i < 0 {
+			l.processLine(result, data, l.crLine)
+			return
+		}
+
+		switch {
+		case data[i] == '\n':
+			l.processLine(result, data[:i+1], l.crLine)
+			l.crLine = false
+			i++
+		case i+1 < len(data) && data[i+1] == '\n':
+			l.processLine(result, data[:i+2], l.crLine)
+			l.crLine = false
+			i += 2
+		case i+1 == len(data):
+			// A trailing \r may be the first half of a CRLF split across writes.
+			l.processLine(result, data, l.crLine)
+			l.pendingCR = true
+			i++
+		default:
+			result.Write(data[:i+1])
+			l.crLine = true
+			i++
+		}
+		data = data[i:]
+	}
+}
+
+func (l *Linker) processLine(result *bytes.Buffer, line []byte, raw bool) {
+	if raw {
+		result.Write(line)
+		return
+	}
+	if l.lineTimeout <= 0 {
+		l.processTextWithState(result, line, l.styled, l.inOSC8)
+		return
+	}
+
+	// A single pathological line (thousands of path candidates to stat)
+	// must not stall the stream: past the deadline, processTextWithState
+	// bails out and whatever it wrote is replaced by the raw line.
+	mark, saved := result.Len(), l.saveLinkState()
+	l.lineDeadline = l.now().Add(l.lineTimeout)
+	l.processTextWithState(result, line, l.styled, l.inOSC8)
+	if l.lineTimedOut {
+		result.Truncate(mark)
+		result.Write(line)
+		l.restoreLinkState(saved)
+	}
+	l.lineDeadline = time.Time{}
+	l.lineTimedOut = false
+}
+
+// enabled reports whether the matcher category m is on.
+func (l *Linker) enabled(m uint8) bool {
+	return l.disabled&m == 0
+}
+
+// pastLineDeadline reports whether the line being processed has run out of
+// time, and remembers it so processLine falls back to the raw line.
+func (l *Linker) pastLineDeadline() bool {
+	if l.lineTimedOut {
+		return true
+	}
+	if l.lineDeadline.IsZero() || l.now().Before(l.lineDeadline) {
+		return false
+	}
+	l.lineTimedOut = true
+	return true
+}
+
+func (l *Linker) processTextWithState(result *bytes.Buffer, data []byte, styled, inOSC8 bool) {
+	if inOSC8 {
+		result.Write(data)
+		return
+	}
+
+	if l.batHeader || l.diffFile != "" || bytes.Contains(data, []byte("+++ ")) ||
+		l.groupFileLinks && bytes.Contains(data, []byte("diff --git ")) {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 && i+1 < len(data) {
+			// One line at a time, so each hunk header goes to the file
+			// named above it and headers are matched at the line start.
+			for len(data) > 0 {
+				n := bytes.IndexByte(data, '\n') + 1
+				if n == 0 {
+					n = len(data)
+				}
+				l.processTextWithState(result, data[:n], styled, inOSC8)
+				data = data[n:]
+			}
+			return
+		}
+		if l.groupFileLinks && bytes.HasPrefix(data, []byte("diff --git ")) {
+			l.diffBlock++
+		}
+		if l.enabled(matchHunk) && l.linkHunkHeader(result, data, styled) {
+			return
+		}
+		if l.batHeader && l.linkBatHeader(result, data, styled) {
+			return
+		}
+	}
+
+	if l.linkTestNames {
+		if m := goTestResultPattern.FindSubmatchIndex(data); m != nil {
+			l.processTextWithState(result, data[:m[2]], styled, inOSC8)
+			l.wrapGoTestName(result, data[m[2]:m[3]])
+			l.processTextWithState(result, data[m[3]:], styled, inOSC8)
+			return
+		}
+	}
+
+	if l.linkGoMod {
+		if m := findGoModule(data); m != nil {
+			l.processTextWithState(result, data[:m[4]], styled, inOSC8)
+			module, version := data[m[4]:m[5]], []byte(nil)
+			if m[6] >= 0 {
+				version = data[m[6]:m[7]]
+			}
+			l.wrapGoModule(result, module, data[m[5]:m[1]-len(version)], version)
+			l.processTextWithState(result, data[m[1]:], styled, inOSC8)
+			return
+		}
+	}
+
+	if l.linkGoPkgErrors {
+		if start, end, absPath := l.findPathError(data); absPath != "" {
+			l.processTextWithState(result, data[:start], styled, inOSC8)
+			result.Write(l.wrapFile(nil, absPath, "", data[start:end]))
+			l.processTextWithState(result, data[end:], styled, inOSC8)
+			return
+		}
+	}
+
+	if l.linkGoRace && l.enabled(matchFile) {
+		if start, end, absPath, loc := l.findGoFrame(data); absPath != "" {
+			l.processTextWithState(result, data[:start], styled, inOSC8)
+			result.Write(l.wrapFile(nil, absPath, loc, data[start:end]))
+			l.processTextWithState(result, data[end:], styled, inOSC8)
+			return
+		}
+	}
+
+	if l.enabled(matchFile) {
+		if start, end, absPath, loc := l.findProseLocation(data); absPath != "" {
+			l.processTextWithState(result, data[:start], styled, inOSC8)
+			result.Write(l.wrapFile(nil, absPath, loc, data[start:end]))
+			l.processTextWithState(result, data[end:], styled, inOSC8)
+			return
+		}
+	}
+
+	if l.jsonPaths && l.enabled(matchFile) {
+		if start, end, absPath, loc := l.findJSONPath(data); absPath != "" {
+			l.processTextWithState(result, data[:start], styled, inOSC8)
+			result.Write(l.wrapFile(nil, absPath, loc, data[start:end]))
+			l.processTextWithState(result, data[end:], styled, inOSC8)
+			return
+		}
+	}
+
+	var matches [][]int
+	if mayContainLink(data) {
+		matches = l.urlPattern.FindAllSubmatchIndex(data, -1)
+	}
+	if l.pastLineDeadline() {
+		return
+	}
+	if len(matches) == 0 {
+		if l.symbolLinks && styled {
+			l.replaceSymbolsStyledSegment(result, data)
+		} else {
+			result.Write(data)
+		}
+		return
+	}
+
+	// With LinkLine, the rest of a line that starts with file:line is
+	// wrapped in the same link; lineLinkEnd is where that region stops.
+	var lineLinkURL string
+	var lineLinkEnd int
+
+	// writeText writes unlinked text found at data[start:], trying symbol
+	// links on it when symbols is set.
+	writeText := func(segment []byte, start int, symbols bool) {
+		if lineLinkURL != "" && start < lineLinkEnd && len(segment) > 0 {
+			n := min(len(segment), lineLinkEnd-start)
+			result.Write(l.osc8Link(lineLinkURL, segment[:n]))
+			segment = segment[n:]
+		}
+		if len(segment) == 0 {
+			return
+		}
+		if symbols && l.symbolLinks && styled {
+			l.replaceSymbolsStyledSegment(result, segment)
+		} else {
+			result.Write(segment)
+		}
+	}
+
+	last := 0
+	for _, m := range matches {
+		if l.pastLineDeadline() {
+			return
+		}
+		fullStart, fullEnd := m[0], m[1]
+		if fullStart < last {
+			continue // swallowed by a line list
+		}
+		// Unlinked text before the match is written once the match turns
+		// out to produce output of its own.
+		writeBefore := func() {
+			if fullStart > last {
+				writeText(data[last:fullStart], last, true)
+			}
+		}
+
+		if start, end, ok := submatch(m, 1); ok {
+			writeBefore()
+			if !l.enabled(matchURL) {
+				writeText(data[fullStart:fullEnd], fullStart, false)
+				last = fullEnd
+				continue
+			}
+			if end-start > maxURLLength {
+				writeText(data[start:end], start, false)
+				last = fullEnd
+				continue
+			}
+			wrapped, suffix := l.wrapURL(data[start:end])
+			result.Write(wrapped)
+			writeText(suffix, end-len(suffix), false)
+			last = fullEnd
+			continue
+		}
+
+		if start, end, ok := submatch(m, 2); ok {
+			writeBefore()
+			if !l.enabled(matchDomain) {
+				writeText(data[fullStart:fullEnd], fullStart, false)
+				last = fullEnd
+				continue
+			}
+			writeText(data[fullStart:start], fullStart, false)
+			result.Write(l.wrapBareDomain(nil, data[start:end]))
+			last = fullEnd
+			continue
+		}
+
+		pathStart, pathEnd, ok := submatch(m, 3)
+		if ok && !l.enabled(matchFile) {
+			continue
+		}
+		if !ok {
+			writeBefore()
+			writeText(data[fullStart:fullEnd], fullStart, false)
+			last = fullEnd
+			continue
+		}
+
+		pathPart := data[pathStart:pathEnd]
+		var locSuffix []byte
+		if start, end, ok := submatch(m, 4); ok {
+			locSuffix = data[start:end]
+		}
+
+		displayText := data[pathStart:fullEnd]
+		pathPart, loc := l.splitLocation(pathPart, locSuffix)
+		// Text that stays unlinked is left for the next writeText, so a
+		// symbol such as "café.crème", of which only "café.cr" looks like
+		// a path, reaches replaceSymbolsStyledSegment in one piece. A lone
+		// "/" or "//", such as a comment marker, would link to the root
+		// directory.
+		if isPseudoFile(data, pathStart) || len(bytes.Trim(pathPart, "/")) == 0 ||
+			loc == "" && l.locationRequired(pathPart) {
+			continue
+		}
+		var trailing []byte
+		var absPath string
+		ok = false
+		// Punctuation from other scripts counts as path characters, so a
+		// path can come with it attached: "「文档/说明.md」", "文件：main.go"
+		// or "→main.go". Unless a file is literally named that way, the
+		// path is retried after each run of such punctuation.
+		if bytes.IndexFunc(pathPart, isForeignPunct) >= 0 && !l.pathExists(l.resolvePath(fileURLPath(pathPart))) {
+			for _, lead := range foreignPunctEnds(pathPart) {
+				trimmed := pathPart[lead:]
+				if loc == "" {
+					trimmed = bytes.TrimRightFunc(trimmed, isForeignPunct)
+				}
+				if len(trimmed) == 0 || len(trimmed) == len(pathPart) {
+					continue
+				}
+				if absPath, ok = l.resolveFilePath(fileURLPath(trimmed)); ok {
+					tail := pathPart[lead+len(trimmed):]
+					pathStart += lead
+					pathPart = trimmed
+					displayText = data[pathStart:fullEnd]
+					if len(tail) > 0 {
+						displayText, trailing = trimmed, tail
+					}
+					break
+				}
+			}
+		}
+		if !ok {
+			absPath, ok = l.resolveFilePath(fileURLPath(pathPart))
+		}
+		if !ok && loc == "" {
+			// Prose like "written to ./out.txt." ends the path with a
+			// full stop that the path class happily absorbs.
+			if trimmed := bytes.TrimRight(pathPart, "."); len(trimmed) > 0 && len(trimmed) < len(pathPart) {
+				absPath, ok = l.resolveFilePath(fileURLPath(trimmed))
+				displayText, trailing = trimmed, pathPart[len(trimmed):]
+			}
+		}
+		if !ok {
+			continue
+		}
+		writeBefore()
+		if !l.extensionLinked(string(pathPart), absPath) {
+			writeText(data[fullStart:fullEnd], fullStart, false)
+			last = fullEnd
+			continue
+		}
+
+		writeText(data[fullStart:pathStart], fullStart, false)
+		result.Write(l.wrapFile(nil, absPath, loc, displayText))
+		writeText(trailing, fullEnd-len(trailing), false)
+		if trailing == nil && loc != "" && !strings.Contains(loc[1:], ":") {
+			fullEnd += l.writeLineList(result, data[fullEnd:], absPath)
+		}
+		if l.linkLine && loc != "" && lineLinkURL == "" && isLineStart(data, pathStart) {
+			lineLinkURL = l.formatFileURL(absPath, loc)
+			lineLinkEnd = lineEnd(data, fullEnd)
+		}
+		last = fullEnd
+	}
+
+	if last < len(data) {
+		writeText(data[last:], last, true)
+	}
+}
+
+// splitLocation returns the path and its ':'-separated location. Besides
+// ':', LineSeparators may allow characters such as '@' before the line
+// number. Those are path characters too, so a path with a / or ./ prefix
+// swallows "@42"; it is split back off here when only digits follow the
+// separator, which leaves module versions like "@v1.2.3" in the path.
+// A "::42::5" location is normalized to ":42:5"; pytest node IDs such as
+// "::test_x" never get here, as group 4 only takes digits.
+func (l *Linker) splitLocation(pathPart, locSuffix []byte) ([]byte, string) {
+	loc := string(locSuffix)
+	if strings.HasPrefix(loc, "::") {
+		return pathPart, strings.ReplaceAll(loc, "::", ":")
+	}
+	if l.lineSeparators == "" {
+		return pathPart, loc
+	}
+	if loc != "" && loc[0] != ':' {
+		return pathPart, ":" + loc[1:]
+	}
+	if strings.ContainsAny(strings.TrimPrefix(loc, ":"), ":-") {
+		return pathPart, loc // already line and column
+	}
+	i := bytes.LastIndexAny(pathPart, l.lineSeparators)
+	if i <= 0 || !isDigits(pathPart[i+1:]) {
+		return pathPart, loc
+	}
+	return pathPart[:i], ":" + string(pathPart[i+1:]) + loc
+}
+
+// foreignPunctEnds returns 0 and the offset after each run of
+// isForeignPunct characters in path: where a path wrapped in or preceded by
+// such punctuation may start.
+func foreignPunctEnds(path []byte) []int {
+	ends := []int{0}
+	inPunct := false
+	for i := 0; i < len(path); {
+		r, size := utf8.DecodeRune(path[i:])
+		punct := isForeignPunct(r)
+		if inPunct && !punct {
+			ends = append(ends, i)
+		}
+		inPunct = punct
+		i += size
+	}
+	return ends
+}
+
+// isForeignPunct reports whether r is punctuation, a symbol other than an
+// emoji, or a space outside ASCII, which the path pattern takes as a path
+// character.
+func isForeignPunct(r rune) bool {
+	return r >= utf8.RuneSelf &&
+		(unicode.IsPunct(r) || unicode.IsSpace(r) || unicode.IsSymbol(r) && !unicode.Is(unicode.So, r))
+}
+
+func isDigits(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// writeLineList links the further lines of a "main.go:10,15,20" list that
+// follows a file:line link, each to its own line, and returns how many bytes
+// of data it consumed. A list running into more path characters, as in
+// "a.go:1,2b.go", or into a column is left alone.
+func (l *Linker) writeLineList(result *bytes.Buffer, data []byte, absPath string) int {
+	var lines [][]byte
+	n := 0
+	for n < len(data) && data[n] == ',' {
+		end := n + 1
+		for end < len(data) && data[end] >= '0' && data[end] <= '9' {
+			end++
+		}
+		if end == n+1 {
+			break
+		}
+		lines = append(lines, data[n+1:end])
+		n = end
+	}
+	if n == 0 {
+		return 0
+	}
+	if n < len(data) && (isWordChar(data[n]) || strings.IndexByte("./-", data[n]) >= 0) {
+		return 0
+	}
+	if n+1 < len(data) && data[n] == ':' && isDigits(data[n+1:n+2]) {
+		return 0 // "10,15:3" gives a column, which a list cannot carry
+	}
+	for _, line := range lines {
+		result.WriteByte(',')
+		result.Write(l.osc8Link(l.formatFileURL(absPath, ":"+string(line)), line))
+	}
+	return n
+}
+
+// isLineStart reports whether only spaces and tabs precede data[i] on its line.
+func isLineStart(data []byte, i int) bool {
+	for i > 0 {
+		i--
+		switch data[i] {
+		case '\n':
+			return true
+		case ' ', '\t':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// lineEnd returns the offset of the line terminator (\n or \r\n) at or after
+// i, or len(data) when the line continues past data.
+func lineEnd(data []byte, i int) int {
+	n := bytes.IndexByte(data[i:], '\n')
+	if n < 0 {
+		return len(data)
+	}
+	end := i + n
+	if end > i && data[end-1] == '\r' {
+		end--
+	}
+	return end
+}
+
+// goTestResultPattern matches `go test -v` result lines such as
+// "--- FAIL: TestFoo (0.00s)". Group 1 is the top-level test name; subtest
+// suffixes ("/case") are left to the regular matchers.
+var goTestResultPattern = regexp.MustCompile(`--- (?:FAIL|PASS|SKIP): ((?:Test|Benchmark|Example|Fuzz)\w*)`)
+
+// diffNewFilePattern matches the "+++ b/path" line that names the new side
+// of a file in a unified diff, and hunkHeaderPattern a hunk header such as
+// "@@ -12,7 +15,9 @@", with the first line on the new side in group 1. Both
+// are matched against a single line, so ^ is its start.
+var (
+	diffNewFilePattern = regexp.MustCompile(`^\+\+\+ (\S+)`)
+	hunkHeaderPattern  = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
+)
+
+// isDiffHeader reports whether text starts like a "+++" or hunk header
+// line, which linkHunkHeader needs to see whole rather than split up for
+// symbol linking.
+func isDiffHeader(text []byte) bool {
+	return bytes.HasPrefix(text, []byte("+++ ")) || bytes.HasPrefix(text, []byte("@@ "))
+}
+
+// linkHunkHeader keeps track of the file a diff is showing and links the
+// hunk headers under it to their first new line. It reports whether it wrote
+// line; a "+++" line is left to the regular matchers, which link its path.
+func (l *Linker) linkHunkHeader(result *bytes.Buffer, line []byte, styled bool) bool {
+	if m := diffNewFilePattern.FindSubmatch(line); m != nil {
+		l.diffFile = ""
+		if path := string(m[1]); path != "/dev/null" {
+			l.diffFile, _ = l.resolveFilePath(path)
+		}
+		return false
+	}
+	if l.diffFile == "" {
+		return false
+	}
+	m := hunkHeaderPattern.FindSubmatchIndex(line)
+	if m == nil {
+		return false
+	}
+	start, _ := strconv.Atoi(string(line[m[2]:m[3]]))
+	result.Write(l.wrapFile(nil, l.diffFile, ":"+strconv.Itoa(max(start, 1)), line[:m[1]]))
+	l.processTextWithState(result, line[m[1]:], styled, false)
+	return true
 }
 
-func splitTrailingStyledToken(data []byte) (head, tail []byte) {
-	end := len(data)
-	for end > 0 {
-		b := data[end-1]
-		if isStyledTrailingTokenChar(b) {
-			end--
-		} else {
-			break
+// batHeaderPattern matches the header bat prints above a file,
+// "File: src/main.go", optionally inside its grid ("       │ File: ...").
+// Group 1 is the rest of the line: the name, possibly followed by
+// "<EMPTY>" or "<BINARY>". With colors the name comes in its own text
+// token, leaving group 1 empty.
+var batHeaderPattern = regexp.MustCompile(`^[ \t]*(?:│[ \t]*)?File: ([^\r\n]*)`)
+
+// linkBatHeader links the file name in a bat header line. The name runs to
+// the end of the line, so unlike other paths it may contain spaces and
+// needs no extension. Line-number gutters below the header are plain text
+// to the other matchers already. It reports whether it wrote line.
+func (l *Linker) linkBatHeader(result *bytes.Buffer, line []byte, styled bool) bool {
+	var label []byte
+	if l.batNamePending {
+		l.batNamePending = false
+	} else {
+		m := batHeaderPattern.FindSubmatchIndex(line)
+		if m == nil {
+			return false
+		}
+		if m[2] == len(line) {
+			result.Write(line)
+			l.batNamePending = true
+			return true
 		}
+		label = line[:m[2]]
 	}
-	return data[:end], data[end:]
-}
 
-func isStyledTrailingTokenChar(b byte) bool {
-	// Keep UTF-8 bytes in the pending token so styled non-ASCII file paths
-	// remain intact for file-path matching before symbol fallback.
-	if b >= 0x80 {
-		return true
+	rest := line[len(label):]
+	name := rest
+	if i := bytes.IndexAny(name, "\r\n"); i >= 0 {
+		name = name[:i]
 	}
-	if isWordChar(b) {
-		return true
+	name = bytes.TrimRight(name, " \t")
+	for _, marker := range []string{"<EMPTY>", "<BINARY>"} {
+		name = bytes.TrimRight(bytes.TrimSuffix(name, []byte(marker)), " \t")
 	}
-	switch b {
-	case '.', '/', '-', '%', '+', '@', ':', '~':
-		return true
-	default:
+	absPath, ok := l.resolveFilePath(string(name))
+	if len(name) == 0 || !ok || !l.extensionLinked(string(name), absPath) {
 		return false
 	}
+	result.Write(label)
+	result.Write(l.wrapFile(nil, absPath, "", name))
+	l.processTextWithState(result, rest[len(name):], styled, false)
+	return true
 }
 
-func (l *Linker) Flush() error {
-	var buf bytes.Buffer
-	l.flushPendingWord(&buf)
+// pathErrorPattern matches the message of a Go *os.PathError, "op path:
+// errno", such as "open /etc/app.yaml: no such file or directory". Group 1
+// is the path, which may hold spaces but not ": ".
+var pathErrorPattern = regexp.MustCompile(`(?:^|[^\w-])(?:open|stat|lstat|fstatat|openat|readlink|mkdir|mkdirat|remove|unlinkat|chdir|chmod|chown|lchown|chtimes|truncate|read|write|seek|close|readdirent) ` +
+	`((?:[^\n:]|:[^ \n])+?): ` +
+	`(?:no such file or directory|permission denied|is a directory|not a directory|file exists|directory not empty|` +
+	`too many open files|read-only file system|file name too long|too many levels of symbolic links|` +
+	`operation not permitted|invalid argument|input/output error|bad file descriptor|device or resource busy|` +
+	`text file busy|no space left on device|disk quota exceeded|file already closed)`)
 
-	for _, tok := range l.tokenizer.Flush() {
-		buf.Write(tok.Data)
-	}
-	if buf.Len() > 0 {
-		_, err := l.output.Write(buf.Bytes())
-		return err
+// findPathError returns the bounds and resolved path of the first
+// pathErrorPattern match whose path exists and passes LinkExt/NoLinkExt.
+func (l *Linker) findPathError(data []byte) (start, end int, absPath string) {
+	for _, m := range pathErrorPattern.FindAllSubmatchIndex(data, -1) {
+		path := string(data[m[2]:m[3]])
+		if absPath, ok := l.resolveFilePath(path); ok && l.extensionLinked(path, absPath) {
+			return m[2], m[3], absPath
+		}
 	}
-	return nil
+	return 0, 0, ""
 }
 
-func (l *Linker) Close() error {
-	if err := l.Flush(); err != nil {
-		return err
+// jsonStringPattern matches a JSON string; group 1 is its content, still
+// escaped.
+var jsonStringPattern = regexp.MustCompile(`"((?:[^"\\\x00-\x1f]|\\.)+)"`)
+
+// jsonLocationPattern matches a :line or :line:col at the end of a path.
+var jsonLocationPattern = regexp.MustCompile(`:\d+(?::\d+)?$`)
+
+// findJSONPath returns the bounds, resolved path and location of the
+// content of the first JSON string that holds an escaped separator, `\\`
+// or `\/`, and names an existing file that passes LinkExt/NoLinkExt. Such
+// strings come from JSON logs, which escape the backslashes of Windows
+// paths ("C:\\src\\main.go") and sometimes slashes ("\/src\/main.go"). A
+// Windows path loses its drive and is looked up relative to the cwd, from
+// its longest tail down, so C:\work\app\src\main.go finds src/main.go in a
+// checkout of app. The escaped text stays the display text.
+func (l *Linker) findJSONPath(data []byte) (start, end int, absPath, loc string) {
+	if !bytes.Contains(data, []byte(`\\`)) && !bytes.Contains(data, []byte(`\/`)) {
+		return 0, 0, "", ""
 	}
-	if l.debugFile != nil {
-		return l.debugFile.Close()
+	for _, m := range jsonStringPattern.FindAllSubmatchIndex(data, -1) {
+		content := data[m[2]:m[3]]
+		if !bytes.Contains(content, []byte(`\\`)) && !bytes.Contains(content, []byte(`\/`)) {
+			continue
+		}
+		path, ok := jsonUnescapePath(string(content))
+		if !ok {
+			continue
+		}
+		loc = jsonLocationPattern.FindString(path)
+		path = strings.TrimSuffix(path, loc)
+		if absPath, ok := l.resolveJSONPath(path); ok && l.extensionLinked(path, absPath) {
+			return m[2], m[3], absPath, loc
+		}
 	}
-	return nil
+	return 0, 0, "", ""
 }
 
-func (l *Linker) processTextWithState(data []byte, styled, inOSC8 bool) []byte {
-	if inOSC8 {
-		return data
+// jsonUnescapePath undoes the `\\` and `\/` escapes of a JSON string. Any
+// other escape, such as \n or \u0041, means the string is not a path.
+func jsonUnescapePath(s string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		if i == len(s) || s[i] != '\\' && s[i] != '/' {
+			return "", false
+		}
+		b.WriteByte(s[i])
 	}
+	return b.String(), true
+}
 
-	matches := l.urlPattern.FindAllSubmatchIndex(data, -1)
-	if len(matches) == 0 {
-		if l.symbolLinks && styled {
-			return l.replaceSymbolsStyledSegment(data)
+// resolveJSONPath resolves a path unescaped by findJSONPath; see there for
+// how Windows paths are handled.
+func (l *Linker) resolveJSONPath(path string) (string, bool) {
+	if !strings.Contains(path, `\`) {
+		return l.resolveFilePath(path)
+	}
+	path = strings.ReplaceAll(path, `\`, "/")
+	if len(path) >= 2 && path[1] == ':' && ('A' <= path[0] && path[0] <= 'Z' || 'a' <= path[0] && path[0] <= 'z') {
+		path = path[2:]
+	}
+	path = strings.TrimLeft(path, "/")
+	if path == "" {
+		return "", false
+	}
+	if absPath, ok := l.resolveTail(path); ok {
+		return absPath, true
+	}
+	if l.resolveBasename {
+		if absPath := l.index.Resolve(path); absPath != "" {
+			return absPath, true
 		}
-		return data
 	}
+	return "", false
+}
 
-	var result bytes.Buffer
-	last := 0
-	for _, m := range matches {
-		fullStart, fullEnd := m[0], m[1]
-		if fullStart > last {
-			segment := data[last:fullStart]
-			if l.symbolLinks && styled {
-				result.Write(l.replaceSymbolsStyledSegment(segment))
-			} else {
-				result.Write(segment)
-			}
+// resolveTail resolves path, or failing that the longest tail of it that
+// exists relative to the cwd: for a path from another machine or a
+// -trimpath build, /home/ci/app/src/main.go or example.com/app/src/main.go,
+// that is src/main.go in a checkout of app.
+func (l *Linker) resolveTail(path string) (string, bool) {
+	for tail := path; tail != ""; {
+		if absPath := l.resolvePath(tail); l.pathExists(absPath) {
+			return absPath, true
 		}
-
-		if start, end, ok := submatch(m, 1); ok {
-			wrapped, suffix := l.wrapURL(data[start:end])
-			result.Write(wrapped)
-			result.Write(suffix)
-			last = fullEnd
-			continue
+		_, rest, ok := strings.Cut(tail, "/")
+		if !ok {
+			break
 		}
+		tail = rest
+	}
+	return "", false
+}
 
-		if start, end, ok := submatch(m, 2); ok {
-			prefix := data[fullStart:start]
-			domainPart := data[start:end]
-			result.Write(l.wrapBareDomain(prefix, domainPart))
-			last = fullEnd
-			continue
-		}
+// goFramePattern matches the location line of a goroutine stack frame, as
+// race reports ("      /src/foo.go:10 +0x1f") and panics ("\t/src/foo.go:10
+// +0x1f") print it. Group 1 is the path and group 2 the line.
+var goFramePattern = regexp.MustCompile(`(?m)^[ \t]+(\S+\.(?:go|s)):(\d+)(?: \+0x[0-9a-f]+)?\r?$`)
 
-		pathStart, pathEnd, ok := submatch(m, 3)
+// findGoFrame returns the bounds of the path:line, the resolved path and
+// the location of the first goFramePattern line whose file resolves with
+// resolveTail or resolveFilePath, in that order. The program offset after
+// it is left alone.
+func (l *Linker) findGoFrame(data []byte) (start, end int, absPath, loc string) {
+	if !bytes.Contains(data, []byte(".go:")) && !bytes.Contains(data, []byte(".s:")) {
+		return 0, 0, "", ""
+	}
+	for _, m := range goFramePattern.FindAllSubmatchIndex(data, -1) {
+		path := string(data[m[2]:m[3]])
+		absPath, ok := l.resolveTail(path)
 		if !ok {
-			result.Write(data[fullStart:fullEnd])
-			last = fullEnd
-			continue
+			absPath, ok = l.resolveFilePath(path)
 		}
-
-		pathPart := data[pathStart:pathEnd]
-		var locSuffix []byte
-		if start, end, ok := submatch(m, 4); ok {
-			locSuffix = data[start:end]
+		if ok && l.extensionLinked(path, absPath) {
+			return m[2], m[5], absPath, ":" + string(data[m[4]:m[5]])
 		}
+	}
+	return 0, 0, "", ""
+}
 
-		prefix := data[fullStart:pathStart]
-		displayText := append(pathPart, locSuffix...)
+// proseLocationPatterns match locations that tools spell out in words
+// rather than as path:line. Group 1 is the path, group 2 the line and group
+// 3, where there is one, the column.
+var proseLocationPatterns = []*regexp.Regexp{
+	// Terraform: "on main.tf line 10, in resource ..." or "on main.tf line 10:".
+	regexp.MustCompile(`\bon ([^\s'"]+\.[\w.]+) line (\d+)[,:]`),
+	// Ansible: "The error appears to be in '/site/playbook.yml': line 5, column 3".
+	regexp.MustCompile(`\bin '([^'\n]+)': line (\d+)(?:, column (\d+))?`),
+	// PyYAML, as docker compose and ansible-lint report YAML syntax errors:
+	// in "/site/compose.yml", line 5, column 3.
+	regexp.MustCompile(`\bin "([^"\n]+)", line (\d+)(?:, column (\d+))?`),
+}
 
-		if replacement, ok := l.wrapFilePath(prefix, pathPart, locSuffix, displayText); ok {
-			result.Write(replacement)
-		} else {
-			segment := data[fullStart:fullEnd]
-			if l.symbolLinks && styled {
-				result.Write(l.replaceSymbolsStyledSegment(segment))
-			} else {
-				result.Write(segment)
+// findProseLocation returns the bounds of the path, the resolved path and
+// the location of the first proseLocationPatterns match whose path exists
+// and passes LinkExt/NoLinkExt. Only the path is linked; the words around
+// it stay plain text.
+func (l *Linker) findProseLocation(data []byte) (start, end int, absPath, loc string) {
+	if !bytes.Contains(data, []byte(" line ")) {
+		return 0, 0, "", ""
+	}
+	for _, pattern := range proseLocationPatterns {
+		for _, m := range pattern.FindAllSubmatchIndex(data, -1) {
+			path := string(data[m[2]:m[3]])
+			absPath, ok := l.resolveFilePath(path)
+			if !ok || !l.extensionLinked(path, absPath) {
+				continue
+			}
+			loc = ":" + string(data[m[4]:m[5]])
+			if len(m) > 6 && m[6] >= 0 {
+				loc += ":" + string(data[m[6]:m[7]])
 			}
+			return m[2], m[3], absPath, loc
 		}
-		last = fullEnd
 	}
+	return 0, 0, "", ""
+}
 
-	if last < len(data) {
-		segment := data[last:]
-		if l.symbolLinks && styled {
-			result.Write(l.replaceSymbolsStyledSegment(segment))
-		} else {
-			result.Write(segment)
+// goModPattern matches a module path and version as they appear in go.mod
+// ("require github.com/foo/bar v1.2.3", the lines of a require block) and
+// in `go get` output ("go: added github.com/foo/bar v1.2.3"). Group 1 is the
+// directive, or "=>" on the new side of a replace; group 2 the module path,
+// whose first element must contain a dot as Go requires; group 3 the version.
+var goModPattern = regexp.MustCompile(`(?:^|\s)(?:(module|require|replace|exclude|=>)\s+)?([a-z0-9-]+(?:\.[a-z0-9-]+)+(?:/[\w.~-]+)*)(?:\s+(v\d+\.\d+\.\d+[\w.+-]*))?`)
+
+// findGoModule returns the submatch indexes of the first goModPattern match
+// worth linking. Without a version, a module path is only taken from the
+// module directive and the sides of a replace, which may omit it; anything
+// else could be a bare domain in prose.
+func findGoModule(data []byte) []int {
+	for _, m := range goModPattern.FindAllSubmatchIndex(data, -1) {
+		if m[6] >= 0 {
+			return m
+		}
+		if m[2] >= 0 && string(data[m[2]:m[3]]) != "require" && string(data[m[2]:m[3]]) != "exclude" {
+			return m
 		}
 	}
+	return nil
+}
+
+// wrapGoModule links a module path to its pkg.go.dev page and version, if
+// any, to the page of that version. space is the text between the two.
+func (l *Linker) wrapGoModule(result *bytes.Buffer, module, space, version []byte) {
+	result.Write(l.osc8Link("https://pkg.go.dev/"+string(module), module))
+	result.Write(space)
+	if len(version) > 0 {
+		result.Write(l.osc8Link("https://pkg.go.dev/"+string(module)+"@"+string(version), version))
+	}
+}
+
+// wrapGoTestName links a Go test name to its func declaration found through
+// the file index. Unresolved names are written as-is.
+func (l *Linker) wrapGoTestName(result *bytes.Buffer, name []byte) {
+	path, line := l.index.FindGoTestFunc(string(name))
+	if path == "" {
+		result.Write(name)
+		return
+	}
+	result.Write(l.wrapFile(nil, path, ":"+strconv.Itoa(line), name))
+}
 
-	return result.Bytes()
+// mayContainLink is a cheap pre-filter for urlPattern. Every alternative in
+// the pattern needs a '/' (URLs, bare domains, prefixed paths), a '.' (paths
+// with an extension), or the literal "file" (Makefile, Dockerfile, ...), so
+// text without any of them cannot match and the regex scan can be skipped.
+func mayContainLink(data []byte) bool {
+	return bytes.ContainsAny(data, "/.") || bytes.Contains(data, []byte("file"))
 }
 
+// resolvePath returns the absolute path for path. A relative path is
+// looked up under each of the resolution roots in turn (see
+// resolutionRoots), and the first root under which it exists wins; if none
+// has it, the path under the first root is returned.
 func (l *Linker) resolvePath(path string) string {
+	absPath := l.resolvePathIn(l.roots[0], path)
+	if len(l.roots) == 1 || filepath.IsAbs(path) || strings.HasPrefix(path, "~/") || l.pathExists(absPath) {
+		return absPath
+	}
+	for _, root := range l.roots[1:] {
+		if rootPath := l.resolvePathIn(root, path); l.pathExists(rootPath) {
+			return rootPath
+		}
+	}
+	return absPath
+}
+
+// resolvePathIn is resolvePath with relative paths taken relative to base.
+func (l *Linker) resolvePathIn(base, path string) string {
 	var absPath string
 	if strings.HasPrefix(path, "~/") {
 		home, err := os.UserHomeDir()
@@ -321,7 +1929,7 @@ func (l *Linker) resolvePath(path string) string {
 	} else if filepath.IsAbs(path) {
 		absPath = path
 	} else {
-		absPath = filepath.Join(l.cwd, path)
+		absPath = filepath.Join(base, path)
 	}
 
 	resolved, err := filepath.EvalSymlinks(absPath)
@@ -343,29 +1951,335 @@ func (l *Linker) st() string {
 	return "\x1b\\"
 }
 
+// stFor returns the terminator for a link rewritten from an existing one
+// that ended in BEL (bel) or ST. With Terminator "auto" it mirrors the
+// original; otherwise it is st().
+func (l *Linker) stFor(bel bool) string {
+	if l.terminator == "auto" && bel {
+		return "\x07"
+	}
+	return l.st()
+}
+
+// countLink reports whether MaxLinksTotal leaves room for another link,
+// and counts it if so. Every link osc8wrap writes goes through it; past the
+// limit within a Write, callers write the display text instead, and Write
+// passes later ones through.
+func (l *Linker) countLink() bool {
+	if l.maxLinksTotal <= 0 {
+		return true
+	}
+	if l.linksWritten >= l.maxLinksTotal {
+		return false
+	}
+	l.linksWritten++
+	return true
+}
+
 func (l *Linker) osc8Link(url string, display []byte) []byte {
+	return l.osc8LinkWithID("", url, display)
+}
+
+// osc8LinkWithID is osc8Link with an id parameter, which tells terminals
+// that links sharing it (and the URL) are one link, e.g. to underline
+// them all on hover. An empty id is left out.
+func (l *Linker) osc8LinkWithID(id, url string, display []byte) []byte {
+	if !l.countLink() {
+		return display
+	}
+	if l.manifest != nil {
+		l.manifest.add(linkKind(url), url, display)
+	}
 	var buf bytes.Buffer
-	buf.WriteString("\x1b]8;;")
+	buf.WriteString("\x1b]8;")
+	if id != "" {
+		buf.WriteString("id=")
+		buf.WriteString(id)
+	}
+	buf.WriteByte(';')
 	buf.WriteString(url)
 	buf.WriteString(l.st())
 	buf.Write(display)
 	buf.WriteString("\x1b]8;;")
 	buf.WriteString(l.st())
+	buf.WriteString(l.linkMarker)
 	return buf.Bytes()
 }
 
 func (l *Linker) wrapFile(prefix []byte, absPath, locSuffix string, displayText []byte) []byte {
 	var buf bytes.Buffer
 	buf.Write(prefix)
-	buf.Write(l.osc8Link(l.formatFileURL(absPath, locSuffix), displayText))
+	buf.Write(l.osc8LinkWithID(l.fileLinkID(absPath), l.formatFileURL(absPath, locSuffix), l.shortenHome(displayText)))
 	return buf.Bytes()
 }
 
+// fileLinkID returns the OSC 8 id GroupFileLinks gives links to absPath:
+// the diff block number and a hash of the path, so every reference to a
+// file within one "diff --git" block shares an id and the next block
+// starts afresh. It is "" without GroupFileLinks.
+func (l *Linker) fileLinkID(absPath string) string {
+	if !l.groupFileLinks {
+		return ""
+	}
+	h := fnv.New32a()
+	h.Write([]byte(absPath))
+	return fmt.Sprintf("%d-%08x", l.diffBlock, h.Sum32())
+}
+
+// shortenHome replaces the home directory prefix of an absolute display path
+// with "~", mirroring shell prompts. Relative display text is left alone.
+func (l *Linker) shortenHome(displayText []byte) []byte {
+	if l.homeDir == "" {
+		return displayText
+	}
+	rest, ok := bytes.CutPrefix(displayText, []byte(l.homeDir+"/"))
+	if !ok {
+		return displayText
+	}
+	return append([]byte("~/"), rest...)
+}
+
 func (l *Linker) formatFileURL(absPath, locSuffix string) string {
-	if l.scheme == "file" {
+	if locSuffix == "" && l.linkLines != nil {
+		locSuffix = l.defaultLine(absPath)
+	}
+	if l.remoteMap != "" {
+		return expandRemoteTemplate(l.remoteMap, l.hostname, absPath, normalizeLocSuffix(locSuffix))
+	}
+	scheme := l.scheme
+	if l.assetScheme != "" && isAssetPath(absPath) {
+		scheme = l.assetScheme
+	}
+	if scheme == "file" {
 		return "file://" + l.hostname + absPath
 	}
-	return l.scheme + "://file" + absPath + normalizeLocSuffix(locSuffix)
+	if isJetBrainsScheme(scheme) {
+		return formatJetBrainsURL(scheme, absPath, normalizeLocSuffix(locSuffix))
+	}
+	if format, ok := openURLSchemes[scheme]; ok {
+		return format.url(scheme, absPath, normalizeLocSuffix(locSuffix))
+	}
+	return scheme + "://file" + absPath + normalizeLocSuffix(locSuffix)
+}
+
+// assetExtensions are the image, font and media files that AssetScheme
+// applies to.
+var assetExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true,
+	".avif": true, ".bmp": true, ".ico": true, ".svg": true, ".tif": true, ".tiff": true,
+	".woff": true, ".woff2": true, ".ttf": true, ".otf": true, ".eot": true,
+	".mp3": true, ".wav": true, ".ogg": true, ".mp4": true, ".webm": true, ".mov": true,
+}
+
+func isAssetPath(path string) bool {
+	return assetExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// fileURLPath returns the path to resolve for a matched path: the path
+// itself, or for a file:///path URL (as in ES module stack traces) the
+// percent-decoded path it names.
+func fileURLPath(path []byte) string {
+	rest, ok := bytes.CutPrefix(path, []byte("file://"))
+	if !ok {
+		return string(path)
+	}
+	if unescaped, err := url.PathUnescape(string(rest)); err == nil {
+		return unescaped
+	}
+	return string(rest)
+}
+
+// pseudoFiles are the names compilers and interpreters put in angle
+// brackets where a file would go: "<stdin>:5:10: error", "<built-in>",
+// `File "<frozen importlib._bootstrap>", line 241`. Names ending in a space
+// are prefixes.
+var pseudoFiles = []string{
+	"stdin", "stdout", "stderr", "built-in", "command-line", "command line",
+	"string", "eval", "input", "console", "anonymous", "unknown", "autogenerated",
+	"frozen ", "doctest ",
+}
+
+// isPseudoFile reports whether the path matched at data[pathStart:] sits
+// inside a pseudo-file name such as "<frozen importlib._bootstrap>", so it
+// is not resolved against a real file that happens to share the name.
+func isPseudoFile(data []byte, pathStart int) bool {
+	open := bytes.LastIndexByte(data[:pathStart], '<')
+	if open < 0 || bytes.ContainsAny(data[open:pathStart], ">\n") {
+		return false
+	}
+	name := data[open+1:]
+	if end := bytes.IndexByte(name, '>'); end >= 0 {
+		name = name[:end]
+	} else {
+		return false
+	}
+	for _, pseudo := range pseudoFiles {
+		if strings.HasSuffix(pseudo, " ") && bytes.HasPrefix(name, []byte(pseudo)) || string(name) == pseudo {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRequireLocation checks a --require-location mode: "all" links only
+// paths followed by :line, "bare" lets paths starting with /, ~/, ./ or ../
+// through without one.
+func parseRequireLocation(s string) (string, error) {
+	switch s {
+	case "all", "bare":
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown mode %q (want all or bare)", s)
+}
+
+// locationRequired reports whether RequireLocation keeps path from being
+// linked when it has no :line suffix.
+func (l *Linker) locationRequired(path []byte) bool {
+	switch l.requireLocation {
+	case "all":
+		return true
+	case "bare":
+		return !isExplicitPath(path)
+	}
+	return false
+}
+
+// isExplicitPath reports whether path starts with /, ~/, ./, ../ or file:///, i.e.
+// was written as a path rather than a bare name.
+func isExplicitPath(path []byte) bool {
+	for _, prefix := range []string{"/", "~/", "./", "../", "file:///"} {
+		if bytes.HasPrefix(path, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseLinkLines parses --link-lines entries, "NAME:LINE", into a map from
+// NAME to ":LINE".
+func parseLinkLines(entries []string) (map[string]string, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	lines := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		i := strings.LastIndexByte(entry, ':')
+		if i <= 0 {
+			return nil, fmt.Errorf("%q is not NAME:LINE", entry)
+		}
+		line, err := strconv.Atoi(entry[i+1:])
+		if err != nil || line < 1 {
+			return nil, fmt.Errorf("%q: line must be a positive number", entry)
+		}
+		lines[entry[:i]] = ":" + strconv.Itoa(line)
+	}
+	return lines, nil
+}
+
+// defaultLine returns the LinkLines location for a file linked without a
+// line. A NAME with a slash is matched against the path relative to the
+// working directory, or the absolute path; one without against the
+// basename, as with --no-watch-dir.
+func (l *Linker) defaultLine(absPath string) string {
+	if loc, ok := l.linkLines[filepath.Base(absPath)]; ok {
+		return loc
+	}
+	if loc, ok := l.linkLines[absPath]; ok {
+		return loc
+	}
+	if rel, err := filepath.Rel(l.cwd, absPath); err == nil {
+		return l.linkLines[rel]
+	}
+	return ""
+}
+
+// extensionSet turns a LinkExt or NoLinkExt list into a set, accepting
+// "go", ".go" and "GO" alike.
+func extensionSet(exts []string) map[string]bool {
+	if len(exts) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(exts))
+	for _, ext := range exts {
+		set[strings.ToLower(strings.TrimPrefix(ext, "."))] = true
+	}
+	return set
+}
+
+// extensionLinked applies NoLinkExt and LinkExt to a resolved path, given as
+// matched and as resolved. The denylist always applies. The allowlist only
+// restricts files that have an extension and were not written with an
+// explicit ./ prefix, so Makefile, directories and ./configure stay linked.
+func (l *Linker) extensionLinked(matched, absPath string) bool {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(absPath), "."))
+	if l.noLinkExt[ext] {
+		return false
+	}
+	if l.linkExt == nil || ext == "" || strings.HasPrefix(matched, "./") {
+		return true
+	}
+	return l.linkExt[ext]
+}
+
+// jetBrainsSchemes are the URL schemes registered by JetBrains IDEs, which
+// take the file and position as query parameters instead of a path.
+var jetBrainsSchemes = map[string]bool{
+	"idea":      true,
+	"pycharm":   true,
+	"goland":    true,
+	"webstorm":  true,
+	"phpstorm":  true,
+	"rubymine":  true,
+	"clion":     true,
+	"rider":     true,
+	"datagrip":  true,
+	"dataspell": true,
+	"rustrover": true,
+	"aqua":      true,
+}
+
+func isJetBrainsScheme(scheme string) bool {
+	return jetBrainsSchemes[scheme]
+}
+
+// formatJetBrainsURL builds scheme://open?file=PATH&line=N&column=M from a
+// normalized ":line:col" location.
+func formatJetBrainsURL(scheme, absPath, loc string) string {
+	u := scheme + "://open?file=" + url.QueryEscape(absPath)
+	line, col, _ := strings.Cut(strings.TrimPrefix(loc, ":"), ":")
+	if line != "" {
+		u += "&line=" + line
+	}
+	if col != "" {
+		u += "&column=" + col
+	}
+	return u
+}
+
+// openURLFormat is the scheme://open?url=file://PATH&line=N form that
+// TextMate and the URL handlers for Sublime Text, Emacs and Neovim accept.
+// The embedded file:// URL is percent-encoded as a whole.
+type openURLFormat struct {
+	column bool // the handler also takes &column=
+}
+
+var openURLSchemes = map[string]openURLFormat{
+	"subl":  {column: true},
+	"txmt":  {},
+	"emacs": {},
+	"nvim":  {},
+}
+
+func (f openURLFormat) url(scheme, absPath, loc string) string {
+	u := scheme + "://open?url=" + url.QueryEscape("file://"+absPath)
+	line, col, _ := strings.Cut(strings.TrimPrefix(loc, ":"), ":")
+	if line != "" {
+		u += "&line=" + line
+	}
+	if col != "" && f.column {
+		u += "&column=" + col
+	}
+	return u
 }
 
 func normalizeLocSuffix(s string) string {
@@ -380,6 +2294,11 @@ func normalizeLocSuffix(s string) string {
 	return s
 }
 
+// maxURLLength bounds the URLs that get linked. Anything longer is almost
+// certainly an encoded blob rather than an address someone will click, and
+// many terminals drop or truncate OSC 8 URIs beyond a few KiB anyway.
+const maxURLLength = 2048
+
 func (l *Linker) wrapURL(url []byte) ([]byte, []byte) {
 	url, suffix := trimURLSuffix(url)
 	return l.osc8Link(string(url), url), suffix
@@ -402,33 +2321,49 @@ func (l *Linker) wrapBareDomain(prefix, domain []byte) []byte {
 	return buf.Bytes()
 }
 
-func (l *Linker) wrapFilePath(prefix, pathPart, locSuffix, displayText []byte) ([]byte, bool) {
-	pathStr := string(pathPart)
+// resolveFilePath maps a path found in the output to an existing absolute
+// path: literally, then without a git diff a/ or b/ prefix, then under
+// ExtractDir, and finally through the basename index.
+func (l *Linker) resolveFilePath(pathStr string) (string, bool) {
 	absPath := l.resolvePath(pathStr)
 	if absPath == "" {
-		return nil, false
+		return "", false
 	}
 
 	if l.pathExists(absPath) {
-		return l.wrapFile(prefix, absPath, string(locSuffix), displayText), true
+		return absPath, true
 	}
 
 	// Try stripping git diff a/ or b/ prefix
 	if stripped, ok := stripGitDiffPrefix(pathStr); ok {
 		strippedAbs := l.resolvePath(stripped)
 		if strippedAbs != "" && l.pathExists(strippedAbs) {
-			return l.wrapFile(prefix, strippedAbs, string(locSuffix), displayText), true
+			return strippedAbs, true
 		}
 	}
 
-	if !l.resolveBasename {
-		return nil, false
+	// Members listed by `tar xvf` or `unzip` are relative to the extraction
+	// directory, which need not be the cwd.
+	if l.extractDir != "" && !filepath.IsAbs(pathStr) && !strings.HasPrefix(pathStr, "~/") {
+		extractedAbs := l.resolvePathIn(l.extractDir, pathStr)
+		if l.pathExists(extractedAbs) {
+			return extractedAbs, true
+		}
 	}
-	absPath = l.index.Resolve(pathStr)
-	if absPath == "" {
-		return nil, false
+
+	if l.resolveBasename {
+		if absPath = l.index.Resolve(pathStr); absPath != "" {
+			return absPath, true
+		}
+	}
+
+	// Last resort: ask the user's resolver, for layouts only it knows.
+	if l.resolver != nil {
+		if absPath = l.resolver.Resolve(pathStr); absPath != "" && l.pathExists(absPath) {
+			return absPath, true
+		}
 	}
-	return l.wrapFile(prefix, absPath, string(locSuffix), displayText), true
+	return "", false
 }
 
 // stripGitDiffPrefix removes the "a/" or "b/" prefix that git diff adds to file paths.
@@ -439,6 +2374,14 @@ func stripGitDiffPrefix(path string) (string, bool) {
 	return "", false
 }
 
+// ShareIndex makes l resolve basenames with other's file index instead of
+// its own, so a Linker for a second stream of the same command, such as
+// --separate-stderr's, does not index and watch the tree again. Call it
+// before either Linker is written to; only other's indexer is started.
+func (l *Linker) ShareIndex(other *Linker) {
+	l.index = other.index
+}
+
 func (l *Linker) StartIndexer(ctx context.Context) {
 	if !l.resolveBasename {
 		return
@@ -453,54 +2396,82 @@ func (l *Linker) WaitForIndex(ctx context.Context) error {
 	return l.index.Wait(ctx)
 }
 
-// replaceSymbolsStyledSegment links identifiers in a styled text segment.
+// replaceSymbolsStyledSegment links identifiers in a styled text segment,
+// writing the result to result.
 // It tracks dot-separated chains (e.g. "vscode.window.showMessage") so that
 // each word's link carries the full qualified name up to that point, helping
 // symbol-opener disambiguate common names like "Window".
-func (l *Linker) replaceSymbolsStyledSegment(data []byte) []byte {
-	var result bytes.Buffer
+func (l *Linker) replaceSymbolsStyledSegment(result *bytes.Buffer, data []byte) {
 	// qualifiedName accumulates the dot-separated chain seen so far,
 	// e.g. "ProgressLocation" → "ProgressLocation.Window"
 	var qualifiedName []byte
 	for i := 0; i < len(data); {
-		if !isWordChar(data[i]) {
+		r, size := utf8.DecodeRune(data[i:])
+		if !isWordRune(r) {
 			// A dot between two words continues the qualified chain
 			// rather than resetting it, so "Foo.Bar" links Bar as "Foo.Bar".
-			if data[i] == '.' && len(qualifiedName) > 0 && i+1 < len(data) && isWordChar(data[i+1]) {
+			if r == '.' && len(qualifiedName) > 0 && startsWithWordRune(data[i+1:]) {
 				result.WriteByte('.')
 				qualifiedName = append(qualifiedName, '.')
 				i++
 				continue
 			}
 			qualifiedName = qualifiedName[:0]
-			result.WriteByte(data[i])
-			i++
+			result.Write(data[i : i+size])
+			i += size
 			continue
 		}
 
 		start := i
-		for i < len(data) && isWordChar(data[i]) {
-			i++
+		for i < len(data) && startsWithWordRune(data[i:]) {
+			_, size := utf8.DecodeRune(data[i:])
+			i += size
 		}
 		word := data[start:i]
 		qualifiedName = append(qualifiedName, word...)
 
-		if len(word) >= 3 {
+		if utf8.RuneCount(word) >= 3 {
 			isFunction := i < len(data) && data[i] == '('
 			// word is the display text; qualifiedName is used in the URL
-			result.Write(l.wrapSymbol(nil, word, qualifiedName, isFunction))
+			l.wrapSymbol(result, word, qualifiedName, isFunction)
 		} else {
 			result.Write(word)
 		}
 	}
-
-	return result.Bytes()
 }
 
 func isWordChar(b byte) bool {
 	return b == '_' || (b >= '0' && b <= '9') || (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z')
 }
 
+// isWordRune is isWordChar for identifiers in any script: Go, Python and
+// JavaScript all allow Unicode letters and digits, as in naïveHandler.
+func isWordRune(r rune) bool {
+	if r < utf8.RuneSelf {
+		return isWordChar(byte(r))
+	}
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func startsWithWordRune(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	r, _ := utf8.DecodeRune(data)
+	return isWordRune(r)
+}
+
+// escapeClass backslash-escapes every character of s for use inside a
+// regexp character class. Only punctuation is expected here.
+func escapeClass(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		b.WriteByte('\\')
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
 func submatch(match []int, group int) (start, end int, ok bool) {
 	// submatch indices are 2 slots per group: [start, end].
 	idx := group * 2
@@ -515,25 +2486,40 @@ func submatch(match []int, group int) (start, end int, ok bool) {
 	return start, end, true
 }
 
-// wrapSymbol wraps display text in an OSC 8 hyperlink pointing to symbol-opener.
-// display is the visible text and symbol is used in the URL query parameter.
-// They differ for qualified names: for "ProgressLocation.Window", the second
-// word is wrapped with display="Window" and symbol="ProgressLocation.Window".
+// wrapSymbol writes display text wrapped in an OSC 8 hyperlink pointing to
+// symbol-opener. display is the visible text and symbol is used in the URL
+// query parameter. They differ for qualified names: for
+// "ProgressLocation.Window", the second word is wrapped with display="Window"
+// and symbol="ProgressLocation.Window".
 //
-// Returns: {prefix}ESC]8;;{scheme}://maaashjp.symbol-opener?symbol={symbol}&cwd={cwd}[&kind=Function]ST{display}ESC]8;;ST
-func (l *Linker) wrapSymbol(prefix, display, symbol []byte, isFunction bool) []byte {
-	var urlBuf bytes.Buffer
-	urlBuf.WriteString(l.scheme)
-	urlBuf.WriteString("://maaashjp.symbol-opener?symbol=")
-	urlBuf.Write(symbol)
-	urlBuf.WriteString("&cwd=")
-	urlBuf.WriteString(l.cwd)
+// Writes: ESC]8;;{scheme}://maaashjp.symbol-opener?symbol={symbol}&cwd={cwd}[&kind=Function]ST{display}ESC]8;;ST
+//
+// The URL is assembled directly in buf so that symbol-heavy output does not
+// allocate per word.
+func (l *Linker) wrapSymbol(buf *bytes.Buffer, display, symbol []byte, isFunction bool) {
+	if !l.countLink() {
+		buf.Write(display)
+		return
+	}
+	if l.manifest != nil {
+		url := l.scheme + "://maaashjp.symbol-opener?symbol=" + string(symbol) + "&cwd=" + l.cwd
+		if isFunction {
+			url += "&kind=Function"
+		}
+		l.manifest.add("symbol", url, display)
+	}
+	buf.WriteString("\x1b]8;;")
+	buf.WriteString(l.scheme)
+	buf.WriteString("://maaashjp.symbol-opener?symbol=")
+	buf.Write(symbol)
+	buf.WriteString("&cwd=")
+	buf.WriteString(l.cwd)
 	if isFunction {
-		urlBuf.WriteString("&kind=Function")
+		buf.WriteString("&kind=Function")
 	}
-
-	var buf bytes.Buffer
-	buf.Write(prefix)
-	buf.Write(l.osc8Link(urlBuf.String(), display))
-	return buf.Bytes()
+	buf.WriteString(l.st())
+	buf.Write(display)
+	buf.WriteString("\x1b]8;;")
+	buf.WriteString(l.st())
+	buf.WriteString(l.linkMarker)
 }
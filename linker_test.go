@@ -3,10 +3,21 @@ package main
 import (
 	"bytes"
 	"context"
+	"errors"
+	"io"
+	"maps"
+	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
+
+	"github.com/mash/osc8wrap/ansitoken"
 )
 
 func assertWrite(t *testing.T, linker *Linker, input, expected string) {
@@ -243,6 +254,102 @@ func TestLinker_Write(t *testing.T) {
 			cwd:      tmpDir,
 			expected: "open " + tmpDir + "/存在しないファイル.xlsx\n",
 		},
+		{
+			name:     "env assignment with absolute path",
+			input:    "CONFIG_FILE=" + testFile + "\n",
+			cwd:      tmpDir,
+			expected: "CONFIG_FILE=\x1b]8;;file://testhost" + testFile + "\x1b\\" + testFile + "\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "env assignment with relative path",
+			input:    "CONFIG=./test.go\n",
+			cwd:      tmpDir,
+			expected: "CONFIG=\x1b]8;;file://testhost" + testFile + "\x1b\\./test.go\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "env assignment with bare filename",
+			input:    "CONFIG=test.go\n",
+			cwd:      tmpDir,
+			expected: "CONFIG=\x1b]8;;file://testhost" + testFile + "\x1b\\test.go\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "docker --env assignment",
+			input:    "--env CONFIG=" + testFile + "\n",
+			cwd:      tmpDir,
+			expected: "--env CONFIG=\x1b]8;;file://testhost" + testFile + "\x1b\\" + testFile + "\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "report written to relative generated file",
+			input:    "coverage report written to test.go\n",
+			cwd:      tmpDir,
+			expected: "coverage report written to \x1b]8;;file://testhost" + testFile + "\x1b\\test.go\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "wrote profile to absolute path",
+			input:    "wrote profile to " + testFile + "\n",
+			cwd:      tmpDir,
+			expected: "wrote profile to \x1b]8;;file://testhost" + testFile + "\x1b\\" + testFile + "\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "saved to relative path ending a sentence",
+			input:    "Results saved to ./test.go.\n",
+			cwd:      tmpDir,
+			expected: "Results saved to \x1b]8;;file://testhost" + testFile + "\x1b\\./test.go\x1b]8;;\x1b\\.\n",
+		},
+		{
+			name:     "written to absolute path ending a sentence",
+			input:    "Report written to " + testFile + ".\n",
+			cwd:      tmpDir,
+			expected: "Report written to \x1b]8;;file://testhost" + testFile + "\x1b\\" + testFile + "\x1b]8;;\x1b\\.\n",
+		},
+		{
+			name:     "output: label before path",
+			input:    "output: " + testFile + "\n",
+			cwd:      tmpDir,
+			expected: "output: \x1b]8;;file://testhost" + testFile + "\x1b\\" + testFile + "\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "quoted generated file path",
+			input:    "wrote \"" + testFile + "\"\n",
+			cwd:      tmpDir,
+			expected: "wrote \"\x1b]8;;file://testhost" + testFile + "\x1b\\" + testFile + "\x1b]8;;\x1b\\\"\n",
+		},
+		{
+			name:     "cargo Compiling line links the crate directory",
+			input:    "   Compiling foo v0.1.0 (" + tmpDir + ")\n",
+			cwd:      tmpDir,
+			expected: "   Compiling foo v0.1.0 (\x1b]8;;file://testhost" + tmpDir + "\x1b\\" + tmpDir + "\x1b]8;;\x1b\\)\n",
+		},
+		{
+			name:     "colored cargo Compiling line links the crate directory",
+			input:    "\x1b[1m\x1b[32m   Compiling\x1b[0m foo v0.1.0 (" + tmpDir + ")\n",
+			cwd:      tmpDir,
+			expected: "\x1b[1m\x1b[32m   Compiling\x1b[0m foo v0.1.0 (\x1b]8;;file://testhost" + tmpDir + "\x1b\\" + tmpDir + "\x1b]8;;\x1b\\)\n",
+		},
+		{
+			name:     "cargo Checking line with missing directory stays text",
+			input:    "    Checking foo v0.1.0 (/nonexistent/foo)\n",
+			cwd:      tmpDir,
+			expected: "    Checking foo v0.1.0 (/nonexistent/foo)\n",
+		},
+		{
+			name:     "URL at the length limit is linked",
+			input:    "https://example.com/" + strings.Repeat("a", maxURLLength-len("https://example.com/")) + "\n",
+			cwd:      tmpDir,
+			expected: "\x1b]8;;https://example.com/" + strings.Repeat("a", maxURLLength-len("https://example.com/")) + "\x1b\\https://example.com/" + strings.Repeat("a", maxURLLength-len("https://example.com/")) + "\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "URL over the length limit passes through",
+			input:    "https://example.com/" + strings.Repeat("a", maxURLLength) + "\n",
+			cwd:      tmpDir,
+			expected: "https://example.com/" + strings.Repeat("a", maxURLLength) + "\n",
+		},
+		{
+			name:     "data URL is not linked",
+			input:    "src=data:image/png;base64," + strings.Repeat("iVBORw0KGgo", 400) + "\n",
+			cwd:      tmpDir,
+			expected: "src=data:image/png;base64," + strings.Repeat("iVBORw0KGgo", 400) + "\n",
+		},
 	}
 
 	for _, tt := range tests {
@@ -304,6 +411,146 @@ func TestLinker_OutputsWithoutNewline(t *testing.T) {
 	}
 }
 
+func TestLinker_LineBuffered(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "main.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+
+	newLinker := func(buf *bytes.Buffer) *Linker {
+		return NewLinker(LinkerOptions{
+			Output:       buf,
+			Cwd:          tmpDir,
+			Hostname:     "testhost",
+			Scheme:       "file",
+			Domains:      []string{"github.com"},
+			LineBuffered: true,
+		})
+	}
+
+	t.Run("path split across writes is linked", func(t *testing.T) {
+		var buf bytes.Buffer
+		linker := newLinker(&buf)
+		half := len(testFile) / 2
+
+		_, _ = linker.Write([]byte("first line\nerror in " + testFile[:half]))
+		if got := buf.String(); got != "first line\n" {
+			t.Errorf("after first write: got %q, want %q", got, "first line\n")
+		}
+
+		_, _ = linker.Write([]byte(testFile[half:] + ":42\n"))
+		want := "first line\nerror in \x1b]8;;file://testhost" + testFile + "\x1b\\" + testFile + ":42\x1b]8;;\x1b\\\n"
+		if got := buf.String(); got != want {
+			t.Errorf("after second write: got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("flush emits the held partial line", func(t *testing.T) {
+		var buf bytes.Buffer
+		linker := newLinker(&buf)
+
+		_, _ = linker.Write([]byte("prompt> "))
+		if got := buf.String(); got != "" {
+			t.Errorf("before flush: got %q, want empty", got)
+		}
+		if err := linker.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != "prompt> " {
+			t.Errorf("after flush: got %q, want %q", got, "prompt> ")
+		}
+	})
+
+	t.Run("overlong partial line is released", func(t *testing.T) {
+		var buf bytes.Buffer
+		linker := newLinker(&buf)
+
+		long := bytes.Repeat([]byte("x"), maxHeldLine+1)
+		_, _ = linker.Write(long)
+		if got := buf.Len(); got != len(long) {
+			t.Errorf("got %d bytes, want %d", got, len(long))
+		}
+	})
+}
+
+type fakeTimer struct {
+	stopped bool
+}
+
+func (f *fakeTimer) Stop() bool {
+	f.stopped = true
+	return true
+}
+
+func TestLinker_IdleFlush(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	var buf bytes.Buffer
+	linker := NewLinker(LinkerOptions{
+		Output:       &buf,
+		Cwd:          tmpDir,
+		Hostname:     "testhost",
+		Scheme:       "file",
+		Domains:      []string{"github.com"},
+		LineBuffered: true,
+		IdleFlush:    50 * time.Millisecond,
+	})
+
+	fired := make(chan func(), 4)
+	var timers []*fakeTimer
+	linker.afterFunc = func(d time.Duration, f func()) stopper {
+		if d != 50*time.Millisecond {
+			t.Errorf("idle flush armed with %v, want 50ms", d)
+		}
+		fired <- f
+		timer := &fakeTimer{}
+		timers = append(timers, timer)
+		return timer
+	}
+
+	_, _ = linker.Write([]byte("Continue? [y/N] "))
+	if got := buf.String(); got != "" {
+		t.Fatalf("before idle flush: got %q, want empty", got)
+	}
+
+	(<-fired)()
+	if got := buf.String(); got != "Continue? [y/N] " {
+		t.Fatalf("after idle flush: got %q, want %q", got, "Continue? [y/N] ")
+	}
+
+	t.Run("write re-arms and makes earlier timers stale", func(t *testing.T) {
+		buf.Reset()
+		_, _ = linker.Write([]byte("a"))
+		stale := <-fired
+		_, _ = linker.Write([]byte("b"))
+		current := <-fired
+		if !timers[len(timers)-2].stopped {
+			t.Error("previous timer was not stopped on re-arm")
+		}
+
+		stale()
+		if got := buf.String(); got != "" {
+			t.Fatalf("stale timer flushed %q", got)
+		}
+		current()
+		if got := buf.String(); got != "ab" {
+			t.Fatalf("got %q, want %q", got, "ab")
+		}
+	})
+
+	t.Run("complete lines do not arm the timer", func(t *testing.T) {
+		buf.Reset()
+		_, _ = linker.Write([]byte("done\n"))
+		select {
+		case <-fired:
+			t.Fatal("timer armed with nothing held")
+		default:
+		}
+		if got := buf.String(); got != "done\n" {
+			t.Fatalf("got %q, want %q", got, "done\n")
+		}
+	})
+}
+
 func TestLinker_Schemes(t *testing.T) {
 	tmpDir := t.TempDir()
 	testFile := filepath.Join(tmpDir, "test.go")
@@ -363,6 +610,42 @@ func TestLinker_Schemes(t *testing.T) {
 			input:    testFile + ":12-24\n",
 			expected: "\x1b]8;;cursor://file" + testFile + ":12:1\x1b\\" + testFile + ":12-24\x1b]8;;\x1b\\\n",
 		},
+		{
+			name:     "subl scheme with line and column",
+			scheme:   "subl",
+			input:    testFile + ":42:10\n",
+			expected: "\x1b]8;;subl://open?url=" + url.QueryEscape("file://"+testFile) + "&line=42&column=10\x1b\\" + testFile + ":42:10\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "subl scheme with line only",
+			scheme:   "subl",
+			input:    testFile + ":42\n",
+			expected: "\x1b]8;;subl://open?url=" + url.QueryEscape("file://"+testFile) + "&line=42\x1b\\" + testFile + ":42\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "subl scheme with range format converts to line:col",
+			scheme:   "subl",
+			input:    testFile + ":12-24\n",
+			expected: "\x1b]8;;subl://open?url=" + url.QueryEscape("file://"+testFile) + "&line=12&column=1\x1b\\" + testFile + ":12-24\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "txmt scheme drops the column",
+			scheme:   "txmt",
+			input:    testFile + ":42:10\n",
+			expected: "\x1b]8;;txmt://open?url=" + url.QueryEscape("file://"+testFile) + "&line=42\x1b\\" + testFile + ":42:10\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "txmt scheme with line only",
+			scheme:   "txmt",
+			input:    testFile + ":42\n",
+			expected: "\x1b]8;;txmt://open?url=" + url.QueryEscape("file://"+testFile) + "&line=42\x1b\\" + testFile + ":42\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "txmt scheme with range format uses the start line",
+			scheme:   "txmt",
+			input:    testFile + ":12-24\n",
+			expected: "\x1b]8;;txmt://open?url=" + url.QueryEscape("file://"+testFile) + "&line=12\x1b\\" + testFile + ":12-24\x1b]8;;\x1b\\\n",
+		},
 		{
 			name:     "empty scheme defaults to file",
 			scheme:   "",
@@ -387,111 +670,166 @@ func TestLinker_Schemes(t *testing.T) {
 	}
 }
 
-func TestLinker_BareDomains(t *testing.T) {
+func TestLinker_FileHost(t *testing.T) {
 	tmpDir := t.TempDir()
-	hostname := "testhost"
+	testFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "test.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
 
 	tests := []struct {
 		name     string
-		domains  []string
+		hostname string
+		scheme   string
 		input    string
 		expected string
 	}{
 		{
-			name:     "https github.com unchanged",
-			domains:  []string{"github.com"},
-			input:    "https://github.com/mash/osc8wrap",
-			expected: "\x1b]8;;https://github.com/mash/osc8wrap\x1b\\https://github.com/mash/osc8wrap\x1b]8;;\x1b\\",
+			name:     "remote host",
+			hostname: "devbox",
+			input:    "test.go:3\n",
+			expected: "\x1b]8;;file://devbox" + testFile + "\x1b\\test.go:3\x1b]8;;\x1b\\\n",
 		},
 		{
-			name:     "bare github.com",
-			domains:  []string{"github.com"},
-			input:    "github.com/mash/osc8wrap",
-			expected: "\x1b]8;;https://github.com/mash/osc8wrap\x1b\\github.com/mash/osc8wrap\x1b]8;;\x1b\\",
+			name:     "empty host",
+			hostname: "",
+			input:    "test.go:3\n",
+			expected: "\x1b]8;;file://" + testFile + "\x1b\\test.go:3\x1b]8;;\x1b\\\n",
 		},
 		{
-			name:     "bare github.com with path",
-			domains:  []string{"github.com"},
-			input:    "see github.com/user/repo/issues/123",
-			expected: "see \x1b]8;;https://github.com/user/repo/issues/123\x1b\\github.com/user/repo/issues/123\x1b]8;;\x1b\\",
+			name:     "empty host leaves editor schemes alone",
+			hostname: "",
+			scheme:   "vscode",
+			input:    "test.go:3\n",
+			expected: "\x1b]8;;vscode://file" + testFile + ":3\x1b\\test.go:3\x1b]8;;\x1b\\\n",
 		},
 		{
-			name:     "mixed https and bare",
-			domains:  []string{"github.com"},
-			input:    "https://github.com/a and github.com/b",
-			expected: "\x1b]8;;https://github.com/a\x1b\\https://github.com/a\x1b]8;;\x1b\\ and \x1b]8;;https://github.com/b\x1b\\github.com/b\x1b]8;;\x1b\\",
+			name:     "file link naming the overridden host is rewritten",
+			hostname: "devbox",
+			scheme:   "vscode",
+			input:    "\x1b]8;;file://devbox/tmp/x.go\x1b\\x.go\x1b]8;;\x1b\\\n",
+			expected: "\x1b]8;;vscode://file/tmp/x.go\x1b\\x.go\x1b]8;;\x1b\\\n",
 		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:   &buf,
+				Cwd:      tmpDir,
+				Hostname: tt.hostname,
+				Scheme:   tt.scheme,
+				Domains:  []string{"github.com"},
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_RemoteMap(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "test.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+
+	tests := []struct {
+		name      string
+		remoteMap string
+		input     string
+		wantURL   string
+	}{
 		{
-			name:     "custom domain gitlab.com",
-			domains:  []string{"gitlab.com"},
-			input:    "gitlab.com/user/repo",
-			expected: "\x1b]8;;https://gitlab.com/user/repo\x1b\\gitlab.com/user/repo\x1b]8;;\x1b\\",
+			name:      "vscode preset with line and column",
+			remoteMap: "vscode",
+			input:     "test.go:42:7",
+			wantURL:   "vscode://vscode-remote/ssh-remote+devbox" + testFile + ":42:7",
 		},
 		{
-			name:     "multiple domains",
-			domains:  []string{"github.com", "gitlab.com"},
-			input:    "github.com/a and gitlab.com/b",
-			expected: "\x1b]8;;https://github.com/a\x1b\\github.com/a\x1b]8;;\x1b\\ and \x1b]8;;https://gitlab.com/b\x1b\\gitlab.com/b\x1b]8;;\x1b\\",
+			name:      "cursor preset without line",
+			remoteMap: "cursor",
+			input:     "test.go",
+			wantURL:   "cursor://vscode-remote/ssh-remote+devbox" + testFile,
 		},
 		{
-			name:     "unlisted domain not linked",
-			domains:  []string{"github.com"},
-			input:    "gitlab.com/user/repo",
-			expected: "gitlab.com/user/repo",
+			name:      "vscode preset with range",
+			remoteMap: "vscode",
+			input:     "test.go:12-24",
+			wantURL:   "vscode://vscode-remote/ssh-remote+devbox" + testFile + ":12:1",
 		},
 		{
-			name:     "empty domains disables bare linking",
-			domains:  nil,
-			input:    "github.com/user/repo",
-			expected: "github.com/user/repo",
+			name:      "custom template",
+			remoteMap: "myeditor://ssh/{host}{path}?line={line}&col={col}",
+			input:     "test.go:42:7",
+			wantURL:   "myeditor://ssh/devbox" + testFile + "?line=42&col=7",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			remoteMap, err := parseRemoteMap(tt.remoteMap)
+			if err != nil {
+				t.Fatal(err)
+			}
 			var buf bytes.Buffer
 			linker := NewLinker(LinkerOptions{
-				Output:   &buf,
-				Cwd:      tmpDir,
-				Hostname: hostname,
-				Scheme:   "file",
-				Domains:  tt.domains,
+				Output:    &buf,
+				Cwd:       tmpDir,
+				Hostname:  "devbox",
+				Scheme:    "vscode",
+				Domains:   []string{"github.com"},
+				RemoteMap: remoteMap,
 			})
 
-			assertWrite(t, linker, tt.input, tt.expected)
+			assertWrite(t, linker, tt.input+"\n", "\x1b]8;;"+tt.wantURL+"\x1b\\"+tt.input+"\x1b]8;;\x1b\\\n")
 		})
 	}
 }
 
-func TestLinker_BasenameResolution(t *testing.T) {
+func TestLinker_JetBrainsSchemes(t *testing.T) {
 	tmpDir := t.TempDir()
-	hostname := "testhost"
-
-	srcDir := filepath.Join(tmpDir, "src")
-	if err := os.MkdirAll(srcDir, 0755); err != nil {
-		t.Fatal(err)
-	}
-	testFile := filepath.Join(srcDir, "main.go")
-	if err := os.WriteFile(testFile, []byte("package main"), 0644); err != nil {
+	testFile := filepath.Join(tmpDir, "a+b@ü.go")
+	if err := os.WriteFile(testFile, []byte("test"), 0644); err != nil {
 		t.Fatal(err)
 	}
 	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
 	testFile, _ = filepath.EvalSymlinks(testFile)
+	escaped := url.QueryEscape(testFile)
+	plainFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "test.go"))
 
 	tests := []struct {
 		name     string
+		scheme   string
 		input    string
 		expected string
 	}{
 		{
-			name:     "basename only resolves via index",
-			input:    "error in main.go:10\n",
-			expected: "error in \x1b]8;;file://testhost" + testFile + "\x1b\\main.go:10\x1b]8;;\x1b\\\n",
+			name:     "idea scheme with line and column",
+			scheme:   "idea",
+			input:    plainFile + ":42:7\n",
+			expected: "\x1b]8;;idea://open?file=" + url.QueryEscape(plainFile) + "&line=42&column=7\x1b\\" + plainFile + ":42:7\x1b]8;;\x1b\\\n",
 		},
 		{
-			name:     "relative path still works",
-			input:    "error in ./src/main.go:10\n",
-			expected: "error in \x1b]8;;file://testhost" + testFile + "\x1b\\./src/main.go:10\x1b]8;;\x1b\\\n",
+			name:     "idea scheme with line only",
+			scheme:   "idea",
+			input:    plainFile + ":42\n",
+			expected: "\x1b]8;;idea://open?file=" + url.QueryEscape(plainFile) + "&line=42\x1b\\" + plainFile + ":42\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "idea scheme without line",
+			scheme:   "idea",
+			input:    plainFile + "\n",
+			expected: "\x1b]8;;idea://open?file=" + url.QueryEscape(plainFile) + "\x1b\\" + plainFile + "\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "goland scheme with range format converts to line:col",
+			scheme:   "goland",
+			input:    plainFile + ":12-24\n",
+			expected: "\x1b]8;;goland://open?file=" + url.QueryEscape(plainFile) + "&line=12&column=1\x1b\\" + plainFile + ":12-24\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "pycharm scheme percent-encodes the path",
+			scheme:   "pycharm",
+			input:    testFile + ":3\n",
+			expected: "\x1b]8;;pycharm://open?file=" + escaped + "&line=3\x1b\\" + testFile + ":3\x1b]8;;\x1b\\\n",
 		},
 	}
 
@@ -499,210 +837,3909 @@ func TestLinker_BasenameResolution(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			var buf bytes.Buffer
 			linker := NewLinker(LinkerOptions{
-				Output:          &buf,
-				Cwd:             tmpDir,
-				Hostname:        hostname,
-				Scheme:          "file",
-				Domains:         []string{"github.com"},
-				ResolveBasename: true,
-				ExcludeDirs:     []string{},
+				Output:   &buf,
+				Cwd:      tmpDir,
+				Hostname: "testhost",
+				Scheme:   tt.scheme,
+				Domains:  []string{"github.com"},
 			})
 
-			ctx, cancel := context.WithCancel(context.Background())
-			defer cancel()
-			go linker.StartIndexer(ctx)
-			if err := linker.WaitForIndex(ctx); err != nil {
-				t.Fatal(err)
-			}
-
 			assertWrite(t, linker, tt.input, tt.expected)
 		})
 	}
 }
 
-func TestLinker_SuffixMatch(t *testing.T) {
+func TestLinker_EditorPresets(t *testing.T) {
 	tmpDir := t.TempDir()
-	hostname := "testhost"
+	testFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "test.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+	fileURL := url.QueryEscape("file://" + testFile)
 
-	deepDir := filepath.Join(tmpDir, "path", "to")
-	if err := os.MkdirAll(deepDir, 0755); err != nil {
-		t.Fatal(err)
+	tests := []struct {
+		editor  string
+		input   string
+		wantURL string
+	}{
+		{editor: "vscode", input: "test.go:42:7", wantURL: "vscode://file" + testFile + ":42:7"},
+		{editor: "cursor", input: "test.go:42:7", wantURL: "cursor://file" + testFile + ":42:7"},
+		{editor: "zed", input: "test.go:42:7", wantURL: "zed://file" + testFile + ":42:7"},
+		{editor: "idea", input: "test.go:42:7", wantURL: "idea://open?file=" + url.QueryEscape(testFile) + "&line=42&column=7"},
+		{editor: "sublime", input: "test.go:42:7", wantURL: "subl://open?url=" + fileURL + "&line=42&column=7"},
+		{editor: "textmate", input: "test.go:42:7", wantURL: "txmt://open?url=" + fileURL + "&line=42"},
+		{editor: "emacs", input: "test.go:42:7", wantURL: "emacs://open?url=" + fileURL + "&line=42"},
+		{editor: "nvim", input: "test.go:12-24", wantURL: "nvim://open?url=" + fileURL + "&line=12"},
+		{editor: "helix", input: "test.go:42:7", wantURL: "file://testhost" + testFile},
 	}
-	testFile := filepath.Join(deepDir, "file.go")
-	if err := os.WriteFile(testFile, []byte("package main"), 0644); err != nil {
-		t.Fatal(err)
+
+	for _, tt := range tests {
+		t.Run(tt.editor, func(t *testing.T) {
+			preset, err := parseEditor(tt.editor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:   &buf,
+				Cwd:      tmpDir,
+				Hostname: "testhost",
+				Scheme:   preset.Scheme,
+				Domains:  []string{"github.com"},
+			})
+
+			assertWrite(t, linker, tt.input+"\n", "\x1b]8;;"+tt.wantURL+"\x1b\\"+tt.input+"\x1b]8;;\x1b\\\n")
+		})
 	}
+}
 
-	var buf bytes.Buffer
-	linker := NewLinker(LinkerOptions{
+func TestLinker_AssetScheme(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, "assets"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	logo := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "assets", "logo.png"))
+	font := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "assets", "Inter.WOFF2"))
+	mainGo := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "main.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+
+	tests := []struct {
+		name        string
+		scheme      string
+		assetScheme string
+		input       string
+		expected    string
+	}{
+		{
+			name:     "asset links like a source file without AssetScheme",
+			scheme:   "vscode",
+			input:    "assets/logo.png main.go:3\n",
+			expected: "\x1b]8;;vscode://file" + logo + "\x1b\\assets/logo.png\x1b]8;;\x1b\\ \x1b]8;;vscode://file" + mainGo + ":3\x1b\\main.go:3\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:        "image uses the asset scheme while .go uses the default",
+			scheme:      "vscode",
+			assetScheme: "file",
+			input:       "assets/logo.png main.go:3\n",
+			expected:    "\x1b]8;;file://testhost" + logo + "\x1b\\assets/logo.png\x1b]8;;\x1b\\ \x1b]8;;vscode://file" + mainGo + ":3\x1b\\main.go:3\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:        "extension match ignores case",
+			assetScheme: "preview",
+			input:       "assets/Inter.WOFF2\n",
+			expected:    "\x1b]8;;preview://file" + font + "\x1b\\assets/Inter.WOFF2\x1b]8;;\x1b\\\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:      &buf,
+				Cwd:         tmpDir,
+				Hostname:    "testhost",
+				Scheme:      tt.scheme,
+				AssetScheme: tt.assetScheme,
+				Domains:     []string{"github.com"},
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_LineLists(t *testing.T) {
+	tmpDir := t.TempDir()
+	mainGo := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "main.go"))
+	aGo := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "a.go"))
+	bGo := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "b.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+
+	link := func(path, loc, display string) string {
+		return "\x1b]8;;vscode://file" + path + loc + "\x1b\\" + display + "\x1b]8;;\x1b\\"
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "same file, two lines",
+			input:    "main.go:10,15\n",
+			expected: link(mainGo, ":10", "main.go:10") + "," + link(mainGo, ":15", "15") + "\n",
+		},
+		{
+			name:     "same file, list followed by message",
+			input:    "main.go:10,15,20: unused\n",
+			expected: link(mainGo, ":10", "main.go:10") + "," + link(mainGo, ":15", "15") + "," + link(mainGo, ":20", "20") + ": unused\n",
+		},
+		{
+			name:     "distinct file:line pairs",
+			input:    "a.go:1,b.go:2\n",
+			expected: link(aGo, ":1", "a.go:1") + "," + link(bGo, ":2", "b.go:2") + "\n",
+		},
+		{
+			name:     "line list then another file",
+			input:    "a.go:1,5,b.go:2\n",
+			expected: link(aGo, ":1", "a.go:1") + "," + link(aGo, ":5", "5") + "," + link(bGo, ":2", "b.go:2") + "\n",
+		},
+		{
+			name:     "list running into a path is left alone",
+			input:    "a.go:1,2b.go\n",
+			expected: link(aGo, ":1", "a.go:1") + ",2b.go\n",
+		},
+		{
+			name:     "list ending in a column is left alone",
+			input:    "main.go:10,15:3\n",
+			expected: link(mainGo, ":10", "main.go:10") + ",15:3\n",
+		},
+		{
+			name:     "no list after line and column",
+			input:    "main.go:3:4,5\n",
+			expected: link(mainGo, ":3:4", "main.go:3:4") + ",5\n",
+		},
+		{
+			name:     "no list without a line",
+			input:    "main.go,15\n",
+			expected: link(mainGo, "", "main.go") + ",15\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:   &buf,
+				Cwd:      tmpDir,
+				Hostname: "testhost",
+				Scheme:   "vscode",
+				Domains:  []string{"github.com"},
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_CompilerFlags(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+	incDir := filepath.Join(tmpDir, "include")
+	libDir := filepath.Join(tmpDir, "lib")
+	for _, dir := range []string{incDir, libDir} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	headerH := writeTestFileAndResolvePath(t, filepath.Join(incDir, "header.h"))
+
+	link := func(path, display string) string {
+		return "\x1b]8;;vscode://file" + path + "\x1b\\" + display + "\x1b]8;;\x1b\\"
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "go build -x cgo compile line",
+			input:    "gcc -I " + tmpDir + " -fPIC -I" + incDir + " -o ./_x001.o -c x.c\n",
+			expected: "gcc -I " + link(tmpDir, tmpDir) + " -fPIC -I" + link(incDir, incDir) + " -o ./_x001.o -c x.c\n",
+		},
+		{
+			name:     "go build -x link line",
+			input:    "gcc -m64 -o $WORK/b001/exe/a.out -L" + libDir + " -lfoo\n",
+			expected: "gcc -m64 -o $WORK/b001/exe/a.out -L" + link(libDir, libDir) + " -lfoo\n",
+		},
+		{
+			name:     "relative include and file",
+			input:    "-Iinclude/header.h -L./lib\n",
+			expected: "-I" + link(headerH, "include/header.h") + " -L" + link(libDir, "./lib") + "\n",
+		},
+		{
+			name:     "flag at start of line",
+			input:    "-I" + incDir + "\n",
+			expected: "-I" + link(incDir, incDir) + "\n",
+		},
+		{
+			name:     "letters before the flag",
+			input:    "foo-I" + incDir + "\n",
+			expected: "foo-I" + incDir + "\n",
+		},
+		{
+			name:     "other flags are not split",
+			input:    "-Wl," + libDir + " -X" + libDir + "\n",
+			expected: "-Wl," + link(libDir, libDir) + " -X" + libDir + "\n",
+		},
+		{
+			name:     "missing directory",
+			input:    "-I" + filepath.Join(tmpDir, "missing") + "\n",
+			expected: "-I" + filepath.Join(tmpDir, "missing") + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:   &buf,
+				Cwd:      tmpDir,
+				Hostname: "testhost",
+				Scheme:   "vscode",
+				Domains:  []string{"github.com"},
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_RipgrepFormat(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "test.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "path:line:col:text",
+			input:    "test.go:42:13:\tfoo := bar()\n",
+			expected: "\x1b]8;;vscode://file" + testFile + ":42:13\x1b\\test.go:42:13\x1b]8;;\x1b\\:\tfoo := bar()\n",
+		},
+		{
+			name:     "path:line:text without --column",
+			input:    "test.go:42:foo := bar()\n",
+			expected: "\x1b]8;;vscode://file" + testFile + ":42\x1b\\test.go:42\x1b]8;;\x1b\\:foo := bar()\n",
+		},
+		{
+			name:     "empty match text",
+			input:    "test.go:42:13:\n",
+			expected: "\x1b]8;;vscode://file" + testFile + ":42:13\x1b\\test.go:42:13\x1b]8;;\x1b\\:\n",
+		},
+		{
+			name:     "match text starting with a digit",
+			input:    "test.go:42:13:7 items\n",
+			expected: "\x1b]8;;vscode://file" + testFile + ":42:13\x1b\\test.go:42:13\x1b]8;;\x1b\\:7 items\n",
+		},
+		{
+			name:     "match text containing another location",
+			input:    "./test.go:42:13:see test.go:1:2\n",
+			expected: "\x1b]8;;vscode://file" + testFile + ":42:13\x1b\\./test.go:42:13\x1b]8;;\x1b\\:see \x1b]8;;vscode://file" + testFile + ":1:2\x1b\\test.go:1:2\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "absolute path",
+			input:    testFile + ":42:13:foo\n",
+			expected: "\x1b]8;;vscode://file" + testFile + ":42:13\x1b\\" + testFile + ":42:13\x1b]8;;\x1b\\:foo\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:   &buf,
+				Cwd:      tmpDir,
+				Hostname: "testhost",
+				Scheme:   "vscode",
+				Domains:  []string{"github.com"},
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_GoVetFormat(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+	if err := os.Mkdir(filepath.Join(tmpDir, "pkg"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	mainFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "main.go"))
+	pkgFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "pkg", "file.go"))
+	link := func(path, loc, display string) string {
+		return "\x1b]8;;vscode://file" + path + loc + "\x1b\\" + display + "\x1b]8;;\x1b\\"
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "single file in cwd",
+			input:    "./main.go:10:2: //go:linkname must refer to declared function or variable\n",
+			expected: link(mainFile, ":10:2", "./main.go:10:2") + ": //go:linkname must refer to declared function or variable\n",
+		},
+		{
+			name:     "file in subdirectory",
+			input:    "./pkg/file.go:3:1: misplaced compiler directive\n",
+			expected: link(pkgFile, ":3:1", "./pkg/file.go:3:1") + ": misplaced compiler directive\n",
+		},
+		{
+			name:     "without leading ./",
+			input:    "pkg/file.go:3:1: misplaced compiler directive\n",
+			expected: link(pkgFile, ":3:1", "pkg/file.go:3:1") + ": misplaced compiler directive\n",
+		},
+		{
+			name:     "package header is left alone",
+			input:    "# example.com/m/pkg\n./pkg/file.go:12:5: unreachable code\n",
+			expected: "# example.com/m/pkg\n" + link(pkgFile, ":12:5", "./pkg/file.go:12:5") + ": unreachable code\n",
+		},
+		{
+			name:     "tool prefix and indentation",
+			input:    "vet: ./main.go:4:1: x\n    ./pkg/file.go:9:1: y\n",
+			expected: "vet: " + link(mainFile, ":4:1", "./main.go:4:1") + ": x\n    " + link(pkgFile, ":9:1", "./pkg/file.go:9:1") + ": y\n",
+		},
+		{
+			name:     "message quoting a directive",
+			input:    "./main.go:5:3: directive \"//go:embed\" only allowed in Go files that import \"embed\"\n",
+			expected: link(mainFile, ":5:3", "./main.go:5:3") + ": directive \"//go:embed\" only allowed in Go files that import \"embed\"\n",
+		},
+		{
+			name:     "message naming another position",
+			input:    "./main.go:1:1: conflicts with ./pkg/file.go:2:3\n",
+			expected: link(mainFile, ":1:1", "./main.go:1:1") + ": conflicts with " + link(pkgFile, ":2:3", "./pkg/file.go:2:3") + "\n",
+		},
+		{
+			name:     "line without column",
+			input:    "./main.go:10: something\n",
+			expected: link(mainFile, ":10", "./main.go:10") + ": something\n",
+		},
+		{
+			name:     "no message",
+			input:    "./main.go:10:2:\n",
+			expected: link(mainFile, ":10:2", "./main.go:10:2") + ":\n",
+		},
+		{
+			name:     "no space before message",
+			input:    "./main.go:4:1:directive\n",
+			expected: link(mainFile, ":4:1", "./main.go:4:1") + ":directive\n",
+		},
+		{
+			name:     "in parentheses",
+			input:    "(./main.go:4:1)\n",
+			expected: "(" + link(mainFile, ":4:1", "./main.go:4:1") + ")\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:   &buf,
+				Cwd:      tmpDir,
+				Hostname: "testhost",
+				Scheme:   "vscode",
+				Domains:  []string{"github.com"},
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+
+	t.Run("split across writes when line buffered", func(t *testing.T) {
+		var buf bytes.Buffer
+		linker := NewLinker(LinkerOptions{
+			Output:       &buf,
+			Cwd:          tmpDir,
+			Hostname:     "testhost",
+			Scheme:       "vscode",
+			Domains:      []string{"github.com"},
+			LineBuffered: true,
+		})
+
+		for _, part := range []string{"./main.go:10", ":2", ": unused result\n"} {
+			if _, err := linker.Write([]byte(part)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want := link(mainFile, ":10:2", "./main.go:10:2") + ": unused result\n"
+		if got := buf.String(); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+}
+
+func TestLinker_GeneratedFileHeaders(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+	if err := os.Mkdir(filepath.Join(tmpDir, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	protoFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "src", "api.proto"))
+	link := func(loc, display string) string {
+		return "\x1b]8;;vscode://file" + protoFile + loc + "\x1b\\" + display + "\x1b]8;;\x1b\\"
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "Code generated from",
+			input:    "// Code generated from src/api.proto. DO NOT EDIT.\n",
+			expected: "// Code generated from " + link("", "src/api.proto") + ". DO NOT EDIT.\n",
+		},
+		{
+			name:     "generator named after the source",
+			input:    "// Code generated from src/api.proto by protoc-gen-go; DO NOT EDIT.\n",
+			expected: "// Code generated from " + link("", "src/api.proto") + " by protoc-gen-go; DO NOT EDIT.\n",
+		},
+		{
+			name:     "protoc-gen-go source line",
+			input:    "// source: src/api.proto\n",
+			expected: "// source: " + link("", "src/api.proto") + "\n",
+		},
+		{
+			name:     "quoted source in a hash comment",
+			input:    "# Code generated from \"src/api.proto\"\n",
+			expected: "# Code generated from \"" + link("", "src/api.proto") + "\"\n",
+		},
+		{
+			name:     "header without a source path",
+			input:    "// Code generated by protoc-gen-go. DO NOT EDIT.\n",
+			expected: "// Code generated by protoc-gen-go. DO NOT EDIT.\n",
+		},
+		{
+			name:     "missing source is not linked",
+			input:    "// Code generated from src/other.proto. DO NOT EDIT.\n",
+			expected: "// Code generated from src/other.proto. DO NOT EDIT.\n",
+		},
+		{
+			name:     "lone slash",
+			input:    "mounted on /\n",
+			expected: "mounted on /\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:   &buf,
+				Cwd:      tmpDir,
+				Hostname: "testhost",
+				Scheme:   "vscode",
+				Domains:  []string{"github.com"},
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_LineSeparators(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+	for _, dir := range []string{"src", "pkg@v1.2.3"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mainFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "src", "main.go"))
+	versioned := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "pkg@v1.2.3", "x.go"))
+	link := func(url, display string) string {
+		return "\x1b]8;;vscode://file" + url + "\x1b\\" + display + "\x1b]8;;\x1b\\"
+	}
+
+	tests := []struct {
+		name       string
+		separators string
+		input      string
+		expected   string
+	}{
+		{
+			name:       "path@line",
+			separators: "@",
+			input:      "at src/main.go@42\n",
+			expected:   "at " + link(mainFile+":42", "src/main.go@42") + "\n",
+		},
+		{
+			name:       "prefixed path@line",
+			separators: "@",
+			input:      "at ./src/main.go@42\n",
+			expected:   "at " + link(mainFile+":42", "./src/main.go@42") + "\n",
+		},
+		{
+			name:       "path@line:col",
+			separators: "@",
+			input:      "at src/main.go@42:7\n",
+			expected:   "at " + link(mainFile+":42:7", "src/main.go@42:7") + "\n",
+		},
+		{
+			name:       "colon still works",
+			separators: "@",
+			input:      "at src/main.go:42\n",
+			expected:   "at " + link(mainFile+":42", "src/main.go:42") + "\n",
+		},
+		{
+			name:       "module version stays in the path",
+			separators: "@",
+			input:      "at pkg@v1.2.3/x.go:3\n",
+			expected:   "at " + link(versioned+":3", "pkg@v1.2.3/x.go:3") + "\n",
+		},
+		{
+			name:       "package version is not a location",
+			separators: "@",
+			input:      "added lodash@4.17.21\n",
+			expected:   "added lodash@4.17.21\n",
+		},
+		{
+			name:       "disabled by default",
+			separators: "",
+			input:      "at src/main.go@42\n",
+			expected:   "at " + link(mainFile, "src/main.go") + "@42\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:         &buf,
+				Cwd:            tmpDir,
+				Hostname:       "testhost",
+				Scheme:         "vscode",
+				Domains:        []string{"github.com"},
+				LineSeparators: tt.separators,
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_UnicodePaths(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+	for _, dir := range []string{"文档/子目录", "emoji🎉dir", "👩‍💻"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cjkFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "文档", "子目录", "说明.md"))
+	emojiDirFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "emoji🎉dir", "app.go"))
+	emojiFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "emoji🎉dir", "😀.go"))
+	zwjFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "👩‍💻", "notes.txt"))
+	bracketFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "【草稿】计划.md"))
+	link := func(path, loc, display string) string {
+		return "\x1b]8;;vscode://file" + path + loc + "\x1b\\" + display + "\x1b]8;;\x1b\\"
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "CJK directories and file name",
+			input:    "文档/子目录/说明.md:3\n",
+			expected: link(cjkFile, ":3", "文档/子目录/说明.md:3") + "\n",
+		},
+		{
+			name:     "CJK path with ./ prefix",
+			input:    "at ./文档/子目录/说明.md\n",
+			expected: "at " + link(cjkFile, "", "./文档/子目录/说明.md") + "\n",
+		},
+		{
+			name:     "emoji in directory name",
+			input:    "see emoji🎉dir/app.go:10:2 now\n",
+			expected: "see " + link(emojiDirFile, ":10:2", "emoji🎉dir/app.go:10:2") + " now\n",
+		},
+		{
+			name:     "emoji file name",
+			input:    "emoji🎉dir/😀.go:1\n",
+			expected: link(emojiFile, ":1", "emoji🎉dir/😀.go:1") + "\n",
+		},
+		{
+			name:     "emoji joined with a zero-width joiner",
+			input:    "👩‍💻/notes.txt:2\n",
+			expected: link(zwjFile, ":2", "👩‍💻/notes.txt:2") + "\n",
+		},
+		{
+			name:     "absolute path through an emoji directory",
+			input:    "open " + emojiDirFile + "\n",
+			expected: "open " + link(emojiDirFile, "", emojiDirFile) + "\n",
+		},
+		{
+			name:     "in CJK corner brackets",
+			input:    "「文档/子目录/说明.md:4」\n",
+			expected: "「" + link(cjkFile, ":4", "文档/子目录/说明.md:4") + "」\n",
+		},
+		{
+			name:     "after a fullwidth colon",
+			input:    "文件：文档/子目录/说明.md\n",
+			expected: "文件：" + link(cjkFile, "", "文档/子目录/说明.md") + "\n",
+		},
+		{
+			name:     "after an arrow",
+			input:    "→emoji🎉dir/app.go\n",
+			expected: "→" + link(emojiDirFile, "", "emoji🎉dir/app.go") + "\n",
+		},
+		{
+			name:     "trailing CJK punctuation after a prefixed path",
+			input:    "「" + emojiDirFile + "」\n",
+			expected: "「" + link(emojiDirFile, "", emojiDirFile) + "」\n",
+		},
+		{
+			name:     "brackets that are part of the file name",
+			input:    "【草稿】计划.md\n",
+			expected: link(bracketFile, "", "【草稿】计划.md") + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:   &buf,
+				Cwd:      tmpDir,
+				Hostname: "testhost",
+				Scheme:   "vscode",
+				Domains:  []string{"github.com"},
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_DoubleColonLocations(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tmpDir, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	mainFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "src", "main.go"))
+	testFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "test_app.py"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+	link := func(url, display string) string {
+		return "\x1b]8;;vscode://file" + url + "\x1b\\" + display + "\x1b]8;;\x1b\\"
+	}
+
+	tests := []struct {
+		name       string
+		separators string
+		input      string
+		expected   string
+	}{
+		{
+			name:     "line and column",
+			input:    "src/main.go::42::5: error\n",
+			expected: link(mainFile+":42:5", "src/main.go::42::5") + ": error\n",
+		},
+		{
+			name:     "line only",
+			input:    "at src/main.go::42\n",
+			expected: "at " + link(mainFile+":42", "src/main.go::42") + "\n",
+		},
+		{
+			name:       "with line separators",
+			separators: "@",
+			input:      "at src/main.go::42::5\n",
+			expected:   "at " + link(mainFile+":42:5", "src/main.go::42::5") + "\n",
+		},
+		{
+			name:     "pytest node ID links the file only",
+			input:    "FAILED test_app.py::test_x - assert 1 == 2\n",
+			expected: "FAILED " + link(testFile, "test_app.py") + "::test_x - assert 1 == 2\n",
+		},
+		{
+			name:     "pytest class node ID",
+			input:    "test_app.py::TestApp::test_x PASSED\n",
+			expected: link(testFile, "test_app.py") + "::TestApp::test_x PASSED\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:         &buf,
+				Cwd:            tmpDir,
+				Hostname:       "testhost",
+				Scheme:         "vscode",
+				Domains:        []string{"github.com"},
+				LineSeparators: tt.separators,
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_PseudoFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	bootstrap := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "importlib._bootstrap"))
+	writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "stdin"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "stdin",
+			input:    "<stdin>:5:10: error: expected ';'\n",
+			expected: "<stdin>:5:10: error: expected ';'\n",
+		},
+		{
+			name:     "built-in and command line",
+			input:    "<built-in>:1: note\n<command-line>:0:0: warning\n",
+			expected: "<built-in>:1: note\n<command-line>:0:0: warning\n",
+		},
+		{
+			name:     "frozen module",
+			input:    `  File "<frozen importlib._bootstrap>", line 241` + "\n",
+			expected: `  File "<frozen importlib._bootstrap>", line 241` + "\n",
+		},
+		{
+			name:     "same name outside brackets",
+			input:    "importlib._bootstrap\n",
+			expected: "\x1b]8;;vscode://file" + bootstrap + "\x1b\\importlib._bootstrap\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "location without a file",
+			input:    ":5:10: error\n5:10: error\n",
+			expected: ":5:10: error\n5:10: error\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:          &buf,
+				Cwd:             tmpDir,
+				Hostname:        "testhost",
+				Scheme:          "vscode",
+				Domains:         []string{"github.com"},
+				ResolveBasename: true,
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_BareDomains(t *testing.T) {
+	tmpDir := t.TempDir()
+	hostname := "testhost"
+
+	tests := []struct {
+		name     string
+		domains  []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "https github.com unchanged",
+			domains:  []string{"github.com"},
+			input:    "https://github.com/mash/osc8wrap",
+			expected: "\x1b]8;;https://github.com/mash/osc8wrap\x1b\\https://github.com/mash/osc8wrap\x1b]8;;\x1b\\",
+		},
+		{
+			name:     "bare github.com",
+			domains:  []string{"github.com"},
+			input:    "github.com/mash/osc8wrap",
+			expected: "\x1b]8;;https://github.com/mash/osc8wrap\x1b\\github.com/mash/osc8wrap\x1b]8;;\x1b\\",
+		},
+		{
+			name:     "bare github.com with path",
+			domains:  []string{"github.com"},
+			input:    "see github.com/user/repo/issues/123",
+			expected: "see \x1b]8;;https://github.com/user/repo/issues/123\x1b\\github.com/user/repo/issues/123\x1b]8;;\x1b\\",
+		},
+		{
+			name:     "mixed https and bare",
+			domains:  []string{"github.com"},
+			input:    "https://github.com/a and github.com/b",
+			expected: "\x1b]8;;https://github.com/a\x1b\\https://github.com/a\x1b]8;;\x1b\\ and \x1b]8;;https://github.com/b\x1b\\github.com/b\x1b]8;;\x1b\\",
+		},
+		{
+			name:     "custom domain gitlab.com",
+			domains:  []string{"gitlab.com"},
+			input:    "gitlab.com/user/repo",
+			expected: "\x1b]8;;https://gitlab.com/user/repo\x1b\\gitlab.com/user/repo\x1b]8;;\x1b\\",
+		},
+		{
+			name:     "multiple domains",
+			domains:  []string{"github.com", "gitlab.com"},
+			input:    "github.com/a and gitlab.com/b",
+			expected: "\x1b]8;;https://github.com/a\x1b\\github.com/a\x1b]8;;\x1b\\ and \x1b]8;;https://gitlab.com/b\x1b\\gitlab.com/b\x1b]8;;\x1b\\",
+		},
+		{
+			name:     "bare github.com is the only path-like token on the line",
+			domains:  []string{"github.com"},
+			input:    "moved to github.com/mash/osc8wrap\n",
+			expected: "moved to \x1b]8;;https://github.com/mash/osc8wrap\x1b\\github.com/mash/osc8wrap\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "unlisted domain not linked",
+			domains:  []string{"github.com"},
+			input:    "gitlab.com/user/repo",
+			expected: "gitlab.com/user/repo",
+		},
+		{
+			name:     "empty domains disables bare linking",
+			domains:  nil,
+			input:    "github.com/user/repo",
+			expected: "github.com/user/repo",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:   &buf,
+				Cwd:      tmpDir,
+				Hostname: hostname,
+				Scheme:   "file",
+				Domains:  tt.domains,
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_BasenameResolution(t *testing.T) {
+	tmpDir := t.TempDir()
+	hostname := "testhost"
+
+	srcDir := filepath.Join(tmpDir, "src")
+	if err := os.MkdirAll(srcDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	testFile := filepath.Join(srcDir, "main.go")
+	if err := os.WriteFile(testFile, []byte("package main"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+	testFile, _ = filepath.EvalSymlinks(testFile)
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "basename only resolves via index",
+			input:    "error in main.go:10\n",
+			expected: "error in \x1b]8;;file://testhost" + testFile + "\x1b\\main.go:10\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "relative path still works",
+			input:    "error in ./src/main.go:10\n",
+			expected: "error in \x1b]8;;file://testhost" + testFile + "\x1b\\./src/main.go:10\x1b]8;;\x1b\\\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:          &buf,
+				Cwd:             tmpDir,
+				Hostname:        hostname,
+				Scheme:          "file",
+				Domains:         []string{"github.com"},
+				ResolveBasename: true,
+				ExcludeDirs:     []string{},
+			})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go linker.StartIndexer(ctx)
+			if err := linker.WaitForIndex(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_DebuggerBacktraces(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+	if err := os.MkdirAll(filepath.Join(tmpDir, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	source := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "src", "foo.c"))
+	link := func(loc, display string) string {
+		return "\x1b]8;;vscode://file" + source + loc + "\x1b\\" + display + "\x1b]8;;\x1b\\"
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "lldb frame with basename",
+			input:    "  * frame #0: 0x0000000100003f50 app`main(argc=1) at foo.c:42:7\n",
+			expected: "  * frame #0: 0x0000000100003f50 app`main(argc=1) at " + link(":42:7", "foo.c:42:7") + "\n",
+		},
+		{
+			name:     "lldb frame with absolute path",
+			input:    "    frame #3: 0x00007fff2036a621 libfoo.so`func at " + source + ":42\n",
+			expected: "    frame #3: 0x00007fff2036a621 libfoo.so`func at " + link(":42", source+":42") + "\n",
+		},
+		{
+			name:     "gdb frame with absolute path",
+			input:    "#3  0x0000555555555189 in func (x=1, s=0x4052a0 \"x.c\") at " + source + ":42\n",
+			expected: "#3  0x0000555555555189 in func (x=1, s=0x4052a0 \"x.c\") at " + link(":42", source+":42") + "\n",
+		},
+		{
+			name:     "gdb frame with relative path",
+			input:    "#0  main () at src/foo.c:42\n",
+			expected: "#0  main () at " + link(":42", "src/foo.c:42") + "\n",
+		},
+		{
+			name:     "gdb frame wrapped onto a continuation line",
+			input:    "#1  0x0000555555555189 in handler (request=0x0, response=0x0)\n    at src/foo.c:42\n",
+			expected: "#1  0x0000555555555189 in handler (request=0x0, response=0x0)\n    at " + link(":42", "src/foo.c:42") + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:          &buf,
+				Cwd:             tmpDir,
+				Hostname:        "testhost",
+				Scheme:          "vscode",
+				Domains:         []string{"github.com"},
+				ResolveBasename: true,
+				ExcludeDirs:     []string{},
+			})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go linker.StartIndexer(ctx)
+			if err := linker.WaitForIndex(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_NodeStackTraces(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+	if err := os.MkdirAll(filepath.Join(tmpDir, "node_modules", "x"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	index := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "index.js"))
+	lib := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "node_modules", "x", "lib.js"))
+	spaced := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "my app.mjs"))
+	link := func(path, loc, display string) string {
+		return "\x1b]8;;vscode://file" + path + loc + "\x1b\\" + display + "\x1b]8;;\x1b\\"
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "absolute path in parentheses",
+			input:    "    at Object.<anonymous> (" + index + ":10:5)\n",
+			expected: "    at Object.<anonymous> (" + link(index, ":10:5", index+":10:5") + ")\n",
+		},
+		{
+			name:     "relative path in parentheses",
+			input:    "    at new Foo (./node_modules/x/lib.js:1:22)\n",
+			expected: "    at new Foo (" + link(lib, ":1:22", "./node_modules/x/lib.js:1:22") + ")\n",
+		},
+		{
+			name:     "anonymous frame without parentheses",
+			input:    "    at " + index + ":7:9\n",
+			expected: "    at " + link(index, ":7:9", index+":7:9") + "\n",
+		},
+		{
+			name:     "ES module file URL",
+			input:    "    at run (file://" + index + ":4:2)\n",
+			expected: "    at run (" + link(index, ":4:2", "file://"+index+":4:2") + ")\n",
+		},
+		{
+			name:     "percent-encoded file URL",
+			input:    "    at file://" + strings.ReplaceAll(spaced, " ", "%20") + ":1:1\n",
+			expected: "    at " + link(spaced, ":1:1", "file://"+strings.ReplaceAll(spaced, " ", "%20")+":1:1") + "\n",
+		},
+		{
+			name:     "node internals stay plain",
+			input:    "    at Module._compile (node:internal/modules/cjs/loader:1256:14)\n    at async Promise.all (index 0)\n",
+			expected: "    at Module._compile (node:internal/modules/cjs/loader:1256:14)\n    at async Promise.all (index 0)\n",
+		},
+		{
+			name:     "error header and frame",
+			input:    "TypeError: x is not a function\n    at main (index.js:3:11)\n",
+			expected: "TypeError: x is not a function\n    at main (" + link(index, ":3:11", "index.js:3:11") + ")\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:   &buf,
+				Cwd:      tmpDir,
+				Hostname: "testhost",
+				Scheme:   "vscode",
+				Domains:  []string{"github.com"},
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_ResolverCmd(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+	if err := os.MkdirAll(filepath.Join(tmpDir, "services", "api"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	handler := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "services", "api", "handler.go"))
+	local := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "local.go"))
+
+	// Knows that handlers live in services/api/, and answers everything
+	// else with a path that does not exist.
+	resolver := `read p; case "$p" in handler.go) echo "$PWD/services/api/$p";; *) echo "$PWD/missing/$p";; esac`
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "resolved by the command",
+			input:    "panic at handler.go:12\n",
+			expected: "panic at \x1b]8;;vscode://file" + handler + ":12\x1b\\handler.go:12\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "found locally without the command",
+			input:    "local.go:3\n",
+			expected: "\x1b]8;;vscode://file" + local + ":3\x1b\\local.go:3\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "answer that does not exist",
+			input:    "other.go:1\n",
+			expected: "other.go:1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:      &buf,
+				Cwd:         tmpDir,
+				Hostname:    "testhost",
+				Scheme:      "vscode",
+				Domains:     []string{"github.com"},
+				ResolverCmd: resolver,
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_LinkLines(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+	if err := os.MkdirAll(filepath.Join(tmpDir, "docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	changelog := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "CHANGELOG.md"))
+	spec := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "docs", "spec.txt"))
+	otherSpec := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "spec.txt"))
+	readme := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "README.md"))
+	link := func(path, loc, display string) string {
+		return "\x1b]8;;vscode://file" + path + loc + "\x1b\\" + display + "\x1b]8;;\x1b\\"
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "mapped basename without a line",
+			input:    "updated CHANGELOG.md\n",
+			expected: "updated " + link(changelog, ":1", "CHANGELOG.md") + "\n",
+		},
+		{
+			name:     "printed line wins",
+			input:    "CHANGELOG.md:40\n",
+			expected: link(changelog, ":40", "CHANGELOG.md:40") + "\n",
+		},
+		{
+			name:     "mapped relative path",
+			input:    "see docs/spec.txt and " + spec + "\n",
+			expected: "see " + link(spec, ":120", "docs/spec.txt") + " and " + link(spec, ":120", spec) + "\n",
+		},
+		{
+			name:     "same basename elsewhere is not mapped",
+			input:    "spec.txt\n",
+			expected: link(otherSpec, "", "spec.txt") + "\n",
+		},
+		{
+			name:     "unmapped file unchanged",
+			input:    "README.md\n",
+			expected: link(readme, "", "README.md") + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:    &buf,
+				Cwd:       tmpDir,
+				Hostname:  "testhost",
+				Scheme:    "vscode",
+				Domains:   []string{"github.com"},
+				LinkLines: []string{"CHANGELOG.md:1", "docs/spec.txt:120"},
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestParseLinkLines(t *testing.T) {
+	got, err := parseLinkLines([]string{"CHANGELOG.md:1", "a:b.txt:7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"CHANGELOG.md": ":1", "a:b.txt": ":7"}
+	if !maps.Equal(got, want) {
+		t.Errorf("parseLinkLines() = %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{"CHANGELOG.md", ":3", "a.md:0", "a.md:x"} {
+		if _, err := parseLinkLines([]string{bad}); err == nil {
+			t.Errorf("parseLinkLines(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestLinker_SuffixMatch(t *testing.T) {
+	tmpDir := t.TempDir()
+	hostname := "testhost"
+
+	deepDir := filepath.Join(tmpDir, "path", "to")
+	if err := os.MkdirAll(deepDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	testFile := filepath.Join(deepDir, "file.go")
+	if err := os.WriteFile(testFile, []byte("package main"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	linker := NewLinker(LinkerOptions{
+		Output:          &buf,
+		Cwd:             tmpDir,
+		Hostname:        hostname,
+		Scheme:          "file",
+		Domains:         []string{"github.com"},
+		ResolveBasename: true,
+		ExcludeDirs:     []string{},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go linker.StartIndexer(ctx)
+	if err := linker.WaitForIndex(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	assertWrite(t, linker,
+		"error in to/file.go:10\n",
+		"error in \x1b]8;;file://testhost"+testFile+"\x1b\\to/file.go:10\x1b]8;;\x1b\\\n")
+}
+
+func TestLinker_MtimePriority(t *testing.T) {
+	tmpDir := t.TempDir()
+	hostname := "testhost"
+
+	dirA := filepath.Join(tmpDir, "a")
+	dirB := filepath.Join(tmpDir, "b")
+	if err := os.MkdirAll(dirA, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dirB, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	oldFile := filepath.Join(dirA, "file.go")
+	newFile := filepath.Join(dirB, "file.go")
+	if err := os.WriteFile(oldFile, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldTime := time.Now().Add(-1 * time.Hour)
+	if err := os.Chtimes(oldFile, oldTime, oldTime); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(newFile, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	linker := NewLinker(LinkerOptions{
+		Output:          &buf,
+		Cwd:             tmpDir,
+		Hostname:        hostname,
+		Scheme:          "file",
+		Domains:         []string{"github.com"},
+		ResolveBasename: true,
+		ExcludeDirs:     []string{},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go linker.StartIndexer(ctx)
+	if err := linker.WaitForIndex(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	assertWrite(t, linker,
+		"error in file.go:10\n",
+		"error in \x1b]8;;file://testhost"+newFile+"\x1b\\file.go:10\x1b]8;;\x1b\\\n")
+}
+
+func TestLinker_IndexNotReady(t *testing.T) {
+	tmpDir := t.TempDir()
+	hostname := "testhost"
+
+	srcDir := filepath.Join(tmpDir, "src")
+	if err := os.MkdirAll(srcDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "main.go"), []byte("package main"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	linker := NewLinker(LinkerOptions{
+		Output:          &buf,
+		Cwd:             tmpDir,
+		Hostname:        hostname,
+		Scheme:          "file",
+		Domains:         []string{"github.com"},
+		ResolveBasename: true,
+		ExcludeDirs:     []string{},
+	})
+
+	assertWrite(t, linker, "error in main.go:10\n", "error in main.go:10\n")
+}
+
+func TestLinker_ResolveBasenameDisabled(t *testing.T) {
+	tmpDir := t.TempDir()
+	hostname := "testhost"
+
+	srcDir := filepath.Join(tmpDir, "src")
+	if err := os.MkdirAll(srcDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "main.go"), []byte("package main"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	linker := NewLinker(LinkerOptions{
+		Output:          &buf,
+		Cwd:             tmpDir,
+		Hostname:        hostname,
+		Scheme:          "file",
+		Domains:         []string{"github.com"},
+		ResolveBasename: false,
+		ExcludeDirs:     []string{},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go linker.StartIndexer(ctx)
+	if err := linker.WaitForIndex(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	assertWrite(t, linker, "error in main.go:10\n", "error in main.go:10\n")
+}
+
+func TestLinker_TildePath(t *testing.T) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testDir := filepath.Join(homeDir, ".osc8wrap-test")
+	if err := os.MkdirAll(testDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testDir) //nolint:errcheck
+
+	testFile := filepath.Join(testDir, "test.go")
+	if err := os.WriteFile(testFile, []byte("package main"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hostname := "testhost"
+	tmpDir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "tilde path basic",
+			input:    "error in ~/.osc8wrap-test/test.go\n",
+			expected: "error in \x1b]8;;file://testhost" + testFile + "\x1b\\~/.osc8wrap-test/test.go\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "tilde path with line number",
+			input:    "error in ~/.osc8wrap-test/test.go:42\n",
+			expected: "error in \x1b]8;;file://testhost" + testFile + "\x1b\\~/.osc8wrap-test/test.go:42\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "non-existent tilde path not linked",
+			input:    "error in ~/.osc8wrap-test/nonexistent.go:10\n",
+			expected: "error in ~/.osc8wrap-test/nonexistent.go:10\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:   &buf,
+				Cwd:      tmpDir,
+				Hostname: hostname,
+				Scheme:   "file",
+				Domains:  []string{"github.com"},
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_ShortenHome(t *testing.T) {
+	homeDir := t.TempDir()
+	homeDir, _ = filepath.EvalSymlinks(homeDir)
+	t.Setenv("HOME", homeDir)
+
+	homeFile := writeTestFileAndResolvePath(t, filepath.Join(homeDir, "test.go"))
+
+	otherDir := t.TempDir()
+	otherFile := writeTestFileAndResolvePath(t, filepath.Join(otherDir, "test.go"))
+
+	hostname := "testhost"
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "path under home displays with tilde",
+			input:    "error in " + homeFile + ":42\n",
+			expected: "error in \x1b]8;;file://testhost" + homeFile + "\x1b\\~/test.go:42\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "path outside home unchanged",
+			input:    "error in " + otherFile + ":42\n",
+			expected: "error in \x1b]8;;file://testhost" + otherFile + "\x1b\\" + otherFile + ":42\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "relative path unchanged",
+			input:    "error in ./test.go\n",
+			expected: "error in \x1b]8;;file://testhost" + homeFile + "\x1b\\./test.go\x1b]8;;\x1b\\\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:      &buf,
+				Cwd:         homeDir,
+				Hostname:    hostname,
+				Scheme:      "file",
+				Domains:     []string{"github.com"},
+				ShortenHome: true,
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_NoLinkCRLines(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "test.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+
+	link := "\x1b]8;;file://testhost" + testFile + "\x1b\\./test.go\x1b]8;;\x1b\\"
+
+	tests := []struct {
+		name     string
+		writes   []string
+		expected string
+	}{
+		{
+			name:     "newline terminated line is linked",
+			writes:   []string{"see ./test.go\n"},
+			expected: "see " + link + "\n",
+		},
+		{
+			name:     "CRLF terminated line is linked",
+			writes:   []string{"see ./test.go\r\n"},
+			expected: "see " + link + "\r\n",
+		},
+		{
+			name:     "CRLF split across writes is linked",
+			writes:   []string{"see ./test.go\r", "\nnext ./test.go\n"},
+			expected: "see " + link + "\r\nnext " + link + "\n",
+		},
+		{
+			name:     "progress redraws are not linked",
+			writes:   []string{"copy ./test.go 10%\rcopy ./test.go 50%\rcopy ./test.go 100%\n"},
+			expected: "copy ./test.go 10%\rcopy ./test.go 50%\rcopy ./test.go 100%\n",
+		},
+		{
+			name:     "progress redraws across writes are not linked",
+			writes:   []string{"copy ./test.go 10%\rcopy ./test", ".go 50%", "\rdone\n"},
+			expected: "copy ./test.go 10%\rcopy ./test.go 50%\rdone\n",
+		},
+		{
+			name:     "line after progress bar is linked again",
+			writes:   []string{"copy 10%\rcopy 100%\n", "error in ./test.go\n"},
+			expected: "copy 10%\rcopy 100%\nerror in " + link + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:        &buf,
+				Cwd:           tmpDir,
+				Hostname:      "testhost",
+				Scheme:        "file",
+				Domains:       []string{"github.com"},
+				NoLinkCRLines: true,
+			})
+			for _, w := range tt.writes {
+				if _, err := linker.Write([]byte(w)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := linker.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.expected {
+				t.Errorf("got  %q\nwant %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLinker_LinkTestNames(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+
+	pkgDir := filepath.Join(tmpDir, "pkg")
+	if err := os.MkdirAll(pkgDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	testFile := filepath.Join(pkgDir, "foo_test.go")
+	src := "package pkg\n\nimport \"testing\"\n\nfunc TestFoo(t *testing.T) {}\n\nfunc TestBar(t *testing.T) {}\n"
+	if err := os.WriteFile(testFile, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	linker := NewLinker(LinkerOptions{
+		Output:          &buf,
+		Cwd:             tmpDir,
+		Hostname:        "testhost",
+		Scheme:          "cursor",
+		Domains:         []string{"github.com"},
+		ResolveBasename: true,
+		ExcludeDirs:     []string{},
+		LinkTestNames:   true,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go linker.StartIndexer(ctx)
+	if err := linker.WaitForIndex(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "failing test links to its declaration",
+			input:    "--- FAIL: TestFoo (0.00s)\n",
+			expected: "--- FAIL: \x1b]8;;cursor://file" + testFile + ":5\x1b\\TestFoo\x1b]8;;\x1b\\ (0.00s)\n",
+		},
+		{
+			name:     "passing test links to its declaration",
+			input:    "    --- PASS: TestBar (0.01s)\n",
+			expected: "    --- PASS: \x1b]8;;cursor://file" + testFile + ":7\x1b\\TestBar\x1b]8;;\x1b\\ (0.01s)\n",
+		},
+		{
+			name:     "subtest links the top-level test",
+			input:    "--- FAIL: TestFoo/case_1 (0.00s)\n",
+			expected: "--- FAIL: \x1b]8;;cursor://file" + testFile + ":5\x1b\\TestFoo\x1b]8;;\x1b\\/case_1 (0.00s)\n",
+		},
+		{
+			name:     "unknown test left unchanged",
+			input:    "--- FAIL: TestMissing (0.00s)\n",
+			expected: "--- FAIL: TestMissing (0.00s)\n",
+		},
+		{
+			name:     "test name outside a result line not linked",
+			input:    "running TestFoo\n",
+			expected: "running TestFoo\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_ExtractDir(t *testing.T) {
+	cwd := t.TempDir()
+	extractDir := t.TempDir()
+	extractDir, _ = filepath.EvalSymlinks(extractDir)
+
+	if err := os.MkdirAll(filepath.Join(extractDir, "pkg", "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	member := writeTestFileAndResolvePath(t, filepath.Join(extractDir, "pkg", "src", "main.go"))
+	readme := writeTestFileAndResolvePath(t, filepath.Join(extractDir, "pkg", "README.md"))
+
+	tests := []struct {
+		name       string
+		extractDir string
+		input      string
+		expected   string
+	}{
+		{
+			name:       "tar xvf member links under extract dir",
+			extractDir: extractDir,
+			input:      "x pkg/src/main.go\n",
+			expected:   "x \x1b]8;;file://testhost" + member + "\x1b\\pkg/src/main.go\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:       "unzip inflating line links under extract dir",
+			extractDir: extractDir,
+			input:      "  inflating: pkg/README.md  \n",
+			expected:   "  inflating: \x1b]8;;file://testhost" + readme + "\x1b\\pkg/README.md\x1b]8;;\x1b\\  \n",
+		},
+		{
+			name:       "missing member not linked",
+			extractDir: extractDir,
+			input:      "x pkg/src/missing.go\n",
+			expected:   "x pkg/src/missing.go\n",
+		},
+		{
+			name:       "without extract dir members are not linked",
+			extractDir: "",
+			input:      "x pkg/src/main.go\n",
+			expected:   "x pkg/src/main.go\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:     &buf,
+				Cwd:        cwd,
+				Hostname:   "testhost",
+				Scheme:     "file",
+				Domains:    []string{"github.com"},
+				ExtractDir: tt.extractDir,
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_PathRoots(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+	repo := filepath.Join(tmpDir, "repo")
+	cwd := filepath.Join(repo, "web")
+	shared := filepath.Join(tmpDir, "shared")
+	for _, dir := range []string{filepath.Join(repo, ".git"), filepath.Join(repo, "internal"), cwd, shared} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repoFile := writeTestFileAndResolvePath(t, filepath.Join(repo, "internal", "db.go"))
+	sharedFile := writeTestFileAndResolvePath(t, filepath.Join(shared, "util.go"))
+	cwdFile := writeTestFileAndResolvePath(t, filepath.Join(cwd, "app.go"))
+	sharedApp := writeTestFileAndResolvePath(t, filepath.Join(shared, "app.go"))
+
+	link := func(path, display string) string {
+		return "\x1b]8;;file://testhost" + path + "\x1b\\" + display + "\x1b]8;;\x1b\\"
+	}
+
+	tests := []struct {
+		name      string
+		pathRoots []string
+		input     string
+		expected  string
+	}{
+		{
+			name:     "git root after the cwd by default",
+			input:    "internal/db.go:3: unused\n",
+			expected: link(repoFile, "internal/db.go:3") + ": unused\n",
+		},
+		{
+			name:      "only under the second root",
+			pathRoots: []string{".", shared},
+			input:     "util.go\n",
+			expected:  link(sharedFile, "util.go") + "\n",
+		},
+		{
+			name:      "first root wins",
+			pathRoots: []string{".", shared},
+			input:     "app.go\n",
+			expected:  link(cwdFile, "app.go") + "\n",
+		},
+		{
+			name:      "order is the flag order",
+			pathRoots: []string{shared, "."},
+			input:     "app.go\n",
+			expected:  link(sharedApp, "app.go") + "\n",
+		},
+		{
+			name:      "flags replace the defaults",
+			pathRoots: []string{"."},
+			input:     "internal/db.go\n",
+			expected:  "internal/db.go\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:    &buf,
+				Cwd:       cwd,
+				Hostname:  "testhost",
+				Scheme:    "file",
+				Domains:   []string{"github.com"},
+				PathRoots: tt.pathRoots,
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_LinkLine(t *testing.T) {
+	cwd := t.TempDir()
+	testFile := writeTestFileAndResolvePath(t, filepath.Join(cwd, "test.go"))
+	url := "vscode://file" + testFile + ":42:5"
+	link := func(display string) string {
+		return "\x1b]8;;" + url + "\x1b\\" + display + "\x1b]8;;\x1b\\"
+	}
+
+	tests := []struct {
+		name     string
+		linkLine bool
+		input    string
+		expected string
+	}{
+		{
+			name:     "rest of line joins the file link",
+			linkLine: true,
+			input:    "test.go:42:5: undefined: foo\n",
+			expected: link("test.go:42:5") + link(": undefined: foo") + "\n",
+		},
+		{
+			name:     "CRLF stays outside the link",
+			linkLine: true,
+			input:    "test.go:42:5: undefined: foo\r\n",
+			expected: link("test.go:42:5") + link(": undefined: foo") + "\r\n",
+		},
+		{
+			name:     "only the line that starts with the file",
+			linkLine: true,
+			input:    "test.go:42:5: bad\nnext line\n",
+			expected: link("test.go:42:5") + link(": bad") + "\nnext line\n",
+		},
+		{
+			name:     "URL in the remainder keeps its own link",
+			linkLine: true,
+			input:    "test.go:42:5: see https://example.com/x for details\n",
+			expected: link("test.go:42:5") + link(": see ") +
+				"\x1b]8;;https://example.com/x\x1b\\https://example.com/x\x1b]8;;\x1b\\" +
+				link(" for details") + "\n",
+		},
+		{
+			name:     "file not at line start",
+			linkLine: true,
+			input:    "error in test.go:42:5: bad\n",
+			expected: "error in " + link("test.go:42:5") + ": bad\n",
+		},
+		{
+			name:     "file without location",
+			linkLine: true,
+			input:    "test.go is fine\n",
+			expected: "\x1b]8;;vscode://file" + testFile + "\x1b\\test.go\x1b]8;;\x1b\\ is fine\n",
+		},
+		{
+			name:     "disabled",
+			linkLine: false,
+			input:    "test.go:42:5: undefined: foo\n",
+			expected: link("test.go:42:5") + ": undefined: foo\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:   &buf,
+				Cwd:      cwd,
+				Hostname: "testhost",
+				Scheme:   "vscode",
+				Domains:  []string{"github.com"},
+				LinkLine: tt.linkLine,
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_LineTimeout(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "test.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+
+	link := "\x1b]8;;file://testhost" + testFile + "\x1b\\test.go\x1b]8;;\x1b\\"
+	// Every path candidate costs at least one clock reading, so with the
+	// fake clock below this line runs well past a 10ms deadline.
+	slowLine := strings.Repeat("a.go ", 30) + "test.go\n"
+
+	tests := []struct {
+		name          string
+		timeout       time.Duration
+		noLinkCRLines bool
+		input         string
+		expected      string
+	}{
+		{
+			name:     "disabled links every line",
+			input:    slowLine,
+			expected: strings.Repeat("a.go ", 30) + link + "\n",
+		},
+		{
+			name:     "slow line is written raw and the next line is linked",
+			timeout:  10 * time.Millisecond,
+			input:    slowLine + "see test.go\n",
+			expected: slowLine + "see " + link + "\n",
+		},
+		{
+			name:     "line before the slow line is linked",
+			timeout:  10 * time.Millisecond,
+			input:    "test.go\n" + slowLine,
+			expected: link + "\n" + slowLine,
+		},
+		{
+			name:          "slow line with NoLinkCRLines",
+			timeout:       10 * time.Millisecond,
+			noLinkCRLines: true,
+			input:         slowLine + "see test.go\n",
+			expected:      slowLine + "see " + link + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:        &buf,
+				Cwd:           tmpDir,
+				Hostname:      "testhost",
+				Domains:       []string{"github.com"},
+				NoLinkCRLines: tt.noLinkCRLines,
+				LineTimeout:   tt.timeout,
+			})
+			clock := time.Unix(0, 0)
+			linker.now = func() time.Time {
+				clock = clock.Add(time.Millisecond)
+				return clock
+			}
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_LinkHead(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "test.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+	link := "\x1b]8;;file://testhost" + testFile + "\x1b\\test.go\x1b]8;;\x1b\\"
+
+	tests := []struct {
+		name         string
+		head         int
+		lineBuffered bool
+		writes       []string
+		expected     string
+	}{
+		{
+			name:     "lines past the head are raw",
+			head:     2,
+			writes:   []string{"test.go\nsee test.go\ntest.go\nhttps://github.com/foo\n"},
+			expected: link + "\nsee " + link + "\ntest.go\nhttps://github.com/foo\n",
+		},
+		{
+			name:     "head counted across writes",
+			head:     2,
+			writes:   []string{"test.go\n", "test.go\ntest", ".go\n", "test.go\n"},
+			expected: link + "\n" + link + "\ntest.go\ntest.go\n",
+		},
+		{
+			name:     "partial line counts once finished",
+			head:     1,
+			writes:   []string{"see ", "test.go\n", "test.go\n"},
+			expected: "see " + link + "\ntest.go\n",
+		},
+		{
+			name:     "fewer lines than the head",
+			head:     5,
+			writes:   []string{"test.go\n", "test.go"},
+			expected: link + "\n" + link,
+		},
+		{
+			name:     "zero links everything",
+			writes:   []string{"test.go\ntest.go\n"},
+			expected: link + "\n" + link + "\n",
+		},
+		{
+			name:     "styled text after the head keeps its escapes",
+			head:     1,
+			writes:   []string{"test.go\n\x1b[31mtest.go\x1b[0m\n"},
+			expected: link + "\n\x1b[31mtest.go\x1b[0m\n",
+		},
+		{
+			name:         "held partial line after the head is raw",
+			head:         1,
+			lineBuffered: true,
+			writes:       []string{"test.go\ntest", ".go\n"},
+			expected:     link + "\ntest.go\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:       &buf,
+				Cwd:          tmpDir,
+				Hostname:     "testhost",
+				Domains:      []string{"github.com"},
+				LineBuffered: tt.lineBuffered,
+				LinkHead:     tt.head,
+			})
+			for _, w := range tt.writes {
+				if _, err := linker.Write([]byte(w)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := linker.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.expected {
+				t.Errorf("got  %q\nwant %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLinker_MaxLinksTotal(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "test.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+	link := "\x1b]8;;file://testhost" + testFile + "\x1b\\test.go\x1b]8;;\x1b\\"
+	urlLink := "\x1b]8;;https://github.com/foo\x1b\\https://github.com/foo\x1b]8;;\x1b\\"
+	sym := func(name string) string {
+		return "\x1b]8;;cursor://maaashjp.symbol-opener?symbol=" + name + "&cwd=" + tmpDir + "\x1b\\" + name + "\x1b]8;;\x1b\\"
+	}
+	existing := "\x1b]8;;https://example.com/x\x1b\\test.go\x1b]8;;\x1b\\"
+	// Links test.go, then runs past a 10ms LineTimeout with the fake clock
+	// below; see TestLinker_LineTimeout.
+	slowLine := "test.go " + strings.Repeat("a.go ", 30) + "\n"
+
+	tests := []struct {
+		name     string
+		max      int
+		opts     LinkerOptions
+		writes   []string
+		expected string
+	}{
+		{
+			name:     "links past the limit are not wrapped",
+			max:      2,
+			writes:   []string{"test.go test.go test.go\n", "test.go https://github.com/foo\n"},
+			expected: link + " " + link + " test.go\ntest.go https://github.com/foo\n",
+		},
+		{
+			name:     "counted across writes and kinds",
+			max:      3,
+			writes:   []string{"test.go\n", "https://github.com/foo\n", "test.go\n", "test.go\n"},
+			expected: link + "\n" + urlLink + "\n" + link + "\ntest.go\n",
+		},
+		{
+			name:     "escapes after the limit pass through",
+			max:      1,
+			writes:   []string{"test.go\n", "\x1b[31mtest.go\x1b[0m\n"},
+			expected: link + "\n\x1b[31mtest.go\x1b[0m\n",
+		},
+		{
+			name:     "under the limit",
+			max:      5,
+			writes:   []string{"test.go\n", "test.go\n"},
+			expected: link + "\n" + link + "\n",
+		},
+		{
+			name:     "symbol links count",
+			max:      2,
+			opts:     LinkerOptions{Scheme: "cursor", SymbolLinks: true},
+			writes:   []string{"\x1b[31mNewLinker ParseArgs WriteAll RunPipeMode\x1b[0m\n", "\x1b[31mNewLinker\x1b[0m\n"},
+			expected: "\x1b[31m" + sym("NewLinker") + " " + sym("ParseArgs") + " WriteAll RunPipeMode\x1b[0m\n\x1b[31mNewLinker\x1b[0m\n",
+		},
+		{
+			name:     "relinked links count",
+			max:      1,
+			opts:     LinkerOptions{RelinkExisting: true},
+			writes:   []string{existing + " " + existing + " test.go\n"},
+			expected: link + " " + existing + " test.go\n",
+		},
+		{
+			name:     "relinked link past the limit is kept as it was",
+			max:      1,
+			opts:     LinkerOptions{RelinkExisting: true},
+			writes:   []string{"test.go " + existing + "\n"},
+			expected: link + " " + existing + "\n",
+		},
+		{
+			name:     "dropped JoinStyledPaths trial run is not counted",
+			max:      2,
+			opts:     LinkerOptions{JoinStyledPaths: true},
+			writes:   []string{"test.go and gone\x1b[36m.go\x1b[0m then test.go\n"},
+			expected: link + " and gone\x1b[36m.go\x1b[0m then " + link + "\n",
+		},
+		{
+			name:     "line written raw after its timeout is not counted",
+			max:      1,
+			opts:     LinkerOptions{LineTimeout: 10 * time.Millisecond},
+			writes:   []string{slowLine, "test.go\n"},
+			expected: slowLine + link + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			opts := tt.opts
+			opts.Output = &buf
+			opts.Cwd = tmpDir
+			opts.Hostname = "testhost"
+			opts.Domains = []string{"github.com"}
+			opts.MaxLinksTotal = tt.max
+			linker := NewLinker(opts)
+			clock := time.Unix(0, 0)
+			linker.now = func() time.Time {
+				clock = clock.Add(time.Millisecond)
+				return clock
+			}
+			for _, w := range tt.writes {
+				if _, err := linker.Write([]byte(w)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := linker.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.expected {
+				t.Errorf("got  %q\nwant %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLinker_LinkExt(t *testing.T) {
+	tmpDir := t.TempDir()
+	mainGo := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "main.go"))
+	appPy := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "app.py"))
+	buildLog := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "build.log"))
+	traceLog := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "TRACE.LOG"))
+	makefile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "Makefile"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+
+	link := func(path, display string) string {
+		return "\x1b]8;;file://testhost" + path + "\x1b\\" + display + "\x1b]8;;\x1b\\"
+	}
+
+	tests := []struct {
+		name      string
+		linkExt   []string
+		noLinkExt []string
+		input     string
+		expected  string
+	}{
+		{
+			name:     "no lists link everything",
+			input:    "main.go build.log\n",
+			expected: link(mainGo, "main.go") + " " + link(buildLog, "build.log") + "\n",
+		},
+		{
+			name:     "allowlist",
+			linkExt:  []string{"go", "py"},
+			input:    "main.go:3 app.py build.log\n",
+			expected: link(mainGo, "main.go:3") + " " + link(appPy, "app.py") + " build.log\n",
+		},
+		{
+			name:     "allowlist keeps extensionless files and ./ paths",
+			linkExt:  []string{"go"},
+			input:    "Makefile ./build.log\n",
+			expected: link(makefile, "Makefile") + " " + link(buildLog, "./build.log") + "\n",
+		},
+		{
+			name:      "denylist",
+			noLinkExt: []string{"log", "tmp"},
+			input:     "main.go build.log:12 ./build.log\n",
+			expected:  link(mainGo, "main.go") + " build.log:12 ./build.log\n",
+		},
+		{
+			name:      "denylist wins over allowlist",
+			linkExt:   []string{"go", "log"},
+			noLinkExt: []string{"log"},
+			input:     "main.go build.log\n",
+			expected:  link(mainGo, "main.go") + " build.log\n",
+		},
+		{
+			name:      "extensions ignore case and a leading dot",
+			linkExt:   []string{".GO"},
+			noLinkExt: []string{".log"},
+			input:     "main.go TRACE.LOG app.py\n",
+			expected:  link(mainGo, "main.go") + " TRACE.LOG app.py\n",
+		},
+		{
+			name:      "absolute path",
+			noLinkExt: []string{"log"},
+			input:     traceLog + " " + mainGo + "\n",
+			expected:  traceLog + " " + link(mainGo, mainGo) + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:    &buf,
+				Cwd:       tmpDir,
+				Hostname:  "testhost",
+				Domains:   []string{"github.com"},
+				LinkExt:   tt.linkExt,
+				NoLinkExt: tt.noLinkExt,
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_RequireLocation(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tmpDir, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	configYAML := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "config.yaml"))
+	mainGo := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "src", "main.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+
+	link := func(path, loc, display string) string {
+		return "\x1b]8;;vscode://file" + path + loc + "\x1b\\" + display + "\x1b]8;;\x1b\\"
+	}
+
+	tests := []struct {
+		name     string
+		mode     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "off links mentions",
+			input:    "edit config.yaml\n",
+			expected: "edit " + link(configYAML, "", "config.yaml") + "\n",
+		},
+		{
+			name:     "all skips mentions",
+			mode:     "all",
+			input:    "edit config.yaml and ./config.yaml\n",
+			expected: "edit config.yaml and ./config.yaml\n",
+		},
+		{
+			name:     "all links diagnostics",
+			mode:     "all",
+			input:    "src/main.go:12:5: undefined: x\n",
+			expected: link(mainGo, ":12:5", "src/main.go:12:5") + ": undefined: x\n",
+		},
+		{
+			name:     "all skips absolute paths without a line",
+			mode:     "all",
+			input:    mainGo + " " + mainGo + ":3\n",
+			expected: mainGo + " " + link(mainGo, ":3", mainGo+":3") + "\n",
+		},
+		{
+			name:     "bare skips bare names",
+			mode:     "bare",
+			input:    "see config.yaml or src/main.go\n",
+			expected: "see config.yaml or src/main.go\n",
+		},
+		{
+			name:     "bare links explicit paths",
+			mode:     "bare",
+			input:    "./config.yaml ../" + filepath.Base(tmpDir) + "/config.yaml " + mainGo + "\n",
+			expected: link(configYAML, "", "./config.yaml") + " " + link(configYAML, "", "../"+filepath.Base(tmpDir)+"/config.yaml") + " " + link(mainGo, "", mainGo) + "\n",
+		},
+		{
+			name:     "URLs are unaffected",
+			mode:     "all",
+			input:    "github.com/foo/bar\n",
+			expected: "\x1b]8;;https://github.com/foo/bar\x1b\\github.com/foo/bar\x1b]8;;\x1b\\\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:          &buf,
+				Cwd:             tmpDir,
+				Hostname:        "testhost",
+				Scheme:          "vscode",
+				Domains:         []string{"github.com"},
+				RequireLocation: tt.mode,
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_DiffHunkHeaders(t *testing.T) {
+	tmpDir := t.TempDir()
+	aGo := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "a.go"))
+	bGo := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "b.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+
+	link := func(path, loc, display string) string {
+		return "\x1b]8;;vscode://file" + path + loc + "\x1b\\" + display + "\x1b]8;;\x1b\\"
+	}
+	header := func(path, name string) string {
+		return "--- " + link(path, "", "a/"+name) + "\n+++ " + link(path, "", "b/"+name) + "\n"
+	}
+
+	tests := []struct {
+		name        string
+		symbolLinks bool
+		writes      []string
+		expected    string
+	}{
+		{
+			name:     "hunk links to the new start line",
+			writes:   []string{"--- a/a.go\n+++ b/a.go\n@@ -12,7 +15,9 @@ func main() {\n+x\n"},
+			expected: header(aGo, "a.go") + link(aGo, ":15", "@@ -12,7 +15,9 @@") + " func main() {\n+x\n",
+		},
+		{
+			name:     "hunks follow the current file",
+			writes:   []string{"+++ b/a.go\n@@ -1 +1 @@\n+++ b/b.go\n@@ -3,2 +4 @@\n"},
+			expected: "+++ " + link(aGo, "", "b/a.go") + "\n" + link(aGo, ":1", "@@ -1 +1 @@") + "\n+++ " + link(bGo, "", "b/b.go") + "\n" + link(bGo, ":4", "@@ -3,2 +4 @@") + "\n",
+		},
+		{
+			name:     "file and hunk in separate writes",
+			writes:   []string{"+++ b/a.go\n", "@@ -1,2 +1,3 @@\n"},
+			expected: "+++ " + link(aGo, "", "b/a.go") + "\n" + link(aGo, ":1", "@@ -1,2 +1,3 @@") + "\n",
+		},
+		{
+			name:        "colored diff with symbol links",
+			symbolLinks: true,
+			writes:      []string{"\x1b[1m+++ b/a.go\x1b[m\n\x1b[36m@@ -5 +6 @@\x1b[m x\n"},
+			expected:    "\x1b[1m+++ " + link(aGo, "", "b/a.go") + "\x1b[m\n\x1b[36m" + link(aGo, ":6", "@@ -5 +6 @@") + "\x1b[m x\n",
+		},
+		{
+			name:     "empty new side links line 1",
+			writes:   []string{"+++ b/a.go\n@@ -1,3 +0,0 @@\n"},
+			expected: "+++ " + link(aGo, "", "b/a.go") + "\n" + link(aGo, ":1", "@@ -1,3 +0,0 @@") + "\n",
+		},
+		{
+			name:     "no file seen",
+			writes:   []string{"@@ -1 +1 @@\n"},
+			expected: "@@ -1 +1 @@\n",
+		},
+		{
+			name:     "deleted file",
+			writes:   []string{"+++ b/a.go\n@@ -1 +1 @@\n+++ /dev/null\n@@ -1 +0,0 @@\n"},
+			expected: "+++ " + link(aGo, "", "b/a.go") + "\n" + link(aGo, ":1", "@@ -1 +1 @@") + "\n+++ " + link("/dev/null", "", "/dev/null") + "\n@@ -1 +0,0 @@\n",
+		},
+		{
+			name:     "unresolved file",
+			writes:   []string{"+++ b/a.go\n+++ b/gone.go\n@@ -1 +1 @@\n"},
+			expected: "+++ " + link(aGo, "", "b/a.go") + "\n+++ b/gone.go\n@@ -1 +1 @@\n",
+		},
+		{
+			name:     "not at line start",
+			writes:   []string{"+++ b/a.go\nsee @@ -1 +1 @@\n"},
+			expected: "+++ " + link(aGo, "", "b/a.go") + "\nsee @@ -1 +1 @@\n",
+		},
+		{
+			name:     "inside an existing link",
+			writes:   []string{"+++ b/a.go\n\x1b]8;;https://example.com\x1b\\@@ -1 +1 @@\x1b]8;;\x1b\\\n"},
+			expected: "+++ " + link(aGo, "", "b/a.go") + "\n\x1b]8;;https://example.com\x1b\\@@ -1 +1 @@\x1b]8;;\x1b\\\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:      &buf,
+				Cwd:         tmpDir,
+				Hostname:    "testhost",
+				Scheme:      "vscode",
+				Domains:     []string{"github.com"},
+				SymbolLinks: tt.symbolLinks,
+			})
+			for _, w := range tt.writes {
+				if _, err := linker.Write([]byte(w)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := linker.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.expected {
+				t.Errorf("got  %q\nwant %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLinker_GroupFileLinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	aGo := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "a.go"))
+	bGo := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "b.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+
+	newLinker := func(buf *bytes.Buffer, group bool) *Linker {
+		return NewLinker(LinkerOptions{
+			Output:         buf,
+			Cwd:            tmpDir,
+			Hostname:       "testhost",
+			Scheme:         "vscode",
+			Domains:        []string{"github.com"},
+			GroupFileLinks: group,
+		})
+	}
+
+	t.Run("id parameter", func(t *testing.T) {
+		var buf bytes.Buffer
+		linker := newLinker(&buf, true)
+		id := linker.fileLinkID(aGo)
+		assertWrite(t, linker, "a.go:3\n",
+			"\x1b]8;id="+id+";vscode://file"+aGo+":3\x1b\\a.go:3\x1b]8;;\x1b\\\n")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		var buf bytes.Buffer
+		assertWrite(t, newLinker(&buf, false), "a.go:3\n",
+			"\x1b]8;;vscode://file"+aGo+":3\x1b\\a.go:3\x1b]8;;\x1b\\\n")
+	})
+
+	t.Run("ids per file and diff block", func(t *testing.T) {
+		var buf bytes.Buffer
+		linker := newLinker(&buf, true)
+		input := "diff --git a/a.go b/a.go\n" +
+			"--- a/a.go\n" +
+			"+++ b/a.go\n" +
+			"@@ -1,2 +1,3 @@\n" +
+			"+// see a.go:10 and b.go:2\n" +
+			"diff --git a/b.go b/b.go\n" +
+			"+++ b/b.go\n" +
+			"@@ -4 +4 @@\n" +
+			"+// moved from a.go:10\n"
+		if _, err := linker.Write([]byte(input)); err != nil {
+			t.Fatal(err)
+		}
+
+		// Collect the id of every link, by block and file.
+		ids := make([]map[string][]string, 2)
+		block := -1
+		linkPattern := regexp.MustCompile(`\x1b\]8;id=([^;]*);vscode://file([^:\x1b]*)`)
+		for _, line := range strings.SplitAfter(buf.String(), "\n") {
+			if strings.HasPrefix(line, "diff --git ") {
+				block++
+				ids[block] = make(map[string][]string)
+			}
+			for _, m := range linkPattern.FindAllStringSubmatch(line, -1) {
+				ids[block][m[2]] = append(ids[block][m[2]], m[1])
+			}
+		}
+
+		first, second := ids[0], ids[1]
+		// diff --git a/ and b/, ---, +++, the hunk header and a.go:10.
+		if len(first[aGo]) != 6 {
+			t.Fatalf("first block: got %d a.go links, want 6 (output %q)", len(first[aGo]), buf.String())
+		}
+		for _, id := range first[aGo] {
+			if id != first[aGo][0] {
+				t.Errorf("first block: a.go links have ids %q, want one id", first[aGo])
+				break
+			}
+		}
+		if len(first[bGo]) != 1 || first[bGo][0] == first[aGo][0] {
+			t.Errorf("first block: b.go ids %q, want one id other than a.go's %q", first[bGo], first[aGo][0])
+		}
+		if len(second[aGo]) != 1 || second[aGo][0] == first[aGo][0] {
+			t.Errorf("second block: a.go ids %q, want one id other than the first block's %q", second[aGo], first[aGo][0])
+		}
+		if len(second[bGo]) == 0 || second[bGo][0] == first[bGo][0] {
+			t.Errorf("second block: b.go ids %q, want an id other than the first block's %q", second[bGo], first[bGo])
+		}
+	})
+}
+
+func TestLinker_BatHeader(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tmpDir, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	mainGo := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "src", "main.go"))
+	notes := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "my notes"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+
+	link := func(path, display string) string {
+		return "\x1b]8;;vscode://file" + path + "\x1b\\" + display + "\x1b]8;;\x1b\\"
+	}
+	grid := "───────┬────────\n"
+
+	tests := []struct {
+		name      string
+		batHeader bool
+		writes    []string
+		expected  string
+	}{
+		{
+			name:      "plain header",
+			batHeader: true,
+			writes:    []string{"File: src/main.go\n   1 package main\n"},
+			expected:  "File: " + link(mainGo, "src/main.go") + "\n   1 package main\n",
+		},
+		{
+			name:      "header in the grid",
+			batHeader: true,
+			writes:    []string{grid + "       │ File: src/main.go\n" + grid + "  42   │ func main() {\n"},
+			expected:  grid + "       │ File: " + link(mainGo, "src/main.go") + "\n" + grid + "  42   │ func main() {\n",
+		},
+		{
+			name:      "colored header",
+			batHeader: true,
+			writes:    []string{"\x1b[38;5;238m       │ \x1b[0mFile: \x1b[1msrc/main.go\x1b[0m\n"},
+			expected:  "\x1b[38;5;238m       │ \x1b[0mFile: \x1b[1m" + link(mainGo, "src/main.go") + "\x1b[0m\n",
+		},
+		{
+			name:      "name split from its label across writes",
+			batHeader: true,
+			writes:    []string{"File: ", "src/main.go\n"},
+			expected:  "File: " + link(mainGo, "src/main.go") + "\n",
+		},
+		{
+			name:      "name with spaces and no extension",
+			batHeader: true,
+			writes:    []string{"File: my notes   <EMPTY>\n"},
+			expected:  "File: " + link(notes, "my notes") + "   <EMPTY>\n",
+		},
+		{
+			name:      "stdin is not a file",
+			batHeader: true,
+			writes:    []string{"File: STDIN\n"},
+			expected:  "File: STDIN\n",
+		},
+		{
+			name:      "gutter numbers are not locations",
+			batHeader: true,
+			writes:    []string{"  10 │ src/main.go\n"},
+			expected:  "  10 │ " + link(mainGo, "src/main.go") + "\n",
+		},
+		{
+			name:      "not at line start",
+			batHeader: true,
+			writes:    []string{"see File: my notes\n"},
+			expected:  "see File: my notes\n",
+		},
+		{
+			name:     "disabled by default",
+			writes:   []string{"File: my notes\n"},
+			expected: "File: my notes\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:      &buf,
+				Cwd:         tmpDir,
+				Hostname:    "testhost",
+				Scheme:      "vscode",
+				Domains:     []string{"github.com"},
+				SymbolLinks: true,
+				BatHeader:   tt.batHeader,
+			})
+			for _, w := range tt.writes {
+				if _, err := linker.Write([]byte(w)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := linker.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.expected {
+				t.Errorf("got  %q\nwant %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLinker_LinkGoMod(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, "bar"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	localBar, _ := filepath.EvalSymlinks(filepath.Join(tmpDir, "bar"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+
+	link := func(url, display string) string {
+		return "\x1b]8;;" + url + "\x1b\\" + display + "\x1b]8;;\x1b\\"
+	}
+	mod := func(path string) string {
+		return link("https://pkg.go.dev/"+path, path)
+	}
+	ver := func(path, version string) string {
+		return link("https://pkg.go.dev/"+path+"@"+version, version)
+	}
+
+	tests := []struct {
+		name      string
+		linkGoMod bool
+		input     string
+		expected  string
+	}{
+		{
+			name:      "require directive",
+			linkGoMod: true,
+			input:     "require github.com/foo/bar v1.2.3\n",
+			expected:  "require " + mod("github.com/foo/bar") + " " + ver("github.com/foo/bar", "v1.2.3") + "\n",
+		},
+		{
+			name:      "require block line",
+			linkGoMod: true,
+			input:     "\tgolang.org/x/text v0.3.8\n",
+			expected:  "\t" + mod("golang.org/x/text") + " " + ver("golang.org/x/text", "v0.3.8") + "\n",
+		},
+		{
+			name:      "pseudo-version and major version suffix",
+			linkGoMod: true,
+			input:     "require github.com/foo/bar/v2 v2.0.0-20240101000000-abcdef123456\n",
+			expected:  "require " + mod("github.com/foo/bar/v2") + " " + ver("github.com/foo/bar/v2", "v2.0.0-20240101000000-abcdef123456") + "\n",
+		},
+		{
+			name:      "exclude directive",
+			linkGoMod: true,
+			input:     "exclude github.com/foo/bar v1.2.3\n",
+			expected:  "exclude " + mod("github.com/foo/bar") + " " + ver("github.com/foo/bar", "v1.2.3") + "\n",
+		},
+		{
+			name:      "replace links both sides",
+			linkGoMod: true,
+			input:     "replace github.com/a/b v1.0.0 => github.com/c/d v1.1.0\n",
+			expected:  "replace " + mod("github.com/a/b") + " " + ver("github.com/a/b", "v1.0.0") + " => " + mod("github.com/c/d") + " " + ver("github.com/c/d", "v1.1.0") + "\n",
+		},
+		{
+			name:      "replace with local path",
+			linkGoMod: true,
+			input:     "replace github.com/a/b => ./bar\n",
+			expected:  "replace " + mod("github.com/a/b") + " => " + link("file://testhost"+localBar, "./bar") + "\n",
+		},
+		{
+			name:      "module directive",
+			linkGoMod: true,
+			input:     "module github.com/me/proj\n",
+			expected:  "module " + mod("github.com/me/proj") + "\n",
+		},
+		{
+			name:      "go get output",
+			linkGoMod: true,
+			input:     "go: added github.com/foo/bar v1.2.3\n",
+			expected:  "go: added " + mod("github.com/foo/bar") + " " + ver("github.com/foo/bar", "v1.2.3") + "\n",
+		},
+		{
+			name:      "bare domain without version stays a github link",
+			linkGoMod: true,
+			input:     "see github.com/foo/bar\n",
+			expected:  "see " + link("https://github.com/foo/bar", "github.com/foo/bar") + "\n",
+		},
+		{
+			name:     "disabled",
+			input:    "require github.com/foo/bar v1.2.3\n",
+			expected: "require " + link("https://github.com/foo/bar", "github.com/foo/bar") + " v1.2.3\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:    &buf,
+				Cwd:       tmpDir,
+				Hostname:  "testhost",
+				Domains:   []string{"github.com"},
+				LinkGoMod: tt.linkGoMod,
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+// osc8Sequence matches the opening and closing sequences of OSC 8 links.
+var osc8Sequence = regexp.MustCompile(`\x1b\]8;[^\x07\x1b]*(?:\x07|\x1b\\)`)
+
+func TestLinker_LinkGoPkgErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	appYAML := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "app.yaml"))
+	spaced := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "app config"))
+	buildDir := filepath.Join(tmpDir, "build")
+	if err := os.Mkdir(buildDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+	buildDir, _ = filepath.EvalSymlinks(buildDir)
+
+	link := func(path, display string) string {
+		return "\x1b]8;;vscode://file" + path + "\x1b\\" + display + "\x1b]8;;\x1b\\"
+	}
+
+	tests := []struct {
+		name     string
+		enabled  bool
+		input    string
+		expected string
+	}{
+		{
+			name:     "wrapped open error",
+			enabled:  true,
+			input:    "failed to open config: open " + appYAML + ": permission denied\n",
+			expected: "failed to open config: open " + link(appYAML, appYAML) + ": permission denied\n",
+		},
+		{
+			name:     "path with spaces",
+			enabled:  true,
+			input:    "open app config: is a directory\n",
+			expected: "open " + link(spaced, "app config") + ": is a directory\n",
+		},
+		{
+			name:     "extensionless name",
+			enabled:  true,
+			input:    "mkdir build: file exists\n",
+			expected: "mkdir " + link(buildDir, "build") + ": file exists\n",
+		},
+		{
+			name:     "missing file",
+			enabled:  true,
+			input:    "open " + filepath.Join(tmpDir, "gone.yaml") + ": no such file or directory\n",
+			expected: "open " + filepath.Join(tmpDir, "gone.yaml") + ": no such file or directory\n",
+		},
+		{
+			name:     "first existing path wins, later paths still link",
+			enabled:  true,
+			input:    "stat gone: no such file or directory; stat build: not a directory; see app.yaml\n",
+			expected: "stat gone: no such file or directory; stat " + link(buildDir, "build") + ": not a directory; see " + link(appYAML, "app.yaml") + "\n",
+		},
+		{
+			name:     "not an errno",
+			enabled:  true,
+			input:    "open build: done\n",
+			expected: "open build: done\n",
+		},
+		{
+			name:     "disabled",
+			input:    "open app config: is a directory\n",
+			expected: "open app config: is a directory\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:          &buf,
+				Cwd:             tmpDir,
+				Hostname:        "testhost",
+				Scheme:          "vscode",
+				Domains:         []string{"github.com"},
+				LinkGoPkgErrors: tt.enabled,
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_LinkGoRace(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tmpDir, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	fooGo := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "src", "foo.go"))
+	mainGo := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "main.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+
+	link := func(path, loc, display string) string {
+		return "\x1b]8;;vscode://file" + path + loc + "\x1b\\" + display + "\x1b]8;;\x1b\\"
+	}
+
+	report := "==================\n" +
+		"WARNING: DATA RACE\n" +
+		"Read at 0x00c0000a4010 by goroutine 7:\n" +
+		"  main.foo()\n" +
+		"      github.com/me/app/src/foo.go:10 +0x3c\n" +
+		"  main.main.func1()\n" +
+		"      /home/ci/app/main.go:22 +0x44\n" +
+		"\n" +
+		"Previous write at 0x00c0000a4010 by main goroutine:\n" +
+		"  main.main()\n" +
+		"      " + mainGo + ":18 +0x1f8\n" +
+		"\n" +
+		"Goroutine 7 (running) created at:\n" +
+		"  main.main()\n" +
+		"      main.go:20 +0x1e4\n" +
+		"==================\n"
+	linked := "==================\n" +
+		"WARNING: DATA RACE\n" +
+		"Read at 0x00c0000a4010 by goroutine 7:\n" +
+		"  main.foo()\n" +
+		"      " + link(fooGo, ":10", "github.com/me/app/src/foo.go:10") + " +0x3c\n" +
+		"  main.main.func1()\n" +
+		"      " + link(mainGo, ":22", "/home/ci/app/main.go:22") + " +0x44\n" +
+		"\n" +
+		"Previous write at 0x00c0000a4010 by main goroutine:\n" +
+		"  main.main()\n" +
+		"      " + link(mainGo, ":18", mainGo+":18") + " +0x1f8\n" +
+		"\n" +
+		"Goroutine 7 (running) created at:\n" +
+		"  main.main()\n" +
+		"      " + link(mainGo, ":20", "main.go:20") + " +0x1e4\n" +
+		"==================\n"
+
+	tests := []struct {
+		name     string
+		enabled  bool
+		input    string
+		expected string
+	}{
+		{
+			name:     "two-section race report",
+			enabled:  true,
+			input:    report,
+			expected: linked,
+		},
+		{
+			name:     "panic frame",
+			enabled:  true,
+			input:    "goroutine 1 [running]:\nmain.main()\n\t/build/app/src/foo.go:7 +0x1d\nexit status 2\n",
+			expected: "goroutine 1 [running]:\nmain.main()\n\t" + link(fooGo, ":7", "/build/app/src/foo.go:7") + " +0x1d\nexit status 2\n",
+		},
+		{
+			name:     "frame that resolves nowhere",
+			enabled:  true,
+			input:    "      /opt/go-nowhere/src/runtime/proc.go:283 +0x28b\n",
+			expected: "      /opt/go-nowhere/src/runtime/proc.go:283 +0x28b\n",
+		},
+		{
+			name:     "not a frame line",
+			enabled:  true,
+			input:    "see /home/ci/app/main.go:22 for details\n",
+			expected: "see /home/ci/app/main.go:22 for details\n",
+		},
+		{
+			name:     "disabled",
+			input:    "      github.com/me/app/src/foo.go:10 +0x3c\n",
+			expected: "      \x1b]8;;https://github.com/me/app/src/foo.go:10\x1b\\github.com/me/app/src/foo.go:10\x1b]8;;\x1b\\ +0x3c\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:     &buf,
+				Cwd:        tmpDir,
+				Hostname:   "testhost",
+				Scheme:     "vscode",
+				Domains:    []string{"github.com"},
+				LinkGoRace: tt.enabled,
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_JSONPaths(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tmpDir, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	mainGo := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "src", "main.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+
+	link := func(loc, display string) string {
+		return "\x1b]8;;vscode://file" + mainGo + loc + "\x1b\\" + display + "\x1b]8;;\x1b\\"
+	}
+	escapedAbs := strings.ReplaceAll(mainGo, "/", `\/`)
+
+	tests := []struct {
+		name     string
+		enabled  bool
+		input    string
+		expected string
+	}{
+		{
+			name:     "Windows path",
+			enabled:  true,
+			input:    `{"level":"error","file":"C:\\src\\main.go","msg":"boom"}` + "\n",
+			expected: `{"level":"error","file":"` + link("", `C:\\src\\main.go`) + `","msg":"boom"}` + "\n",
+		},
+		{
+			name:     "Windows path found by its tail",
+			enabled:  true,
+			input:    `{"file": "D:\\work\\app\\src\\main.go"}` + "\n",
+			expected: `{"file": "` + link("", `D:\\work\\app\\src\\main.go`) + `"}` + "\n",
+		},
+		{
+			name:     "relative Windows path with location",
+			enabled:  true,
+			input:    `{"caller": "src\\main.go:12:5"}` + "\n",
+			expected: `{"caller": "` + link(":12:5", `src\\main.go:12:5`) + `"}` + "\n",
+		},
+		{
+			name:     "escaped slashes",
+			enabled:  true,
+			input:    `{"file":"` + escapedAbs + `"}` + "\n",
+			expected: `{"file":"` + link("", escapedAbs) + `"}` + "\n",
+		},
+		{
+			name:     "missing file",
+			enabled:  true,
+			input:    `{"file":"C:\\src\\gone.go"}` + "\n",
+			expected: `{"file":"C:\\src\\gone.go"}` + "\n",
+		},
+		{
+			name:     "other escapes mean not a path",
+			enabled:  true,
+			input:    `{"msg":"src\\main.go\nfailed"}` + "\n",
+			expected: `{"msg":"src\\main.go\nfailed"}` + "\n",
+		},
+		{
+			name:     "disabled",
+			input:    `{"file":"C:\\src\\main.go"}` + "\n",
+			expected: `{"file":"C:\\src\\main.go"}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:    &buf,
+				Cwd:       tmpDir,
+				Hostname:  "testhost",
+				Scheme:    "vscode",
+				Domains:   []string{"github.com"},
+				JSONPaths: tt.enabled,
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_ProseLocations(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tmpDir, "modules"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	mainTF := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "main.tf"))
+	vpcTF := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "modules", "vpc.tf"))
+	playbook := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "playbook.yml"))
+	compose := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "compose.yml"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+
+	link := func(path, loc, display string) string {
+		return "\x1b]8;;vscode://file" + path + loc + "\x1b\\" + display + "\x1b]8;;\x1b\\"
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "terraform",
+			input:    "│   on main.tf line 10, in resource \"aws_instance\" \"web\":\n",
+			expected: "│   on " + link(mainTF, ":10", "main.tf") + " line 10, in resource \"aws_instance\" \"web\":\n",
+		},
+		{
+			name:     "terraform module",
+			input:    "  on modules/vpc.tf line 3:\n",
+			expected: "  on " + link(vpcTF, ":3", "modules/vpc.tf") + " line 3:\n",
+		},
+		{
+			name:     "ansible",
+			input:    "The error appears to be in '" + playbook + "': line 5, column 3, but may\n",
+			expected: "The error appears to be in '" + link(playbook, ":5:3", playbook) + "': line 5, column 3, but may\n",
+		},
+		{
+			name:     "ansible without column",
+			input:    "The error appears to be in '" + playbook + "': line 5\n",
+			expected: "The error appears to be in '" + link(playbook, ":5", playbook) + "': line 5\n",
+		},
+		{
+			name:     "pyyaml",
+			input:    "  in \"./compose.yml\", line 7, column 12\n",
+			expected: "  in \"" + link(compose, ":7:12", "./compose.yml") + "\", line 7, column 12\n",
+		},
+		{
+			name:     "missing file",
+			input:    "  on missing.tf line 10, in resource:\n",
+			expected: "  on missing.tf line 10, in resource:\n",
+		},
+		{
+			name:     "prose without a file",
+			input:    "failed on line 10, see above\n",
+			expected: "failed on line 10, see above\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:   &buf,
+				Cwd:      tmpDir,
+				Hostname: "testhost",
+				Scheme:   "vscode",
+				Domains:  []string{"github.com"},
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_PreservesText(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "main.go"))
+	writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "README.md"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+
+	inputs := []string{
+		"main.go\n",
+		"main.go   \n",
+		"   main.go\n",
+		"\tmain.go:12\t\n",
+		"main.go:12:3  \r\n",
+		"main.go \n  README.md  \n",
+		"see main.go.  \n",
+		"main.go:10,15   \n",
+		"a.go:1, main.go:2 \n",
+		"https://example.com/x  \n",
+		"(https://example.com/x)  \n",
+		"github.com/mash/osc8wrap \t\n",
+		"  \x1b[31mNewLinker\x1b[0m  \n",
+		"\x1b[1m main.go \x1b[0m \n",
+		"main.go:12: error: \x1b[31mundefined\x1b[0m   \n",
+		"--- FAIL: TestFoo (0.00s)  \n",
+		"require github.com/foo/bar v1.2.3  // indirect\n",
+		"main.go\u00a0\u3000\n",
+		"main.go",
+		"   ",
+		"\n\n  \n",
+	}
+	variants := []struct {
+		name string
+		opts LinkerOptions
+	}{
+		{name: "file"},
+		{name: "vscode", opts: LinkerOptions{Scheme: "vscode", SymbolLinks: true}},
+		{name: "link line", opts: LinkerOptions{Scheme: "vscode", LinkLine: true}},
+		{name: "go", opts: LinkerOptions{LinkTestNames: true, LinkGoMod: true}},
+		{name: "no link CR lines", opts: LinkerOptions{NoLinkCRLines: true, LineTimeout: time.Hour}},
+		{name: "line buffered", opts: LinkerOptions{Scheme: "cursor", SymbolLinks: true, LineBuffered: true}},
+		{name: "line separators", opts: LinkerOptions{LineSeparators: "@"}},
+	}
+
+	for _, v := range variants {
+		for _, input := range inputs {
+			t.Run(v.name+"/"+strconv.Quote(input), func(t *testing.T) {
+				var buf bytes.Buffer
+				opts := v.opts
+				opts.Output = &buf
+				opts.Cwd = tmpDir
+				opts.Hostname = "testhost"
+				opts.Domains = []string{"github.com"}
+				for _, chunk := range []int{len(input), 1} {
+					buf.Reset()
+					linker := NewLinker(opts)
+					for rest := []byte(input); len(rest) > 0; {
+						n := min(chunk, len(rest))
+						if _, err := linker.Write(rest[:n]); err != nil {
+							t.Fatal(err)
+						}
+						rest = rest[n:]
+					}
+					if err := linker.Flush(); err != nil {
+						t.Fatal(err)
+					}
+					if got := osc8Sequence.ReplaceAllString(buf.String(), ""); got != input {
+						t.Errorf("text changed writing %d bytes at a time:\n got %q\nwant %q\n out %q", chunk, got, input, buf.String())
+					}
+				}
+			})
+		}
+	}
+}
+
+type errWriter struct{ err error }
+
+func (w errWriter) Write([]byte) (int, error) { return 0, w.err }
+
+func TestLinker_Tee(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "main.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+
+	newLinker := func(buf *bytes.Buffer, lineBuffered bool) *Linker {
+		return NewLinker(LinkerOptions{
+			Output:       buf,
+			Cwd:          tmpDir,
+			Hostname:     "testhost",
+			Scheme:       "vscode",
+			Domains:      []string{"github.com"},
+			LineBuffered: lineBuffered,
+		})
+	}
+
+	t.Run("copy is unlinked", func(t *testing.T) {
+		var buf, tee bytes.Buffer
+		linker := newLinker(&buf, false)
+		linker.SetTee(&tee)
+
+		input := "\x1b[31merror\x1b[0m in main.go:3\n"
+		assertWrite(t, linker, input,
+			"\x1b[31merror\x1b[0m in \x1b]8;;vscode://file"+testFile+":3\x1b\\main.go:3\x1b]8;;\x1b\\\n")
+		if got := tee.String(); got != input {
+			t.Errorf("tee got %q, want %q", got, input)
+		}
+	})
+
+	t.Run("held partial line is copied at once", func(t *testing.T) {
+		var buf, tee bytes.Buffer
+		linker := newLinker(&buf, true)
+		linker.SetTee(&tee)
+
+		_, _ = linker.Write([]byte("main.go"))
+		if got := tee.String(); got != "main.go" {
+			t.Errorf("tee got %q before the newline, want %q", got, "main.go")
+		}
+		if got := buf.String(); got != "" {
+			t.Errorf("output got %q before the newline, want it held", got)
+		}
+	})
+
+	t.Run("failing tee keeps the output going", func(t *testing.T) {
+		var buf bytes.Buffer
+		linker := newLinker(&buf, false)
+		linker.SetTee(errWriter{errors.New("disk full")})
+
+		assertWrite(t, linker, "main.go\n",
+			"\x1b]8;;vscode://file"+testFile+"\x1b\\main.go\x1b]8;;\x1b\\\n")
+		if linker.tee != nil {
+			t.Error("tee still set after a failed write")
+		}
+	})
+}
+
+func TestLinker_AltScreen(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "main.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+	link := "\x1b]8;;vscode://file" + testFile + ":3\x1b\\main.go:3\x1b]8;;\x1b\\"
+
+	tests := []struct {
+		name         string
+		writes       []string
+		lineBuffered bool
+		expected     string
+	}{
+		{
+			name:     "1049 on and off",
+			writes:   []string{"main.go:3\n\x1b[?1049hmain.go:3\r\n\x1b[?1049lmain.go:3\n"},
+			expected: link + "\n\x1b[?1049hmain.go:3\r\n\x1b[?1049l" + link + "\n",
+		},
+		{
+			name:     "sequence split across writes",
+			writes:   []string{"\x1b[?10", "49hmain.go:3 ", "\x1b[?1049", "l main.go:3\n"},
+			expected: "\x1b[?1049hmain.go:3 \x1b[?1049l " + link + "\n",
+		},
+		{
+			name:     "1047 and 47",
+			writes:   []string{"\x1b[?1047hmain.go:3\x1b[?1047l\x1b[?47hmain.go:3\x1b[?47l main.go:3\n"},
+			expected: "\x1b[?1047hmain.go:3\x1b[?1047l\x1b[?47hmain.go:3\x1b[?47l " + link + "\n",
+		},
+		{
+			name:     "mode among others",
+			writes:   []string{"\x1b[?1;1049hmain.go:3\n"},
+			expected: "\x1b[?1;1049hmain.go:3\n",
+		},
+		{
+			name:     "other private modes are not the alternate screen",
+			writes:   []string{"\x1b[?25l\x1b[?2004hmain.go:3\n"},
+			expected: "\x1b[?25l\x1b[?2004h" + link + "\n",
+		},
+		{
+			name:         "nothing is held back on the alternate screen",
+			writes:       []string{"\x1b[?1049h\n", "main.go:3"},
+			lineBuffered: true,
+			expected:     "\x1b[?1049h\nmain.go:3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:       &buf,
+				Cwd:          tmpDir,
+				Hostname:     "testhost",
+				Scheme:       "vscode",
+				Domains:      []string{"github.com"},
+				LineBuffered: tt.lineBuffered,
+				IdleFlush:    time.Hour,
+			})
+			for _, w := range tt.writes {
+				if _, err := linker.Write([]byte(w)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !tt.lineBuffered {
+				if err := linker.Flush(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := buf.String(); got != tt.expected {
+				t.Errorf("got  %q\nwant %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLinker_BracketedPaste(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "main.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+	link := "\x1b]8;;vscode://file" + testFile + ":3\x1b\\main.go:3\x1b]8;;\x1b\\"
+
+	tests := []struct {
+		name     string
+		writes   []string
+		expected string
+	}{
+		{
+			name:     "pasted text is left alone",
+			writes:   []string{">>> \x1b[200~open('main.go:3')\nhttps://example.com\x1b[201~ main.go:3\n"},
+			expected: ">>> \x1b[200~open('main.go:3')\nhttps://example.com\x1b[201~ " + link + "\n",
+		},
+		{
+			name:     "markers split across writes",
+			writes:   []string{"\x1b[20", "0~main.go:3\x1b[2", "01~main.go:3\n"},
+			expected: "\x1b[200~main.go:3\x1b[201~" + link + "\n",
+		},
+		{
+			name:     "styled pasted text is not symbol-linked",
+			writes:   []string{"\x1b[200~\x1b[31mNewLinker\x1b[0m\x1b[201~\n"},
+			expected: "\x1b[200~\x1b[31mNewLinker\x1b[0m\x1b[201~\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:      &buf,
+				Cwd:         tmpDir,
+				Hostname:    "testhost",
+				Scheme:      "vscode",
+				Domains:     []string{"github.com"},
+				SymbolLinks: true,
+			})
+			for _, w := range tt.writes {
+				if _, err := linker.Write([]byte(w)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := linker.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.expected {
+				t.Errorf("got  %q\nwant %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLinker_MaxLineLen(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "main.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+	link := "\x1b]8;;vscode://file" + testFile + ":3\x1b\\main.go:3\x1b]8;;\x1b\\"
+	long := strings.Repeat("x", 20) + " main.go:3"
+
+	tests := []struct {
+		name     string
+		writes   []string
+		expected string
+	}{
+		{
+			name:     "short line is linked",
+			writes:   []string{"see main.go:3\n"},
+			expected: "see " + link + "\n",
+		},
+		{
+			name:     "long line is raw, the next is linked",
+			writes:   []string{long + "\nmain.go:3\n"},
+			expected: long + "\n" + link + "\n",
+		},
+		{
+			name:     "lines on both sides of a long one",
+			writes:   []string{"main.go:3\n" + long + "\n" + "main.go:3"},
+			expected: link + "\n" + long + "\n" + link,
+		},
+		{
+			name:     "line grows past the limit across writes",
+			writes:   []string{"a main.go:3 ", "and more text main.go:3", " main.go:3\n", "main.go:3\n"},
+			expected: "a " + link + " and more text main.go:3 main.go:3\n" + link + "\n",
+		},
+		{
+			name:     "escape sequences do not count",
+			writes:   []string{"\x1b[1m\x1b[0m\x1b[1m\x1b[0m\x1b[1m\x1b[0m main.go:3\n"},
+			expected: "\x1b[1m\x1b[0m\x1b[1m\x1b[0m\x1b[1m\x1b[0m " + link + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:     &buf,
+				Cwd:        tmpDir,
+				Hostname:   "testhost",
+				Scheme:     "vscode",
+				Domains:    []string{"github.com"},
+				MaxLineLen: 20,
+			})
+			for _, w := range tt.writes {
+				if _, err := linker.Write([]byte(w)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := linker.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.expected {
+				t.Errorf("got  %q\nwant %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLinker_ReadFrom(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "main.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+	link := "\x1b]8;;vscode://file" + testFile + ":3\x1b\\main.go:3\x1b]8;;\x1b\\"
+	errRead := errors.New("read failed")
+
+	tests := []struct {
+		name     string
+		reader   io.Reader
+		wantN    int64
+		wantErr  error
+		expected string
+	}{
+		{
+			name:     "held line is flushed at EOF",
+			reader:   strings.NewReader("ok\nsee main.go:3"),
+			wantN:    16,
+			expected: "ok\nsee " + link,
+		},
+		{
+			name:     "one byte at a time",
+			reader:   iotest.OneByteReader(strings.NewReader("see main.go:3\n")),
+			wantN:    14,
+			expected: "see " + link + "\n",
+		},
+		{
+			name:     "read error is returned after the flush",
+			reader:   io.MultiReader(strings.NewReader("see main.go:3"), iotest.ErrReader(errRead)),
+			wantN:    13,
+			wantErr:  errRead,
+			expected: "see " + link,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:       &buf,
+				Cwd:          tmpDir,
+				Hostname:     "testhost",
+				Scheme:       "vscode",
+				Domains:      []string{"github.com"},
+				LineBuffered: true,
+			})
+			n, err := linker.ReadFrom(tt.reader)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ReadFrom() error = %v, want %v", err, tt.wantErr)
+			}
+			if n != tt.wantN {
+				t.Errorf("ReadFrom() = %d bytes, want %d", n, tt.wantN)
+			}
+			if got := buf.String(); got != tt.expected {
+				t.Errorf("got  %q\nwant %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestLinker_DebugLogReplays checks that --debug-writes logs stay readable
+// by osc8wrap-replay, whichever path a Write takes through the Linker.
+func TestLinker_DebugLogReplays(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs osc8wrap-replay with go run")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go not in PATH")
+	}
+	tmpDir := t.TempDir()
+	writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "main.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+
+	tests := []struct {
+		name   string
+		opts   LinkerOptions
+		writes []string
+	}{
+		{
+			name:   "link head reached",
+			opts:   LinkerOptions{LinkHead: 1},
+			writes: []string{"main.go:3\n", "main.go:3\n", "main.go:3\n"},
+		},
+		{
+			name:   "terminal without OSC 8 support",
+			opts:   LinkerOptions{DetectTerminal: true, Environ: []string{"TERM_PROGRAM=Apple_Terminal"}},
+			writes: []string{"main.go:3\n", "main.go:3\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "debug.log")
+			opts := tt.opts
+			opts.Output = io.Discard
+			opts.Cwd = tmpDir
+			opts.Hostname = "testhost"
+			opts.Domains = []string{"github.com"}
+			opts.DebugWritesFile = path
+			linker := NewLinker(opts)
+			for _, w := range tt.writes {
+				if _, err := linker.Write([]byte(w)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := linker.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			cmd := exec.Command(goTool, "run", "./cmd/osc8wrap-replay", "--all", "--strict", path)
+			cmd.Stdout = io.Discard
+			var stderr bytes.Buffer
+			cmd.Stderr = &stderr
+			if err := cmd.Run(); err != nil {
+				data, _ := os.ReadFile(path)
+				t.Fatalf("osc8wrap-replay: %v\n%s\nlog:\n%s", err, stderr.String(), data)
+			}
+		})
+	}
+}
+
+func TestLinker_DebugWritesFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "session.log")
+	if err := os.WriteFile(path, []byte("left from an earlier run\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	linker := NewLinker(LinkerOptions{
 		Output:          &buf,
 		Cwd:             tmpDir,
-		Hostname:        hostname,
-		Scheme:          "file",
+		Hostname:        "testhost",
+		Scheme:          "vscode",
 		Domains:         []string{"github.com"},
-		ResolveBasename: true,
-		ExcludeDirs:     []string{},
+		DebugWritesFile: path,
 	})
+	assertWrite(t, linker, "hello\n", "hello\n")
+	if err := linker.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	go linker.StartIndexer(ctx)
-	if err := linker.WaitForIndex(ctx); err != nil {
+	data, err := os.ReadFile(path)
+	if err != nil {
 		t.Fatal(err)
 	}
+	log := string(data)
+	if !strings.HasPrefix(log, "# osc8wrap-debug v1\n=== Write #1 (6 bytes) ===\n") {
+		t.Errorf("log does not start with the header and write #1:\n%s", log)
+	}
+	if !strings.Contains(log, "Output: \"hello\\n\"\n") {
+		t.Errorf("log is missing the output of write #1:\n%s", log)
+	}
+	if strings.Contains(log, "earlier run") {
+		t.Errorf("log was not truncated:\n%s", log)
+	}
+}
+
+func TestLinker_PostProcess(t *testing.T) {
+	tmpDir := t.TempDir()
+	readme := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "README.MD"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+
+	upperText := func(tok ansitoken.Token) []byte {
+		if tok.Kind != ansitoken.TokenText {
+			return tok.Data
+		}
+		return bytes.ToUpper(tok.Data)
+	}
+	recolor := func(tok ansitoken.Token) []byte {
+		if tok.Kind == ansitoken.TokenSGR && string(tok.Data) == "\x1b[31m" {
+			return []byte("\x1b[35m")
+		}
+		return tok.Data
+	}
+
+	tests := []struct {
+		name        string
+		postProcess func(ansitoken.Token) []byte
+		symbolLinks bool
+		input       string
+		expected    string
+	}{
+		{
+			name:     "nil is a no-op",
+			input:    "see README.MD\n",
+			expected: "see \x1b]8;;file://testhost" + readme + "\x1b\\README.MD\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:        "uppercased text is still linked",
+			postProcess: upperText,
+			input:       "see readme.md\x1b[1m now\x1b[0m\n",
+			expected:    "SEE \x1b]8;;file://testhost" + readme + "\x1b\\README.MD\x1b]8;;\x1b\\\x1b[1m NOW\x1b[0m\n",
+		},
+		{
+			name:        "rewritten SGR keeps symbol linking",
+			postProcess: recolor,
+			symbolLinks: true,
+			input:       "\x1b[31mNewLinker\x1b[0m\n",
+			expected:    "\x1b[35m\x1b]8;;cursor://maaashjp.symbol-opener?symbol=NewLinker&cwd=" + tmpDir + "\x1b\\NewLinker\x1b]8;;\x1b\\\x1b[0m\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			scheme := "file"
+			if tt.symbolLinks {
+				scheme = "cursor"
+			}
+			linker := NewLinker(LinkerOptions{
+				Output:      &buf,
+				Cwd:         tmpDir,
+				Hostname:    "testhost",
+				Scheme:      scheme,
+				Domains:     []string{"github.com"},
+				SymbolLinks: tt.symbolLinks,
+				PostProcess: tt.postProcess,
+			})
 
-	assertWrite(t, linker,
-		"error in to/file.go:10\n",
-		"error in \x1b]8;;file://testhost"+testFile+"\x1b\\to/file.go:10\x1b]8;;\x1b\\\n")
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
 }
 
-func TestLinker_MtimePriority(t *testing.T) {
+func TestLinker_RelinkExisting(t *testing.T) {
 	tmpDir := t.TempDir()
-	hostname := "testhost"
-
-	dirA := filepath.Join(tmpDir, "a")
-	dirB := filepath.Join(tmpDir, "b")
-	if err := os.MkdirAll(dirA, 0755); err != nil {
-		t.Fatal(err)
-	}
-	if err := os.MkdirAll(dirB, 0755); err != nil {
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+	if err := os.MkdirAll(filepath.Join(tmpDir, "src"), 0o755); err != nil {
 		t.Fatal(err)
 	}
+	mainFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "src", "main.go"))
+	open := func(uri string) string { return "\x1b]8;;" + uri + "\x1b\\" }
+	closeLink := "\x1b]8;;\x1b\\"
 
-	oldFile := filepath.Join(dirA, "file.go")
-	newFile := filepath.Join(dirB, "file.go")
-	if err := os.WriteFile(oldFile, []byte("old"), 0644); err != nil {
-		t.Fatal(err)
-	}
-	oldTime := time.Now().Add(-1 * time.Hour)
-	if err := os.Chtimes(oldFile, oldTime, oldTime); err != nil {
-		t.Fatal(err)
-	}
-	if err := os.WriteFile(newFile, []byte("new"), 0644); err != nil {
-		t.Fatal(err)
+	tests := []struct {
+		name     string
+		relink   bool
+		input    string
+		expected string
+	}{
+		{
+			name:     "placeholder target is replaced",
+			relink:   true,
+			input:    open("about:blank") + "src/main.go:12" + closeLink + "\n",
+			expected: open("vscode://file"+mainFile+":12") + "src/main.go:12" + closeLink + "\n",
+		},
+		{
+			name:     "https target is replaced when text is a local file",
+			relink:   true,
+			input:    "see " + open("https://github.com/x/y/blob/main/src/main.go") + "src/main.go" + closeLink + "\n",
+			expected: "see " + open("vscode://file"+mainFile) + "src/main.go" + closeLink + "\n",
+		},
+		{
+			name:     "styling inside the link is kept",
+			relink:   true,
+			input:    open("about:blank") + "\x1b[1msrc/main.go\x1b[22m" + closeLink + "\n",
+			expected: open("vscode://file"+mainFile) + "\x1b[1msrc/main.go\x1b[22m" + closeLink + "\n",
+		},
+		{
+			name:     "BEL-terminated link",
+			relink:   true,
+			input:    "\x1b]8;id=1;about:blank\x07src/main.go\x1b]8;;\x07\n",
+			expected: open("vscode://file"+mainFile) + "src/main.go\x1b]8;;\x07\n",
+		},
+		{
+			name:     "file target is not relinked, only converted to the scheme",
+			relink:   true,
+			input:    open("file:///elsewhere/main.go") + "src/main.go" + closeLink + "\n",
+			expected: open("vscode://file/elsewhere/main.go") + "src/main.go" + closeLink + "\n",
+		},
+		{
+			name:     "text that is not a file is left alone",
+			relink:   true,
+			input:    open("https://example.com") + "click here" + closeLink + "\n",
+			expected: open("https://example.com") + "click here" + closeLink + "\n",
+		},
+		{
+			name:     "text with more than a path is left alone",
+			relink:   true,
+			input:    open("about:blank") + "see src/main.go" + closeLink + "\n",
+			expected: open("about:blank") + "see src/main.go" + closeLink + "\n",
+		},
+		{
+			name:     "unclosed link is written unchanged on flush",
+			relink:   true,
+			input:    open("about:blank") + "src/main.go",
+			expected: open("about:blank") + "src/main.go",
+		},
+		{
+			name:     "disabled",
+			relink:   false,
+			input:    open("about:blank") + "src/main.go:12" + closeLink + "\n",
+			expected: open("about:blank") + "src/main.go:12" + closeLink + "\n",
+		},
 	}
 
-	var buf bytes.Buffer
-	linker := NewLinker(LinkerOptions{
-		Output:          &buf,
-		Cwd:             tmpDir,
-		Hostname:        hostname,
-		Scheme:          "file",
-		Domains:         []string{"github.com"},
-		ResolveBasename: true,
-		ExcludeDirs:     []string{},
-	})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:         &buf,
+				Cwd:            tmpDir,
+				Hostname:       "testhost",
+				Scheme:         "vscode",
+				Domains:        []string{"github.com"},
+				RelinkExisting: tt.relink,
+			})
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	go linker.StartIndexer(ctx)
-	if err := linker.WaitForIndex(ctx); err != nil {
-		t.Fatal(err)
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
 	}
 
-	assertWrite(t, linker,
-		"error in file.go:10\n",
-		"error in \x1b]8;;file://testhost"+newFile+"\x1b\\file.go:10\x1b]8;;\x1b\\\n")
+	t.Run("link split across writes", func(t *testing.T) {
+		var buf bytes.Buffer
+		linker := NewLinker(LinkerOptions{
+			Output:         &buf,
+			Cwd:            tmpDir,
+			Hostname:       "testhost",
+			Scheme:         "vscode",
+			Domains:        []string{"github.com"},
+			RelinkExisting: true,
+		})
+		for _, chunk := range []string{open("about:blank") + "src/ma", "in.go" + closeLink + "\n"} {
+			if _, err := linker.Write([]byte(chunk)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want := open("vscode://file"+mainFile) + "src/main.go" + closeLink + "\n"
+		if got := buf.String(); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
 }
 
-func TestLinker_IndexNotReady(t *testing.T) {
+func TestLinker_StripLinks(t *testing.T) {
 	tmpDir := t.TempDir()
-	hostname := "testhost"
-
-	srcDir := filepath.Join(tmpDir, "src")
-	if err := os.MkdirAll(srcDir, 0755); err != nil {
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+	if err := os.MkdirAll(filepath.Join(tmpDir, "src"), 0o755); err != nil {
 		t.Fatal(err)
 	}
-	if err := os.WriteFile(filepath.Join(srcDir, "main.go"), []byte("package main"), 0644); err != nil {
-		t.Fatal(err)
+	mainFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "src", "main.go"))
+	link := func(loc, display string) string {
+		return "\x1b]8;;vscode://file" + mainFile + loc + "\x1b\\" + display + "\x1b]8;;\x1b\\"
 	}
+	open := func(uri string) string { return "\x1b]8;;" + uri + "\x1b\\" }
+	closeLink := "\x1b]8;;\x1b\\"
 
-	var buf bytes.Buffer
-	linker := NewLinker(LinkerOptions{
-		Output:          &buf,
-		Cwd:             tmpDir,
-		Hostname:        hostname,
-		Scheme:          "file",
-		Domains:         []string{"github.com"},
-		ResolveBasename: true,
-		ExcludeDirs:     []string{},
-	})
+	tests := []struct {
+		name     string
+		writes   []string
+		expected string
+	}{
+		{
+			name:     "link to a file path is replaced",
+			writes:   []string{open("https://broken.example/x") + "src/main.go:12" + closeLink + "\n"},
+			expected: link(":12", "src/main.go:12") + "\n",
+		},
+		{
+			name:     "link around other text is removed",
+			writes:   []string{"see " + open("https://example.com") + "the docs" + closeLink + " now\n"},
+			expected: "see the docs now\n",
+		},
+		{
+			name:     "text on both sides of the link is joined",
+			writes:   []string{open("about:blank") + "src/main.go" + closeLink + ":7 failed\n"},
+			expected: link(":7", "src/main.go:7") + " failed\n",
+		},
+		{
+			name:     "link with an id and BEL terminators",
+			writes:   []string{"\x1b]8;id=x1;about:blank\x07src/main.go\x1b]8;;\x07\n"},
+			expected: link("", "src/main.go") + "\n",
+		},
+		{
+			name:     "nested opener without a closer in between",
+			writes:   []string{open("https://a") + "one " + open("https://b") + "src/main.go" + closeLink + "\n"},
+			expected: "one " + link("", "src/main.go") + "\n",
+		},
+		{
+			name:     "styling inside the link is kept",
+			writes:   []string{open("about:blank") + "\x1b[1msrc/main.go\x1b[22m" + closeLink + "\n"},
+			expected: "\x1b[1m" + link("", "src/main.go") + "\x1b[22m\n",
+		},
+		{
+			name:     "sequences split across writes",
+			writes:   []string{"\x1b]8;;https://x", "\x1b\\src/main.go\x1b]8", ";;\x1b\\\n"},
+			expected: link("", "src/main.go") + "\n",
+		},
+		{
+			name:     "file link is stripped and relinked",
+			writes:   []string{open("file:///elsewhere/main.go") + "src/main.go" + closeLink + "\n"},
+			expected: link("", "src/main.go") + "\n",
+		},
+	}
 
-	assertWrite(t, linker, "error in main.go:10\n", "error in main.go:10\n")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:         &buf,
+				Cwd:            tmpDir,
+				Hostname:       "testhost",
+				Scheme:         "vscode",
+				Domains:        []string{"github.com"},
+				StripLinks:     true,
+				RelinkExisting: true, // StripLinks wins
+			})
+
+			for _, w := range tt.writes {
+				if _, err := linker.Write([]byte(w)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := buf.String(); got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
 }
 
-func TestLinker_ResolveBasenameDisabled(t *testing.T) {
+func TestLinker_StripSGR(t *testing.T) {
 	tmpDir := t.TempDir()
-	hostname := "testhost"
-
-	srcDir := filepath.Join(tmpDir, "src")
-	if err := os.MkdirAll(srcDir, 0755); err != nil {
-		t.Fatal(err)
+	testFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "main.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+	fileLink := func(loc, display string) string {
+		return "\x1b]8;;cursor://file" + testFile + loc + "\x1b\\" + display + "\x1b]8;;\x1b\\"
 	}
-	if err := os.WriteFile(filepath.Join(srcDir, "main.go"), []byte("package main"), 0644); err != nil {
-		t.Fatal(err)
+	sym := func(name string) string {
+		return "\x1b]8;;cursor://maaashjp.symbol-opener?symbol=" + name + "&cwd=" + tmpDir + "\x1b\\" + name + "\x1b]8;;\x1b\\"
 	}
 
-	var buf bytes.Buffer
-	linker := NewLinker(LinkerOptions{
-		Output:          &buf,
-		Cwd:             tmpDir,
-		Hostname:        hostname,
-		Scheme:          "file",
-		Domains:         []string{"github.com"},
-		ResolveBasename: false,
-		ExcludeDirs:     []string{},
-	})
-
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	go linker.StartIndexer(ctx)
-	if err := linker.WaitForIndex(ctx); err != nil {
-		t.Fatal(err)
+	tests := []struct {
+		name     string
+		writes   []string
+		expected string
+	}{
+		{
+			name:     "colors around a path are removed",
+			writes:   []string{"error: \x1b[36mmain.go:3\x1b[0m\n"},
+			expected: "error: " + fileLink(":3", "main.go:3") + "\n",
+		},
+		{
+			name:     "styled identifier is still symbol-linked",
+			writes:   []string{"call \x1b[31mNewLinker\x1b[0m here\n"},
+			expected: "call " + sym("NewLinker") + " here\n",
+		},
+		{
+			name:     "sequence split across writes",
+			writes:   []string{"\x1b[3", "1mNewLinker\x1b[", "0m\n"},
+			expected: sym("NewLinker") + "\n",
+		},
+		{
+			name:     "other escape sequences are kept",
+			writes:   []string{"\x1b[2K\x1b[32mok\x1b[0m\n"},
+			expected: "\x1b[2Kok\n",
+		},
 	}
 
-	assertWrite(t, linker, "error in main.go:10\n", "error in main.go:10\n")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:      &buf,
+				Cwd:         tmpDir,
+				Hostname:    "testhost",
+				Scheme:      "cursor",
+				Domains:     []string{"github.com"},
+				SymbolLinks: true,
+				StripSGR:    true,
+			})
+			for _, w := range tt.writes {
+				if _, err := linker.Write([]byte(w)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := linker.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.expected {
+				t.Errorf("got  %q\nwant %q", got, tt.expected)
+			}
+		})
+	}
 }
 
-func TestLinker_TildePath(t *testing.T) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
+func TestLinker_JoinStyledPaths(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tmpDir, "src"), 0o755); err != nil {
 		t.Fatal(err)
 	}
+	mainGo := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "src", "main.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
 
-	testDir := filepath.Join(homeDir, ".osc8wrap-test")
-	if err := os.MkdirAll(testDir, 0755); err != nil {
-		t.Fatal(err)
+	open := func(loc string) string {
+		return "\x1b]8;;cursor://file" + mainGo + loc + "\x1b\\"
 	}
-	defer os.RemoveAll(testDir) //nolint:errcheck
+	const closeLink = "\x1b]8;;\x1b\\"
+	sym := func(name string) string {
+		return "\x1b]8;;cursor://maaashjp.symbol-opener?symbol=" + name + "&cwd=" + tmpDir + "\x1b\\" + name + closeLink
+	}
+	// The id GroupFileLinks gives main.go in the first diff block.
+	firstBlockID := (&Linker{groupFileLinks: true, diffBlock: 1}).fileLinkID(mainGo)
 
-	testFile := filepath.Join(testDir, "test.go")
-	if err := os.WriteFile(testFile, []byte("package main"), 0644); err != nil {
-		t.Fatal(err)
+	tests := []struct {
+		name           string
+		enabled        bool
+		symbolLinks    bool
+		groupFileLinks bool
+		input          string
+		expected       string
+	}{
+		{
+			name:     "colored extension",
+			enabled:  true,
+			input:    "src/main\x1b[36m.go\x1b[0m:10\n",
+			expected: open(":10") + "src/main\x1b[36m.go\x1b[0m:10" + closeLink + "\n",
+		},
+		{
+			name:     "colored line number",
+			enabled:  true,
+			input:    "error at \x1b[1msrc/main.go\x1b[0m\x1b[33m:10\x1b[0m: boom\n",
+			expected: "error at \x1b[1m" + open(":10") + "src/main.go\x1b[0m\x1b[33m:10" + closeLink + "\x1b[0m: boom\n",
+		},
+		{
+			name:     "every segment colored",
+			enabled:  true,
+			input:    "\x1b[34msrc/\x1b[32mmain\x1b[36m.go\x1b[0m\n",
+			expected: "\x1b[34m" + open("") + "src/\x1b[32mmain\x1b[36m.go" + closeLink + "\x1b[0m\n",
+		},
+		{
+			name:     "split word that is no file",
+			enabled:  true,
+			input:    "src/gone\x1b[36m.go\x1b[0m\n",
+			expected: "src/gone\x1b[36m.go\x1b[0m\n",
+		},
+		{
+			name:     "separated by a space",
+			enabled:  true,
+			input:    "src/main.go\x1b[36m done\x1b[0m\n",
+			expected: open("") + "src/main.go" + closeLink + "\x1b[36m done\x1b[0m\n",
+		},
+		{
+			name:        "text after the path keeps its own style",
+			enabled:     true,
+			symbolLinks: true,
+			input:       "\x1b[31msrc/main\x1b[36m.go\x1b[0m:10 and \x1b[31mNewLinker\x1b[0m\n",
+			expected:    "\x1b[31m" + open(":10") + "src/main\x1b[36m.go\x1b[0m:10" + closeLink + " and \x1b[31m" + sym("NewLinker") + "\x1b[0m\n",
+		},
+		{
+			name:           "dropped trial run counts the diff block once",
+			enabled:        true,
+			groupFileLinks: true,
+			input:          "diff --git a/src/main.go b/src/gone\x1b[36m.go\x1b[0m\n",
+			expected: "diff --git \x1b]8;id=" + firstBlockID + ";cursor://file" + mainGo + "\x1b\\a/src/main.go" + closeLink +
+				" b/src/gone\x1b[36m.go\x1b[0m\n",
+		},
+		{
+			name:     "disabled",
+			input:    "src/main\x1b[36m.go\x1b[0m:10\n",
+			expected: "src/main\x1b[36m.go\x1b[0m:10\n",
+		},
 	}
 
-	hostname := "testhost"
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:          &buf,
+				Cwd:             tmpDir,
+				Hostname:        "testhost",
+				Scheme:          "cursor",
+				Domains:         []string{"github.com"},
+				SymbolLinks:     tt.symbolLinks,
+				GroupFileLinks:  tt.groupFileLinks,
+				JoinStyledPaths: tt.enabled,
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_RewriteFileLinks(t *testing.T) {
 	tmpDir := t.TempDir()
+	closeLink := "\x1b]8;;\x1b\\"
 
 	tests := []struct {
 		name     string
+		scheme   string
 		input    string
 		expected string
 	}{
 		{
-			name:     "tilde path basic",
-			input:    "error in ~/.osc8wrap-test/test.go\n",
-			expected: "error in \x1b]8;;file://testhost" + testFile + "\x1b\\~/.osc8wrap-test/test.go\x1b]8;;\x1b\\\n",
+			name:     "file link converted to editor scheme",
+			scheme:   "cursor",
+			input:    "\x1b]8;;file://testhost/src/main.go\x1b\\main.go" + closeLink + "\n",
+			expected: "\x1b]8;;cursor://file/src/main.go\x1b\\main.go" + closeLink + "\n",
+		},
+		{
+			name:     "empty host and percent-encoding",
+			scheme:   "vscode",
+			input:    "\x1b]8;;file:///my%20dir/a.go\x1b\\a.go" + closeLink + "\n",
+			expected: "\x1b]8;;vscode://file/my dir/a.go\x1b\\a.go" + closeLink + "\n",
+		},
+		{
+			name:     "params and BEL terminator kept",
+			scheme:   "vscode",
+			input:    "\x1b]8;id=7;file://localhost/a.go\x07a.go\x1b]8;;\x07\n",
+			expected: "\x1b]8;id=7;vscode://file/a.go\x07a.go\x1b]8;;\x07\n",
 		},
 		{
-			name:     "tilde path with line number",
-			input:    "error in ~/.osc8wrap-test/test.go:42\n",
-			expected: "error in \x1b]8;;file://testhost" + testFile + "\x1b\\~/.osc8wrap-test/test.go:42\x1b]8;;\x1b\\\n",
+			name:     "other host left alone",
+			scheme:   "vscode",
+			input:    "\x1b]8;;file://buildbox/a.go\x1b\\a.go" + closeLink + "\n",
+			expected: "\x1b]8;;file://buildbox/a.go\x1b\\a.go" + closeLink + "\n",
 		},
 		{
-			name:     "non-existent tilde path not linked",
-			input:    "error in ~/.osc8wrap-test/nonexistent.go:10\n",
-			expected: "error in ~/.osc8wrap-test/nonexistent.go:10\n",
+			name:     "non-file link left alone",
+			scheme:   "vscode",
+			input:    "\x1b]8;;https://example.com/a.go\x1b\\a.go" + closeLink + "\n",
+			expected: "\x1b]8;;https://example.com/a.go\x1b\\a.go" + closeLink + "\n",
+		},
+		{
+			name:     "file scheme keeps file links as they are",
+			scheme:   "file",
+			input:    "\x1b]8;;file://otherhost/a.go\x1b\\a.go" + closeLink + "\n",
+			expected: "\x1b]8;;file://otherhost/a.go\x1b\\a.go" + closeLink + "\n",
 		},
 	}
 
@@ -712,8 +4749,8 @@ func TestLinker_TildePath(t *testing.T) {
 			linker := NewLinker(LinkerOptions{
 				Output:   &buf,
 				Cwd:      tmpDir,
-				Hostname: hostname,
-				Scheme:   "file",
+				Hostname: "testhost",
+				Scheme:   tt.scheme,
 				Domains:  []string{"github.com"},
 			})
 
@@ -807,6 +4844,56 @@ func TestLinker_Terminator(t *testing.T) {
 	}
 }
 
+func TestLinker_TerminatorAuto(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+	testFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "test.go"))
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "new links use ST",
+			input:    "error in test.go:3\n",
+			expected: "error in \x1b]8;;vscode://file" + testFile + ":3\x1b\\test.go:3\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "relinked BEL link keeps BEL",
+			input:    "\x1b]8;;about:blank\x07test.go:3\x1b]8;;\x07\n",
+			expected: "\x1b]8;;vscode://file" + testFile + ":3\x07test.go:3\x1b]8;;\x07\n",
+		},
+		{
+			name:     "relinked ST link keeps ST",
+			input:    "\x1b]8;;about:blank\x1b\\test.go:3\x1b]8;;\x1b\\\n",
+			expected: "\x1b]8;;vscode://file" + testFile + ":3\x1b\\test.go:3\x1b]8;;\x1b\\\n",
+		},
+		{
+			name:     "rewritten file link keeps BEL",
+			input:    "\x1b]8;;file:///x/a.go\x07a.go\x1b]8;;\x07\n",
+			expected: "\x1b]8;;vscode://file/x/a.go\x07a.go\x1b]8;;\x07\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:         &buf,
+				Cwd:            tmpDir,
+				Hostname:       "testhost",
+				Scheme:         "vscode",
+				Domains:        []string{"github.com"},
+				Terminator:     "auto",
+				RelinkExisting: true,
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
 func TestLinker_SymbolLinks(t *testing.T) {
 	tmpDir := t.TempDir()
 	hostname := "testhost"
@@ -1042,6 +5129,280 @@ func TestLinker_SymbolLinks(t *testing.T) {
 			},
 		})
 	})
+
+	t.Run("color_reset_boundaries", func(t *testing.T) {
+		sym := func(name string) string {
+			return "\x1b]8;;cursor://maaashjp.symbol-opener?symbol=" + name + "&cwd=" + tmpDir + "\x1b\\" + name + "\x1b]8;;\x1b\\"
+		}
+		run(t, []testCase{
+			{
+				name:        "39 mid-word ends the link",
+				input:       "\x1b[31mFoo\x1b[39mBar\n",
+				symbolLinks: true,
+				expected:    "\x1b[31m" + sym("Foo") + "\x1b[39mBar\n",
+			},
+			{
+				name:        "39 after 256-color foreground ends the link",
+				input:       "\x1b[38;5;196mFoo\x1b[39mBar\n",
+				symbolLinks: true,
+				expected:    "\x1b[38;5;196m" + sym("Foo") + "\x1b[39mBar\n",
+			},
+			{
+				name:        "39 after colon-form 256-color foreground ends the link",
+				input:       "\x1b[38:5:196mFoo\x1b[39mBar\n",
+				symbolLinks: true,
+				expected:    "\x1b[38:5:196m" + sym("Foo") + "\x1b[39mBar\n",
+			},
+			{
+				name:        "39 after colon-form truecolor foreground ends the link",
+				input:       "\x1b[38:2::255:0:0mFoo\x1b[39mBar\n",
+				symbolLinks: true,
+				expected:    "\x1b[38:2::255:0:0m" + sym("Foo") + "\x1b[39mBar\n",
+			},
+			{
+				name:        "49 mid-word ends the link",
+				input:       "\x1b[41mFoo\x1b[49mBar\n",
+				symbolLinks: true,
+				expected:    "\x1b[41m" + sym("Foo") + "\x1b[49mBar\n",
+			},
+			{
+				name:        "49 after truecolor background ends the link",
+				input:       "\x1b[48;2;10;39;49mFoo\x1b[49mBar\n",
+				symbolLinks: true,
+				expected:    "\x1b[48;2;10;39;49m" + sym("Foo") + "\x1b[49mBar\n",
+			},
+			{
+				name:        "39 with bold still active splits the word",
+				input:       "\x1b[1;31mFoo\x1b[39mBar\x1b[0m\n",
+				symbolLinks: true,
+				expected:    "\x1b[1;31m" + sym("Foo") + "\x1b[39m" + sym("Bar") + "\x1b[0m\n",
+			},
+			{
+				name:        "4:0 underline reset ends the link",
+				input:       "\x1b[4:3mFoo\x1b[4:0mBar\n",
+				symbolLinks: true,
+				expected:    "\x1b[4:3m" + sym("Foo") + "\x1b[4:0mBar\n",
+			},
+		})
+	})
+
+	t.Run("unicode_identifiers", func(t *testing.T) {
+		sym := func(name string) string {
+			return "\x1b]8;;cursor://maaashjp.symbol-opener?symbol=" + name + "&cwd=" + tmpDir + "\x1b\\" + name + "\x1b]8;;\x1b\\"
+		}
+		qsym := func(display, symbol string) string {
+			return "\x1b]8;;cursor://maaashjp.symbol-opener?symbol=" + symbol + "&cwd=" + tmpDir + "\x1b\\" + display + "\x1b]8;;\x1b\\"
+		}
+		run(t, []testCase{
+			{
+				name:        "accented letter inside identifier",
+				input:       "undefined: \x1b[31mnaïveHandler\x1b[0m\n",
+				symbolLinks: true,
+				expected:    "undefined: \x1b[31m" + sym("naïveHandler") + "\x1b[0m\n",
+			},
+			{
+				name:        "accented letter at start",
+				input:       "\x1b[31mÉcoleID\x1b[0m\n",
+				symbolLinks: true,
+				expected:    "\x1b[31m" + sym("ÉcoleID") + "\x1b[0m\n",
+			},
+			{
+				name:        "CJK identifier",
+				input:       "\x1b[31m计算总和\x1b[0m\n",
+				symbolLinks: true,
+				expected:    "\x1b[31m" + sym("计算总和") + "\x1b[0m\n",
+			},
+			{
+				name:        "short CJK identifier counted in runes",
+				input:       "\x1b[31m变量\x1b[0m\n",
+				symbolLinks: true,
+				expected:    "\x1b[31m变量\x1b[0m\n",
+			},
+			{
+				name:        "function call with CJK name",
+				input:       "\x1b[31m処理する(x)\x1b[0m\n",
+				symbolLinks: true,
+				expected:    "\x1b[31m\x1b]8;;cursor://maaashjp.symbol-opener?symbol=処理する&cwd=" + tmpDir + "&kind=Function\x1b\\処理する\x1b]8;;\x1b\\(x)\x1b[0m\n",
+			},
+			{
+				name:        "qualified chain with unicode members",
+				input:       "\x1b[31mcafé.crème\x1b[0m\n",
+				symbolLinks: true,
+				expected:    "\x1b[31m" + qsym("café", "café") + "." + qsym("crème", "café.crème") + "\x1b[0m\n",
+			},
+			{
+				name:        "non-letter symbols still separate words",
+				input:       "\x1b[31mfoo→bar—baz\x1b[0m\n",
+				symbolLinks: true,
+				expected:    "\x1b[31m" + sym("foo") + "→" + sym("bar") + "—" + sym("baz") + "\x1b[0m\n",
+			},
+		})
+	})
+
+	t.Run("upstream_osc8", func(t *testing.T) {
+		sym := func(name string) string {
+			return "\x1b]8;;cursor://maaashjp.symbol-opener?symbol=" + name + "&cwd=" + tmpDir + "\x1b\\" + name + "\x1b]8;;\x1b\\"
+		}
+		run(t, []testCase{
+			{
+				name:        "symbol after upstream link is linked",
+				input:       "\x1b]8;;https://x\x1b\\click\x1b]8;;\x1b\\ \x1b[31mNewLinker\x1b[0m\n",
+				symbolLinks: true,
+				expected:    "\x1b]8;;https://x\x1b\\click\x1b]8;;\x1b\\ \x1b[31m" + sym("NewLinker") + "\x1b[0m\n",
+			},
+			{
+				name:        "styled text inside upstream link is untouched",
+				input:       "\x1b]8;;https://x\x1b\\\x1b[31mclick\x1b[0m\x1b]8;;\x1b\\ \x1b[31mNewLinker\x1b[0m\n",
+				symbolLinks: true,
+				expected:    "\x1b]8;;https://x\x1b\\\x1b[31mclick\x1b[0m\x1b]8;;\x1b\\ \x1b[31m" + sym("NewLinker") + "\x1b[0m\n",
+			},
+			{
+				name:        "style opened inside upstream link carries past its end",
+				input:       "\x1b]8;;https://x\x1b\\\x1b[31mclick\x1b]8;;\x1b\\ NewLinker\x1b[0m\n",
+				symbolLinks: true,
+				expected:    "\x1b]8;;https://x\x1b\\\x1b[31mclick\x1b]8;;\x1b\\ " + sym("NewLinker") + "\x1b[0m\n",
+			},
+			{
+				name:        "upstream BEL-terminated link",
+				input:       "\x1b]8;;https://x\aclick\x1b]8;;\a \x1b[31mNewLinker\x1b[0m\n",
+				symbolLinks: true,
+				expected:    "\x1b]8;;https://x\aclick\x1b]8;;\a \x1b[31m" + sym("NewLinker") + "\x1b[0m\n",
+			},
+		})
+	})
+}
+
+func TestLinker_DisableMatchers(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "main.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+	fileLink := func(loc, display string) string {
+		return "\x1b]8;;cursor://file" + testFile + loc + "\x1b\\" + display + "\x1b]8;;\x1b\\"
+	}
+	urlLink := func(url, display string) string {
+		return "\x1b]8;;" + url + "\x1b\\" + display + "\x1b]8;;\x1b\\"
+	}
+	sym := func(name string) string {
+		return "\x1b]8;;cursor://maaashjp.symbol-opener?symbol=" + name + "&cwd=" + tmpDir + "\x1b\\" + name + "\x1b]8;;\x1b\\"
+	}
+	input := "main.go:3 https://example.com/docs github.com/mash/osc8wrap \x1b[31mNewLinker\x1b[0m\n"
+
+	tests := []struct {
+		name     string
+		disable  uint8
+		input    string
+		expected string
+	}{
+		{
+			name:    "all enabled",
+			disable: 0,
+			input:   input,
+			expected: fileLink(":3", "main.go:3") + " " + urlLink("https://example.com/docs", "https://example.com/docs") + " " +
+				urlLink("https://github.com/mash/osc8wrap", "github.com/mash/osc8wrap") + " \x1b[31m" + sym("NewLinker") + "\x1b[0m\n",
+		},
+		{
+			name:     "only file",
+			disable:  allMatchers &^ matchFile,
+			input:    input,
+			expected: fileLink(":3", "main.go:3") + " https://example.com/docs github.com/mash/osc8wrap \x1b[31mNewLinker\x1b[0m\n",
+		},
+		{
+			name:    "file disabled",
+			disable: matchFile,
+			input:   input,
+			expected: "main.go:3 " + urlLink("https://example.com/docs", "https://example.com/docs") + " " +
+				urlLink("https://github.com/mash/osc8wrap", "github.com/mash/osc8wrap") + " \x1b[31m" + sym("NewLinker") + "\x1b[0m\n",
+		},
+		{
+			name:     "URL text is not symbol-linked when url is disabled",
+			disable:  matchURL,
+			input:    "\x1b[31mhttps://example.com/Handler\x1b[0m\n",
+			expected: "\x1b[31mhttps://example.com/Handler\x1b[0m\n",
+		},
+		{
+			name:     "hunk disabled",
+			disable:  matchHunk,
+			input:    "+++ b/main.go\n@@ -1 +1 @@\n",
+			expected: "+++ " + fileLink("", "b/main.go") + "\n@@ -1 +1 @@\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:          &buf,
+				Cwd:             tmpDir,
+				Hostname:        "testhost",
+				Scheme:          "cursor",
+				Domains:         []string{"github.com"},
+				SymbolLinks:     true,
+				DisableMatchers: tt.disable,
+			})
+
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestLinker_SymbolTrigger(t *testing.T) {
+	tmpDir := t.TempDir()
+	symbol := func(name string) string {
+		return "\x1b]8;;cursor://maaashjp.symbol-opener?symbol=" + name + "&cwd=" + tmpDir + "\x1b\\" + name + "\x1b]8;;\x1b\\"
+	}
+
+	tests := []struct {
+		name     string
+		trigger  uint16
+		input    string
+		expected string
+	}{
+		{
+			name:     "default links bold text",
+			input:    "\x1b[1mOverview\x1b[0m\n",
+			expected: "\x1b[1m" + symbol("Overview") + "\x1b[0m\n",
+		},
+		{
+			name:     "fg trigger skips bold-only text",
+			trigger:  ansitoken.TriggerFg,
+			input:    "\x1b[1mOverview\x1b[0m\n",
+			expected: "\x1b[1mOverview\x1b[0m\n",
+		},
+		{
+			name:     "fg trigger links colored text",
+			trigger:  ansitoken.TriggerFg,
+			input:    "\x1b[31mNewLinker\x1b[0m\n",
+			expected: "\x1b[31m" + symbol("NewLinker") + "\x1b[0m\n",
+		},
+		{
+			name:     "fg trigger links bold colored text",
+			trigger:  ansitoken.TriggerFg,
+			input:    "\x1b[1;31mNewLinker\x1b[0m\n",
+			expected: "\x1b[1;31m" + symbol("NewLinker") + "\x1b[0m\n",
+		},
+		{
+			name:     "fg trigger stops after foreground reset",
+			trigger:  ansitoken.TriggerFg,
+			input:    "\x1b[1;31mNewLinker\x1b[39m Overview\x1b[0m\n",
+			expected: "\x1b[1;31m" + symbol("NewLinker") + "\x1b[39m Overview\x1b[0m\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:        &buf,
+				Cwd:           tmpDir,
+				Hostname:      "testhost",
+				Scheme:        "cursor",
+				Domains:       []string{"github.com"},
+				SymbolLinks:   true,
+				SymbolTrigger: tt.trigger,
+			})
+			assertWrite(t, linker, tt.input, tt.expected)
+		})
+	}
 }
 
 func TestLinker_SymbolLinksSplitAcrossWrites(t *testing.T) {
@@ -1076,6 +5437,16 @@ func TestLinker_SymbolLinksSplitAcrossWrites(t *testing.T) {
 			writes:   []string{"\x1b[38;5;6;49mGREE", "N\x1b[39;49m\n"},
 			expected: "\x1b[38;5;6;49m" + symLink("GREEN") + "\x1b[39;49m\n",
 		},
+		{
+			name:     "styled word inside upstream link split across writes",
+			writes:   []string{"\x1b]8;;https://x\x1b\\\x1b[31mcli", "ck\x1b[0m\x1b]8;;\x1b\\ \x1b[31mNewLinker\x1b[0m\n"},
+			expected: "\x1b]8;;https://x\x1b\\\x1b[31mclick\x1b[0m\x1b]8;;\x1b\\ \x1b[31m" + symLink("NewLinker") + "\x1b[0m\n",
+		},
+		{
+			name:     "upstream link closing sequence split across writes",
+			writes:   []string{"\x1b]8;;https://x\x1b\\\x1b[31mclick\x1b]8;", ";\x1b\\ NewLinker\x1b[0m\n"},
+			expected: "\x1b]8;;https://x\x1b\\\x1b[31mclick\x1b]8;;\x1b\\ " + symLink("NewLinker") + "\x1b[0m\n",
+		},
 	}
 
 	for _, tt := range tests {
@@ -1185,3 +5556,149 @@ func TestLinker_SymbolLinksWithFilePaths(t *testing.T) {
 		testFile+":10: undefined: \x1b[31mNewLinker\x1b[0m\n",
 		"\x1b]8;;cursor://file"+testFile+":10\x1b\\"+testFile+":10\x1b]8;;\x1b\\: undefined: \x1b[31m\x1b]8;;cursor://maaashjp.symbol-opener?symbol=NewLinker&cwd="+tmpDir+"\x1b\\NewLinker\x1b]8;;\x1b\\\x1b[0m\n")
 }
+
+func TestMayContainLink(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{input: "just some prose without links", want: false},
+		{input: "key: value", want: false},
+		{input: "see github.com/mash/osc8wrap", want: true},
+		{input: "https://example.com", want: true},
+		{input: "main.go", want: true},
+		{input: "edit Makefile please", want: true},
+		{input: "/usr/bin", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := mayContainLink([]byte(tt.input)); got != tt.want {
+				t.Errorf("mayContainLink(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func BenchmarkLinker_ProcessPlainText(b *testing.B) {
+	line := []byte("Lorem ipsum dolor sit amet consectetur adipiscing elit sed do eiusmod tempor\n")
+	text := bytes.Repeat(line, (1024*1024)/len(line))
+
+	linker := NewLinker(LinkerOptions{
+		Output:   io.Discard,
+		Cwd:      b.TempDir(),
+		Hostname: "testhost",
+		Scheme:   "file",
+		Domains:  []string{"github.com"},
+	})
+
+	b.SetBytes(int64(len(text)))
+	b.ReportAllocs()
+	var buf bytes.Buffer
+	for b.Loop() {
+		buf.Reset()
+		linker.processTextWithState(&buf, text, false, false)
+	}
+}
+
+func BenchmarkLinker_WritePlainText(b *testing.B) {
+	line := []byte("the quick brown fox jumps over the lazy dog while compiling things\n")
+	chunk := bytes.Repeat(line, (32*1024)/len(line))
+
+	linker := NewLinker(LinkerOptions{
+		Output:   io.Discard,
+		Cwd:      b.TempDir(),
+		Hostname: "testhost",
+		Scheme:   "file",
+		Domains:  []string{"github.com"},
+	})
+
+	b.SetBytes(int64(len(chunk)))
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := linker.Write(chunk); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLinker_WriteStyledSymbols(b *testing.B) {
+	line := []byte("\x1b[31mpanic: runtime error in handleRequest calling vscode.window.showMessage(ctx)\x1b[0m\n")
+	chunk := bytes.Repeat(line, (32*1024)/len(line))
+
+	linker := NewLinker(LinkerOptions{
+		Output:      io.Discard,
+		Cwd:         b.TempDir(),
+		Hostname:    "testhost",
+		Scheme:      "cursor",
+		Domains:     []string{"github.com"},
+		SymbolLinks: true,
+	})
+
+	b.SetBytes(int64(len(chunk)))
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := linker.Write(chunk); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLinker_WritePaths(b *testing.B) {
+	tmpDir := b.TempDir()
+	for _, name := range []string{"main.go", "linker.go", "handler_test.go"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), nil, 0o644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	lines := []byte("./main.go:42:7: undefined: foo\n" +
+		"\tlinker.go:118 +0x1f\n" +
+		"--- FAIL: TestHandler (0.00s)\n" +
+		"    handler_test.go:31: got 1, want 2\n" +
+		"see https://github.com/mash/osc8wrap/issues/1 and missing.go:3\n")
+	chunk := bytes.Repeat(lines, (32*1024)/len(lines))
+
+	linker := NewLinker(LinkerOptions{
+		Output:   io.Discard,
+		Cwd:      tmpDir,
+		Hostname: "testhost",
+		Scheme:   "vscode",
+		Domains:  []string{"github.com"},
+	})
+
+	b.SetBytes(int64(len(chunk)))
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := linker.Write(chunk); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkLinker_WriteLongLine writes a 2MB line with no newline in it,
+// like minified JavaScript. With MaxLineLen it is passed through unscanned.
+func BenchmarkLinker_WriteLongLine(b *testing.B) {
+	word := []byte("function(a){return a.b/c.d}+")
+	line := bytes.Repeat(word, (2*1024*1024)/len(word))
+
+	for _, maxLineLen := range []int{0, 64 * 1024} {
+		b.Run("max="+strconv.Itoa(maxLineLen), func(b *testing.B) {
+			linker := NewLinker(LinkerOptions{
+				Output:     io.Discard,
+				Cwd:        b.TempDir(),
+				Hostname:   "testhost",
+				Scheme:     "vscode",
+				Domains:    []string{"github.com"},
+				MaxLineLen: maxLineLen,
+			})
+
+			b.SetBytes(int64(len(line)))
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := linker.Write(line); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
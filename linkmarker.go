@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// zeroWidthMarkers are the characters accepted as link markers. Each one
+// renders with no width in terminals, so emitting it next to a link leaves
+// the visible layout untouched while still letting screen readers and
+// downstream tools notice the link. Other invisible format characters (bidi
+// controls, soft hyphen) are rejected because they can change rendering.
+var zeroWidthMarkers = map[rune]bool{
+	'\u200b': true, // ZERO WIDTH SPACE
+	'\u200c': true, // ZERO WIDTH NON-JOINER
+	'\u200d': true, // ZERO WIDTH JOINER
+	'\u2060': true, // WORD JOINER
+	'\ufeff': true, // ZERO WIDTH NO-BREAK SPACE
+}
+
+// parseLinkMarker parses a --link-marker-char value, given either as the
+// character itself or in U+XXXX notation, and checks that it is zero-width.
+func parseLinkMarker(s string) (string, error) {
+	r, size := utf8.DecodeRuneInString(s)
+	if hex, ok := strings.CutPrefix(strings.ToUpper(s), "U+"); ok {
+		n, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil {
+			return "", fmt.Errorf("invalid code point %q", s)
+		}
+		r, size = rune(n), len(s)
+	}
+	if s == "" || size != len(s) || r == utf8.RuneError {
+		return "", fmt.Errorf("link marker must be a single character, got %q", s)
+	}
+	if !zeroWidthMarkers[r] {
+		return "", fmt.Errorf("link marker %U is not a zero-width character", r)
+	}
+	return string(r), nil
+}
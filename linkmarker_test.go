@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestParseLinkMarker(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "U+200B", want: "\u200b"},
+		{input: "u+2060", want: "\u2060"},
+		{input: "\u200d", want: "\u200d"},
+		{input: "U+FEFF", want: "\ufeff"},
+		{input: "", wantErr: true},
+		{input: "x", wantErr: true},
+		{input: "\u200b\u200b", wantErr: true},
+		{input: "U+00AD", wantErr: true}, // soft hyphen may render
+		{input: "U+202E", wantErr: true}, // bidi override reorders text
+		{input: "U+ZZZZ", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseLinkMarker(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseLinkMarker(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseLinkMarker(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinker_LinkMarker(t *testing.T) {
+	cwd := t.TempDir()
+	testFile := writeTestFileAndResolvePath(t, filepath.Join(cwd, "test.go"))
+
+	var buf bytes.Buffer
+	linker := NewLinker(LinkerOptions{
+		Output:     &buf,
+		Cwd:        cwd,
+		Hostname:   "testhost",
+		Scheme:     "file",
+		Domains:    []string{"github.com"},
+		LinkMarker: "\u200b",
+	})
+
+	input := "error in test.go:10, see https://example.com\n"
+	assertWrite(t, linker, input,
+		"error in \x1b]8;;file://testhost"+testFile+"\x1b\\test.go:10\x1b]8;;\x1b\\\u200b"+
+			", see \x1b]8;;https://example.com\x1b\\https://example.com\x1b]8;;\x1b\\\u200b\n")
+
+	// With escape sequences and zero-width markers removed, the visible
+	// text is exactly the input.
+	visible := regexp.MustCompile("\x1b\\]8;[^\x1b]*\x1b\\\\").ReplaceAllString(buf.String(), "")
+	for r := range zeroWidthMarkers {
+		visible = strings.ReplaceAll(visible, string(r), "")
+	}
+	if visible != input {
+		t.Errorf("visible text = %q, want %q", visible, input)
+	}
+}
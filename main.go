@@ -1,32 +1,63 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
+	"time"
+	"unicode"
 
 	"github.com/creack/pty"
+	"github.com/mash/osc8wrap/buildinfo"
+	"github.com/mash/osc8wrap/termreset"
 	"golang.org/x/term"
 )
 
+// version and commit are set by release builds (goreleaser passes
+// -X main.version=... -X main.commit=...); see buildinfo.String.
+var version, commit string
+
 var defaultExcludeDirs = []string{"vendor", "node_modules", ".git", "__pycache__", ".cache"}
 
+const defaultIdleFlush = 50 * time.Millisecond
+
+// defaultMaxLineLen matches how much of a line LineBuffered mode holds
+// (maxHeldLine): longer lines are data, not messages with paths in them.
+const defaultMaxLineLen = 64 * 1024
+
 const usage = `Usage: osc8wrap [options] <command> [args...]
        <other command> | osc8wrap [options]
+       osc8wrap [options] --cat <file>...
 
 Options:
   --scheme=NAME           URL scheme for file links (default: file)
                           Can also be set via OSC8WRAP_SCHEME env var
                           Examples: file, vscode, cursor, zed
+  --editor=NAME           Pick the scheme and URL format for an editor: vscode,
+                          cursor, zed, idea, sublime, textmate, emacs, nvim or
+                          helix (overrides an earlier --scheme)
+                          Can also be set via OSC8WRAP_EDITOR
+  --file-host=NAME        Host name in file:// URLs; empty for file:///path
+                          (default: $OSC8WRAP_HOSTNAME, else this machine's
+                          host name, else $HOSTNAME, else empty)
+                          Can also be set via OSC8WRAP_FILE_HOST
   --terminator=TYPE       OSC8 string terminator (default: st)
                           Can also be set via OSC8WRAP_TERMINATOR env var
                           st: ESC \ (ECMA-48 standard)
                           bel: BEL 0x07 (legacy xterm)
+                          auto: st, but rewritten links keep the terminator
+                          the command used
   --domains=LIST          Comma-separated domains to linkify without https://
                           (default: github.com, env: OSC8WRAP_DOMAINS)
   --no-resolve-basename   Disable basename resolution (default: enabled)
@@ -34,9 +65,185 @@ Options:
   --exclude-dir=DIR,...   Directories to exclude from search (replaces defaults)
                           Default: vendor,node_modules,.git,__pycache__,.cache
                           Can also be set via OSC8WRAP_EXCLUDE_DIRS
-  --no-symbol-links       Disable symbol linking (default: enabled when scheme != file)
+  --no-symbol-links       Disable symbol linking (default: enabled for schemes of
+                          editors that run symbol-opener: vscode, cursor, ...)
                           Can also be set via OSC8WRAP_NO_SYMBOL_LINKS=1
+  --force-symbol-links    Enable symbol linking for any scheme other than file
+                          Can also be set via OSC8WRAP_FORCE_SYMBOL_LINKS=1
+  --enable=LIST           Run only these matchers, comma-separated: file, url,
+                          domain, symbol, hunk (diff hunk headers)
+                          Can also be set via OSC8WRAP_ENABLE
+  --disable=LIST          Turn these matchers off, e.g. --disable=domain,symbol
+                          Can also be set via OSC8WRAP_DISABLE
+  --link-absolute-under-home
+                          Display absolute paths under the home directory as ~/...
+                          (link targets stay absolute)
+                          Can also be set via OSC8WRAP_LINK_ABSOLUTE_UNDER_HOME=1
+  --no-link-cr-lines      Do not link lines redrawn with a bare carriage return
+                          (progress bars from npm, pip, docker, ...)
+                          Can also be set via OSC8WRAP_NO_LINK_CR_LINES=1
+  --link-test-names       Link test names in "go test -v" result lines
+                          (--- FAIL: TestFoo) to their func declaration;
+                          requires basename resolution
+                          Can also be set via OSC8WRAP_LINK_TEST_NAMES=1
+  --line-buffered         Hold back a partial line until its newline arrives so
+                          paths split across output chunks are still linked
+                          Can also be set via OSC8WRAP_LINE_BUFFERED=1
+  --idle-flush=DURATION   With --line-buffered, emit a held partial line after
+                          this much idle time (default: 50ms, 0 disables)
+                          Can also be set via OSC8WRAP_IDLE_FLUSH
+  --extract-dir=DIR       Also resolve relative paths against DIR, e.g. the
+                          target of "tar xvf -C DIR" or "unzip -d DIR"
+                          Can also be set via OSC8WRAP_EXTRACT_DIR
+  --path-root=DIR         Resolve relative paths under DIR (repeatable); roots are
+                          tried in the order given and the first one holding
+                          the path wins (default: the cwd, then the git work
+                          tree root, then the Go module root)
+                          Can also be set via OSC8WRAP_PATH_ROOTS (comma-separated)
+  --detect-terminal       Skip linking when $TERM/$TERM_PROGRAM suggest the
+                          terminal can't render OSC 8 (default when stdout is a TTY)
+  --force-links           Always link, even if the terminal looks unsupported
+                          Can also be set via OSC8WRAP_FORCE_LINKS=1
+  --probe-terminal        Before guessing from the environment, ask the terminal
+                          which program it is (XTVERSION) and link if it is one
+                          known to render OSC 8. Waits up to 200ms at startup
+                          Can also be set via OSC8WRAP_PROBE_TERMINAL=1
+  --link-line             Extend the link of a file:line that starts a line over
+                          the rest of that line (compiler and grep output)
+                          Can also be set via OSC8WRAP_LINK_LINE=1
+  --no-watch-dir=GLOB     Index directories matching GLOB at startup but don't
+                          watch them for changes (repeatable); saves inotify
+                          watches on large trees. A GLOB with a slash matches
+                          the path relative to the cwd, otherwise the basename
+                          Can also be set via OSC8WRAP_NO_WATCH_DIRS (comma-separated)
+  --link-marker-char=CHAR
+                          Emit a zero-width character after each link so screen
+                          readers and downstream tools can detect links without
+                          changing the layout. CHAR is the character or U+XXXX;
+                          one of U+200B, U+200C, U+200D, U+2060, U+FEFF
+                          Can also be set via OSC8WRAP_LINK_MARKER_CHAR
+  --line-separators=CHARS
+                          Also accept these characters before a line number,
+                          e.g. "@" for src/main.go@42 (":" is always accepted;
+                          @v1.2.3 style versions stay part of the path)
+                          Can also be set via OSC8WRAP_LINE_SEPARATORS
+  --symbol-trigger=LIST   Styles that enable symbol linking, comma-separated:
+                          fg,bg,bold,faint,italic,underline,blink,inverse,
+                          conceal,strikethrough (default: any)
+                          Can also be set via OSC8WRAP_SYMBOL_TRIGGER
+  --index-concurrency=N   Stat files with N parallel workers while building the
+                          file index; helps on network filesystems (default: 1)
+                          Can also be set via OSC8WRAP_INDEX_CONCURRENCY
+  --relink-existing       Point OSC 8 links that the command already emits at the
+                          local file when their text is a file path (links to
+                          file:// targets are left alone)
+                          Can also be set via OSC8WRAP_RELINK_EXISTING=1
+  --strip-existing-links  Remove OSC 8 links that the command already emits and
+                          link their text as if it were plain output
+                          Can also be set via OSC8WRAP_STRIP_EXISTING_LINKS=1
+  --strip-sgr             Remove colors and other text styles from the output,
+                          keeping the links; symbol links still follow the
+                          styles the command printed
+                          Can also be set via OSC8WRAP_STRIP_SGR=1
+  --join-styled-paths     Link paths that color changes split, such as a
+                          highlighter's "src/main\x1b[36m.go\x1b[0m:10", keeping
+                          the colors inside the link
+                          Can also be set via OSC8WRAP_JOIN_STYLED_PATHS=1
+  --line-timeout=DURATION
+                          Write a line unlinked when linking it takes longer
+                          than this (default: 0, disabled)
+                          Can also be set via OSC8WRAP_LINE_TIMEOUT
+  --asset-scheme=NAME     URL scheme for image, font and media files, e.g. one
+                          whose handler previews images (default: --scheme)
+                          Can also be set via OSC8WRAP_ASSET_SCHEME
+  --remote-map=MAP        Link files in a form a local editor opens over SSH:
+                          vscode, cursor, or a template such as
+                          'myeditor://ssh/{host}{path}{loc}'
+                          Can also be set via OSC8WRAP_REMOTE_MAP
+  --link-go-mod           Link module paths and versions in go.mod and "go get"
+                          output to pkg.go.dev
+                          Can also be set via OSC8WRAP_LINK_GO_MOD=1
+  --link-go-pkg-errors    Link the path in Go errors such as "open PATH:
+                          permission denied", even with spaces or no extension
+                          Can also be set via OSC8WRAP_LINK_GO_PKG_ERRORS=1
+  --link-go-race          Link every stack frame in race detector reports and
+                          panics, also frames whose path is from another machine
+                          or a -trimpath build, by the path's longest tail that
+                          exists under the current directory
+                          Can also be set via OSC8WRAP_LINK_GO_RACE=1
+  --json-paths            Link paths in JSON strings whose slashes or backslashes
+                          are escaped ("C:\\src\\main.go", "\/src\/main.go").
+                          Windows paths are looked up under the current directory
+                          Can also be set via OSC8WRAP_JSON_PATHS=1
+  --link-head=N           Link only the first N lines of output and pass the rest
+                          through unprocessed (default: 0, link everything)
+                          Can also be set via OSC8WRAP_LINK_HEAD
+  --max-links-total=N     Stop linking for good after N links, passing the rest
+                          of the output through unprocessed (default: 0, no limit)
+                          Can also be set via OSC8WRAP_MAX_LINKS_TOTAL
+  --max-line-len=N        Pass the rest of a line through unprocessed once it is
+                          longer than N bytes, such as minified code on one
+                          line (default: 65536)
+                          Can also be set via OSC8WRAP_MAX_LINE_LEN
+  --link-ext=LIST         Link only files with these extensions, comma-separated,
+                          e.g. go,py,rs (files without one are still linked)
+                          Can also be set via OSC8WRAP_LINK_EXT
+  --no-link-ext=LIST      Never link files with these extensions, e.g. log,tmp;
+                          takes precedence over --link-ext
+                          Can also be set via OSC8WRAP_NO_LINK_EXT
+  --require-location[=MODE]
+                          Link a path only when :line or :line:col follows it.
+                          MODE all (default) applies to every path; bare exempts
+                          paths starting with /, ~/, ./ or ../
+                          Can also be set via OSC8WRAP_REQUIRE_LOCATION=MODE
+  --bat-header            Link the file named in bat's "File: name" header,
+                          even with spaces or no extension
+                          Can also be set via OSC8WRAP_BAT_HEADER=1
+  --resolver-cmd=CMD      Ask CMD (run with sh -c) for paths that cannot be
+                          resolved otherwise: it gets the path on stdin and
+                          prints the absolute path, or nothing
+                          Can also be set via OSC8WRAP_RESOLVER_CMD
+  --link-lines=LIST       Open these files at a given line when no line is
+                          printed, e.g. CHANGELOG.md:1,docs/spec.txt:120
+                          Can also be set via OSC8WRAP_LINK_LINES
+  --group-links-by-file   Give all links to one file the same OSC 8 id, so
+                          terminals highlight them together; ids start over
+                          at each "diff --git" line
+                          Can also be set via OSC8WRAP_GROUP_LINKS_BY_FILE=1
+  --tee=PATH              Also write the output as received, without the
+                          links osc8wrap adds, to PATH (truncated first)
+                          Can also be set via OSC8WRAP_TEE
+  --manifest=PATH         At exit, write every link made to PATH as JSON:
+                          target, display text, kind and output offset
+                          Can also be set via OSC8WRAP_MANIFEST
+  --separate-stderr       Give the command a pipe for stderr instead of the
+                          terminal, and link it to osc8wrap's stderr; programs
+                          that draw full-screen on stderr no longer can
+                          Can also be set via OSC8WRAP_SEPARATE_STDERR=1
+  --no-pty                Run the command with its output piped into osc8wrap
+                          instead of on a pty, so it sees no terminal and
+                          prints as it would into a pipe; stderr is linked
+                          to osc8wrap's stderr
+                          Can also be set via OSC8WRAP_NO_PTY=1
+  --size=COLSxROWS        Window size for the command when stdin is not a
+                          terminal, e.g. 120x40 (default: $COLUMNS and $LINES if
+                          set, else none, which most programs take as 80x24)
+                          Can also be set via OSC8WRAP_SIZE
+  --config=PATH           Read options from a config file (default:
+                          ~/.config/osc8wrap/config.toml, if it exists)
+                          Can also be set via OSC8WRAP_CONFIG
+  --cat                   Link the files given instead of a command, like cat,
+                          resolving relative paths in each from its directory
+  --version               Print the version, commit and Go version, then exit
+  --print-config          Print the configuration resolved from flags and
+                          environment variables, then exit
   --debug-writes          Log each Write call to a temp file (path printed to stderr)
+  --debug-writes-file=PATH
+                          Like --debug-writes, but log to PATH, truncating it
+                          Can also be set via OSC8WRAP_DEBUG_WRITES_FILE
+  --debug-watch           Log file watcher events, watches that cannot be added
+                          and index changes to stderr (or the --debug-writes log)
+                          Can also be set via OSC8WRAP_DEBUG_WATCH=1
 
 Examples:
   osc8wrap go build ./...
@@ -49,16 +256,62 @@ func main() {
 }
 
 func run() int {
+	defer restoreOnPanic()
+
 	opts, cmdArgs := parseArgs(os.Args[1:])
 
-	hostname, _ := os.Hostname()
 	cwd, _ := os.Getwd()
 
 	opts.Output = os.Stdout
 	opts.Cwd = cwd
-	opts.Hostname = hostname
+
+	if opts.Cat {
+		if len(cmdArgs) == 0 {
+			fmt.Fprint(os.Stderr, usage)
+			return 1
+		}
+		if err := runCatMode(opts, cmdArgs); err != nil {
+			fmt.Fprintf(os.Stderr, "osc8wrap: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	// Probe before NewLinker decides on passthrough, and before the wrapped
+	// program starts reading stdin.
+	var typeahead []byte
+	if opts.ProbeTerminal && opts.DetectTerminal && len(cmdArgs) > 0 && term.IsTerminal(int(os.Stdin.Fd())) {
+		var supported bool
+		supported, typeahead = probeTerminal(os.Stdin, os.Stdout, probeTimeout)
+		if supported {
+			opts.DetectTerminal = false
+		}
+	}
 
 	linker := NewLinker(opts)
+	if opts.Tee != "" {
+		f, err := os.Create(opts.Tee)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "osc8wrap: --tee: %v\n", err)
+			return 1
+		}
+		defer f.Close() //nolint:errcheck
+		linker.SetTee(f)
+	}
+	if opts.Manifest != "" {
+		f, err := os.Create(opts.Manifest)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "osc8wrap: --manifest: %v\n", err)
+			return 1
+		}
+		defer f.Close() //nolint:errcheck
+		linker.SetManifest(f)
+	}
+	defer func() {
+		if err := linker.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "osc8wrap: %v\n", err)
+		}
+	}()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -69,13 +322,32 @@ func run() int {
 			fmt.Fprint(os.Stderr, usage)
 			return 1
 		}
+		exitOnSIGTERM(linker)
 		if err := runPipeMode(linker); err != nil {
 			fmt.Fprintf(os.Stderr, "osc8wrap: %v\n", err)
 			return 1
 		}
 		return 0
 	}
-	exitCode, err := runPTYMode(linker, cmdArgs)
+	var errLinker *Linker
+	if opts.SeparateStderr || opts.NoPTY {
+		errOpts := opts
+		errOpts.Output = os.Stderr
+		if !opts.NoPTY && term.IsTerminal(int(os.Stderr.Fd())) {
+			errOpts.Output = &crlfWriter{w: os.Stderr}
+		}
+		errOpts.DebugWrites, errOpts.DebugWritesFile, errOpts.DebugWatch = false, "", false
+		errLinker = NewLinker(errOpts)
+		errLinker.ShareIndex(linker)
+		defer errLinker.Close() //nolint:errcheck
+	}
+	var exitCode int
+	var err error
+	if opts.NoPTY {
+		exitCode, err = runNoPTYMode(linker, errLinker, cmdArgs)
+	} else {
+		exitCode, err = runPTYMode(linker, errLinker, cmdArgs, typeahead, fallbackSize(opts.Size, os.Getenv))
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "osc8wrap: %v\n", err)
 	}
@@ -83,22 +355,211 @@ func run() int {
 }
 
 func parseArgs(args []string) (opts LinkerOptions, cmdArgs []string) {
-	opts.Scheme = os.Getenv("OSC8WRAP_SCHEME")
-	opts.Terminator = os.Getenv("OSC8WRAP_TERMINATOR")
+	// --version works whatever the config file and environment hold.
+	if versionFlag(args) {
+		fmt.Println(buildinfo.String("osc8wrap", version, commit))
+		os.Exit(0)
+	}
+	opts.Hostname = defaultFileHost(os.Hostname, os.Environ())
 	opts.Domains = []string{"github.com"}
+	opts.ResolveBasename = true
+	opts.ExcludeDirs = defaultExcludeDirs
+	opts.IdleFlush = defaultIdleFlush
+	opts.MaxLineLen = defaultMaxLineLen
+	opts.DetectTerminal = term.IsTerminal(int(os.Stdout.Fd()))
+	noSymbolLinks := false
+	forceSymbolLinks := false
+	printConfig := false
+
+	// Precedence is flags > env > config file, so the config file is read
+	// first, from --config, OSC8WRAP_CONFIG or the default location.
+	configPath, explicitConfig := configFlag(args), true
+	if configPath == "" {
+		configPath = os.Getenv("OSC8WRAP_CONFIG")
+	}
+	if configPath == "" {
+		configPath, explicitConfig = defaultConfigPath(), false
+	}
+	if configPath != "" {
+		set, err := loadConfigFile(configPath, &opts)
+		if err != nil && (explicitConfig || !errors.Is(err, fs.ErrNotExist)) {
+			fmt.Fprintf(os.Stderr, "invalid config: %v\n", err)
+			os.Exit(1)
+		}
+		if set["symbol_links"] {
+			noSymbolLinks, forceSymbolLinks = !opts.SymbolLinks, opts.SymbolLinks
+		}
+	}
+
+	if env := os.Getenv("OSC8WRAP_SCHEME"); env != "" {
+		opts.Scheme = env
+	}
+	if env, ok := os.LookupEnv("OSC8WRAP_FILE_HOST"); ok {
+		opts.Hostname = env // may be empty: file:///path
+	}
+	editor := os.Getenv("OSC8WRAP_EDITOR")
+	if env := os.Getenv("OSC8WRAP_TERMINATOR"); env != "" {
+		opts.Terminator = env
+	}
 	if env := os.Getenv("OSC8WRAP_DOMAINS"); env != "" {
 		opts.Domains = splitComma(env)
 	}
-	opts.ResolveBasename = os.Getenv("OSC8WRAP_NO_RESOLVE_BASENAME") != "1"
-	opts.ExcludeDirs = defaultExcludeDirs
+	if os.Getenv("OSC8WRAP_NO_RESOLVE_BASENAME") == "1" {
+		opts.ResolveBasename = false
+	}
 	if env := os.Getenv("OSC8WRAP_EXCLUDE_DIRS"); env != "" {
 		opts.ExcludeDirs = splitComma(env)
 	}
-	noSymbolLinks := os.Getenv("OSC8WRAP_NO_SYMBOL_LINKS") == "1"
+	if env := os.Getenv("OSC8WRAP_ENABLE"); env != "" {
+		opts.DisableMatchers = allMatchers &^ mustParseMatchers("OSC8WRAP_ENABLE", env)
+	}
+	if env := os.Getenv("OSC8WRAP_DISABLE"); env != "" {
+		opts.DisableMatchers |= mustParseMatchers("OSC8WRAP_DISABLE", env)
+	}
+	if os.Getenv("OSC8WRAP_FORCE_SYMBOL_LINKS") == "1" {
+		noSymbolLinks, forceSymbolLinks = false, true
+	}
+	if os.Getenv("OSC8WRAP_NO_SYMBOL_LINKS") == "1" {
+		noSymbolLinks = true
+	}
+	if os.Getenv("OSC8WRAP_LINK_ABSOLUTE_UNDER_HOME") == "1" {
+		opts.ShortenHome = true
+	}
+	if os.Getenv("OSC8WRAP_NO_LINK_CR_LINES") == "1" {
+		opts.NoLinkCRLines = true
+	}
+	if os.Getenv("OSC8WRAP_LINK_TEST_NAMES") == "1" {
+		opts.LinkTestNames = true
+	}
+	if os.Getenv("OSC8WRAP_LINE_BUFFERED") == "1" {
+		opts.LineBuffered = true
+	}
+	if env := os.Getenv("OSC8WRAP_IDLE_FLUSH"); env != "" {
+		opts.IdleFlush = parseDuration("OSC8WRAP_IDLE_FLUSH", env)
+	}
+	if env := os.Getenv("OSC8WRAP_EXTRACT_DIR"); env != "" {
+		opts.ExtractDir = env
+	}
+	if env := os.Getenv("OSC8WRAP_PATH_ROOTS"); env != "" {
+		opts.PathRoots = splitComma(env)
+	}
+	var pathRoots []string // --path-root values; replace the env list when given
+	forceLinks := os.Getenv("OSC8WRAP_FORCE_LINKS") == "1"
+	if os.Getenv("OSC8WRAP_PROBE_TERMINAL") == "1" {
+		opts.ProbeTerminal = true
+	}
+	if os.Getenv("OSC8WRAP_LINK_LINE") == "1" {
+		opts.LinkLine = true
+	}
+	if env := os.Getenv("OSC8WRAP_NO_WATCH_DIRS"); env != "" {
+		opts.NoWatchDirs = splitComma(env)
+	}
+	var noWatchDirs []string // --no-watch-dir values; replace the env list when given
+	if env := os.Getenv("OSC8WRAP_LINK_MARKER_CHAR"); env != "" {
+		opts.LinkMarker = mustParseLinkMarker("OSC8WRAP_LINK_MARKER_CHAR", env)
+	}
+	if env := os.Getenv("OSC8WRAP_LINE_SEPARATORS"); env != "" {
+		opts.LineSeparators = env
+	}
+	if env := os.Getenv("OSC8WRAP_SYMBOL_TRIGGER"); env != "" {
+		opts.SymbolTrigger = mustParseStyleTrigger("OSC8WRAP_SYMBOL_TRIGGER", env)
+	}
+	if env := os.Getenv("OSC8WRAP_INDEX_CONCURRENCY"); env != "" {
+		opts.IndexWorkers = parsePositiveInt("OSC8WRAP_INDEX_CONCURRENCY", env)
+	}
+	if os.Getenv("OSC8WRAP_RELINK_EXISTING") == "1" {
+		opts.RelinkExisting = true
+	}
+	if os.Getenv("OSC8WRAP_STRIP_EXISTING_LINKS") == "1" {
+		opts.StripLinks = true
+	}
+	if os.Getenv("OSC8WRAP_STRIP_SGR") == "1" {
+		opts.StripSGR = true
+	}
+	if os.Getenv("OSC8WRAP_JOIN_STYLED_PATHS") == "1" {
+		opts.JoinStyledPaths = true
+	}
+	if env := os.Getenv("OSC8WRAP_LINE_TIMEOUT"); env != "" {
+		opts.LineTimeout = parseDuration("OSC8WRAP_LINE_TIMEOUT", env)
+	}
+	if env := os.Getenv("OSC8WRAP_ASSET_SCHEME"); env != "" {
+		opts.AssetScheme = env
+	}
+	if env := os.Getenv("OSC8WRAP_REMOTE_MAP"); env != "" {
+		opts.RemoteMap = mustParseRemoteMap("OSC8WRAP_REMOTE_MAP", env)
+	}
+	if os.Getenv("OSC8WRAP_LINK_GO_MOD") == "1" {
+		opts.LinkGoMod = true
+	}
+	if env := os.Getenv("OSC8WRAP_LINK_HEAD"); env != "" {
+		opts.LinkHead = parsePositiveInt("OSC8WRAP_LINK_HEAD", env)
+	}
+	if env := os.Getenv("OSC8WRAP_MAX_LINKS_TOTAL"); env != "" {
+		opts.MaxLinksTotal = parsePositiveInt("OSC8WRAP_MAX_LINKS_TOTAL", env)
+	}
+	if env := os.Getenv("OSC8WRAP_MAX_LINE_LEN"); env != "" {
+		opts.MaxLineLen = parsePositiveInt("OSC8WRAP_MAX_LINE_LEN", env)
+	}
+	if env := os.Getenv("OSC8WRAP_LINK_EXT"); env != "" {
+		opts.LinkExt = splitComma(env)
+	}
+	if env := os.Getenv("OSC8WRAP_NO_LINK_EXT"); env != "" {
+		opts.NoLinkExt = splitComma(env)
+	}
+	if env := os.Getenv("OSC8WRAP_REQUIRE_LOCATION"); env != "" {
+		opts.RequireLocation = mustParseRequireLocation("OSC8WRAP_REQUIRE_LOCATION", env)
+	}
+	if os.Getenv("OSC8WRAP_BAT_HEADER") == "1" {
+		opts.BatHeader = true
+	}
+	if os.Getenv("OSC8WRAP_LINK_GO_PKG_ERRORS") == "1" {
+		opts.LinkGoPkgErrors = true
+	}
+	if os.Getenv("OSC8WRAP_LINK_GO_RACE") == "1" {
+		opts.LinkGoRace = true
+	}
+	if os.Getenv("OSC8WRAP_JSON_PATHS") == "1" {
+		opts.JSONPaths = true
+	}
+	if env := os.Getenv("OSC8WRAP_DEBUG_WRITES_FILE"); env != "" {
+		opts.DebugWritesFile = env
+	}
+	if os.Getenv("OSC8WRAP_DEBUG_WATCH") == "1" {
+		opts.DebugWatch = true
+	}
+	if env := os.Getenv("OSC8WRAP_RESOLVER_CMD"); env != "" {
+		opts.ResolverCmd = env
+	}
+	if env := os.Getenv("OSC8WRAP_LINK_LINES"); env != "" {
+		opts.LinkLines = mustParseLinkLines("OSC8WRAP_LINK_LINES", env)
+	}
+	if os.Getenv("OSC8WRAP_GROUP_LINKS_BY_FILE") == "1" {
+		opts.GroupFileLinks = true
+	}
+	if env := os.Getenv("OSC8WRAP_TEE"); env != "" {
+		opts.Tee = env
+	}
+	if env := os.Getenv("OSC8WRAP_MANIFEST"); env != "" {
+		opts.Manifest = env
+	}
+	if os.Getenv("OSC8WRAP_SEPARATE_STDERR") == "1" {
+		opts.SeparateStderr = true
+	}
+	if os.Getenv("OSC8WRAP_NO_PTY") == "1" {
+		opts.NoPTY = true
+	}
+	if env := os.Getenv("OSC8WRAP_SIZE"); env != "" {
+		opts.Size = mustParseSize("OSC8WRAP_SIZE", env)
+	}
 
 	for i, arg := range args {
 		if v, ok := strings.CutPrefix(arg, "--scheme="); ok {
 			opts.Scheme = v
+			editor = ""
+		} else if v, ok := strings.CutPrefix(arg, "--file-host="); ok {
+			opts.Hostname = v
+		} else if v, ok := strings.CutPrefix(arg, "--editor="); ok {
+			editor = v
 		} else if v, ok := strings.CutPrefix(arg, "--terminator="); ok {
 			opts.Terminator = v
 		} else if v, ok := strings.CutPrefix(arg, "--domains="); ok {
@@ -108,9 +569,113 @@ func parseArgs(args []string) (opts LinkerOptions, cmdArgs []string) {
 		} else if v, ok := strings.CutPrefix(arg, "--exclude-dir="); ok {
 			opts.ExcludeDirs = splitComma(v)
 		} else if arg == "--no-symbol-links" {
-			noSymbolLinks = true
+			noSymbolLinks, forceSymbolLinks = true, false
+		} else if arg == "--force-symbol-links" {
+			noSymbolLinks, forceSymbolLinks = false, true
+		} else if v, ok := strings.CutPrefix(arg, "--enable="); ok {
+			opts.DisableMatchers = allMatchers &^ mustParseMatchers("--enable", v)
+		} else if v, ok := strings.CutPrefix(arg, "--disable="); ok {
+			opts.DisableMatchers |= mustParseMatchers("--disable", v)
+		} else if arg == "--link-absolute-under-home" {
+			opts.ShortenHome = true
+		} else if arg == "--no-link-cr-lines" {
+			opts.NoLinkCRLines = true
+		} else if arg == "--link-test-names" {
+			opts.LinkTestNames = true
+		} else if arg == "--line-buffered" {
+			opts.LineBuffered = true
+		} else if v, ok := strings.CutPrefix(arg, "--idle-flush="); ok {
+			opts.IdleFlush = parseDuration("--idle-flush", v)
+		} else if v, ok := strings.CutPrefix(arg, "--extract-dir="); ok {
+			opts.ExtractDir = v
+		} else if v, ok := strings.CutPrefix(arg, "--path-root="); ok {
+			pathRoots = append(pathRoots, v)
+		} else if arg == "--detect-terminal" {
+			opts.DetectTerminal = true
+		} else if arg == "--force-links" {
+			forceLinks = true
+		} else if arg == "--probe-terminal" {
+			opts.ProbeTerminal = true
+		} else if arg == "--link-line" {
+			opts.LinkLine = true
+		} else if v, ok := strings.CutPrefix(arg, "--no-watch-dir="); ok {
+			noWatchDirs = append(noWatchDirs, v)
+		} else if v, ok := strings.CutPrefix(arg, "--link-marker-char="); ok {
+			opts.LinkMarker = mustParseLinkMarker("--link-marker-char", v)
+		} else if v, ok := strings.CutPrefix(arg, "--line-separators="); ok {
+			opts.LineSeparators = v
+		} else if v, ok := strings.CutPrefix(arg, "--symbol-trigger="); ok {
+			opts.SymbolTrigger = mustParseStyleTrigger("--symbol-trigger", v)
+		} else if v, ok := strings.CutPrefix(arg, "--index-concurrency="); ok {
+			opts.IndexWorkers = parsePositiveInt("--index-concurrency", v)
+		} else if arg == "--relink-existing" {
+			opts.RelinkExisting = true
+		} else if arg == "--strip-existing-links" {
+			opts.StripLinks = true
+		} else if arg == "--strip-sgr" {
+			opts.StripSGR = true
+		} else if arg == "--join-styled-paths" {
+			opts.JoinStyledPaths = true
+		} else if v, ok := strings.CutPrefix(arg, "--line-timeout="); ok {
+			opts.LineTimeout = parseDuration("--line-timeout", v)
+		} else if v, ok := strings.CutPrefix(arg, "--asset-scheme="); ok {
+			opts.AssetScheme = v
+		} else if v, ok := strings.CutPrefix(arg, "--remote-map="); ok {
+			opts.RemoteMap = mustParseRemoteMap("--remote-map", v)
+		} else if arg == "--link-go-mod" {
+			opts.LinkGoMod = true
+		} else if strings.HasPrefix(arg, "--config=") {
+			// read by configFlag before everything else
+		} else if arg == "--version" {
+			// handled by versionFlag before everything else
+		} else if arg == "--print-config" {
+			printConfig = true
+		} else if arg == "--cat" {
+			opts.Cat = true
+		} else if v, ok := strings.CutPrefix(arg, "--link-head="); ok {
+			opts.LinkHead = parsePositiveInt("--link-head", v)
+		} else if v, ok := strings.CutPrefix(arg, "--max-links-total="); ok {
+			opts.MaxLinksTotal = parsePositiveInt("--max-links-total", v)
+		} else if v, ok := strings.CutPrefix(arg, "--max-line-len="); ok {
+			opts.MaxLineLen = parsePositiveInt("--max-line-len", v)
+		} else if v, ok := strings.CutPrefix(arg, "--link-ext="); ok {
+			opts.LinkExt = splitComma(v)
+		} else if v, ok := strings.CutPrefix(arg, "--no-link-ext="); ok {
+			opts.NoLinkExt = splitComma(v)
+		} else if arg == "--require-location" {
+			opts.RequireLocation = "all"
+		} else if v, ok := strings.CutPrefix(arg, "--require-location="); ok {
+			opts.RequireLocation = mustParseRequireLocation("--require-location", v)
+		} else if arg == "--bat-header" {
+			opts.BatHeader = true
+		} else if arg == "--link-go-pkg-errors" {
+			opts.LinkGoPkgErrors = true
+		} else if arg == "--link-go-race" {
+			opts.LinkGoRace = true
+		} else if arg == "--json-paths" {
+			opts.JSONPaths = true
+		} else if v, ok := strings.CutPrefix(arg, "--resolver-cmd="); ok {
+			opts.ResolverCmd = v
+		} else if v, ok := strings.CutPrefix(arg, "--link-lines="); ok {
+			opts.LinkLines = mustParseLinkLines("--link-lines", v)
+		} else if arg == "--group-links-by-file" {
+			opts.GroupFileLinks = true
+		} else if v, ok := strings.CutPrefix(arg, "--tee="); ok {
+			opts.Tee = v
+		} else if v, ok := strings.CutPrefix(arg, "--manifest="); ok {
+			opts.Manifest = v
+		} else if arg == "--separate-stderr" {
+			opts.SeparateStderr = true
+		} else if arg == "--no-pty" {
+			opts.NoPTY = true
+		} else if v, ok := strings.CutPrefix(arg, "--size="); ok {
+			opts.Size = mustParseSize("--size", v)
 		} else if arg == "--debug-writes" {
 			opts.DebugWrites = true
+		} else if v, ok := strings.CutPrefix(arg, "--debug-writes-file="); ok {
+			opts.DebugWritesFile = v
+		} else if arg == "--debug-watch" {
+			opts.DebugWatch = true
 		} else if arg == "--" {
 			cmdArgs = args[i+1:]
 			break
@@ -124,15 +689,155 @@ func parseArgs(args []string) (opts LinkerOptions, cmdArgs []string) {
 		}
 	}
 
-	scheme := opts.Scheme
-	if scheme == "" {
-		scheme = "file"
+	if editor != "" {
+		preset, err := parseEditor(editor)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --editor: %v\n", err)
+			os.Exit(1)
+		}
+		opts.Scheme = preset.Scheme
+	}
+	opts.SymbolLinks = symbolLinksEnabled(opts.Scheme, forceSymbolLinks) && !noSymbolLinks
+	if forceLinks {
+		opts.DetectTerminal = false
+	}
+	if opts.DetectTerminal {
+		opts.Environ = os.Environ()
+	}
+	if noWatchDirs != nil {
+		opts.NoWatchDirs = noWatchDirs
+	}
+	if pathRoots != nil {
+		opts.PathRoots = pathRoots
+	}
+	for _, r := range opts.LineSeparators {
+		if !unicode.IsPunct(r) && !unicode.IsSymbol(r) || strings.ContainsRune("/.-", r) {
+			fmt.Fprintf(os.Stderr, "invalid line separator %q: must be punctuation other than / . -\n", r)
+			os.Exit(1)
+		}
+	}
+
+	if printConfig {
+		opts.Cwd, _ = os.Getwd()
+		if err := writeConfig(os.Stdout, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "osc8wrap: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
 	}
-	opts.SymbolLinks = scheme != "file" && !noSymbolLinks
 
 	return
 }
 
+func mustParseLinkMarker(name, s string) string {
+	marker, err := parseLinkMarker(s)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid %s: %v\n", name, err)
+		os.Exit(1)
+	}
+	return marker
+}
+
+// configFlag returns the value of the last --config= among the options in
+// args, which end at the command or "--".
+func configFlag(args []string) string {
+	path := ""
+	for _, arg := range args {
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			break
+		}
+		if v, ok := strings.CutPrefix(arg, "--config="); ok {
+			path = v
+		}
+	}
+	return path
+}
+
+// versionFlag reports whether --version is among the osc8wrap flags in
+// args, the ones before the command.
+func versionFlag(args []string) bool {
+	for _, arg := range args {
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			break
+		}
+		if arg == "--version" {
+			return true
+		}
+	}
+	return false
+}
+
+func mustParseRemoteMap(name, s string) string {
+	template, err := parseRemoteMap(s)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid %s: %v\n", name, err)
+		os.Exit(1)
+	}
+	return template
+}
+
+func mustParseRequireLocation(name, s string) string {
+	mode, err := parseRequireLocation(s)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid %s: %v\n", name, err)
+		os.Exit(1)
+	}
+	return mode
+}
+
+func mustParseLinkLines(name, s string) []string {
+	entries := splitComma(s)
+	if _, err := parseLinkLines(entries); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid %s: %v\n", name, err)
+		os.Exit(1)
+	}
+	return entries
+}
+
+func mustParseStyleTrigger(name, s string) uint16 {
+	mask, err := parseStyleTrigger(s)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid %s: %v\n", name, err)
+		os.Exit(1)
+	}
+	return mask
+}
+
+func mustParseSize(name, s string) string {
+	if _, err := parseSize(s); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid %s: %v\n", name, err)
+		os.Exit(1)
+	}
+	return s
+}
+
+func mustParseMatchers(name, s string) uint8 {
+	set, err := parseMatchers(s)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid %s: %v\n", name, err)
+		os.Exit(1)
+	}
+	return set
+}
+
+func parsePositiveInt(name, s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		fmt.Fprintf(os.Stderr, "invalid %s: %s\n", name, s)
+		os.Exit(1)
+	}
+	return n
+}
+
+func parseDuration(name, s string) time.Duration {
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		fmt.Fprintf(os.Stderr, "invalid %s: %s\n", name, s)
+		os.Exit(1)
+	}
+	return d
+}
+
 func splitComma(s string) []string {
 	if s == "" {
 		return nil
@@ -148,55 +853,290 @@ func splitComma(s string) []string {
 }
 
 func runPipeMode(linker *Linker) error {
-	if _, err := io.Copy(linker, os.Stdin); err != nil {
+	_, err := linker.ReadFrom(os.Stdin)
+	return err
+}
+
+// runCatMode writes the files at paths to opts.Output with links, for
+// --cat. Unlike pipe mode it knows where the text comes from: each file is
+// linked with the cwd set to its own directory, so relative references in
+// it resolve the way its author meant them. The basename index of that
+// directory is built before the file is read, since reading is far quicker.
+func runCatMode(opts LinkerOptions, paths []string) error {
+	if opts.Manifest != "" {
+		return errors.New("--manifest cannot be combined with --cat")
+	}
+	if opts.DebugWritesFile != "" {
+		// Each file gets its own Linker, which would truncate the log.
+		return errors.New("--debug-writes-file cannot be combined with --cat")
+	}
+	var tee io.Writer
+	if opts.Tee != "" {
+		f, err := os.Create(opts.Tee)
+		if err != nil {
+			return fmt.Errorf("--tee: %w", err)
+		}
+		defer f.Close() //nolint:errcheck
+		tee = f
+	}
+	for _, path := range paths {
+		if err := catFile(opts, path, tee); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func catFile(opts LinkerOptions, path string, tee io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
 		return err
 	}
-	return linker.Flush()
+	defer f.Close() //nolint:errcheck
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	opts.Cwd = filepath.Dir(abs)
+
+	linker := NewLinker(opts)
+	if tee != nil {
+		linker.SetTee(tee)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go linker.StartIndexer(ctx)
+	if err := linker.WaitForIndex(ctx); err != nil {
+		return err
+	}
+
+	_, err = linker.ReadFrom(f)
+	return err
 }
 
-func runPTYMode(linker *Linker, cmdArgs []string) (int, error) {
+// runPTYMode runs cmdArgs on a pty. typeahead is input read from stdin
+// before the program started; it is passed on ahead of the rest of stdin.
+// The pty gets the size of the terminal on stdin, or size if stdin is not
+// one and size is not nil. If errLinker is not nil, the command's stderr
+// is a pipe that errLinker links instead of the pty (--separate-stderr).
+func runPTYMode(linker, errLinker *Linker, cmdArgs []string, typeahead []byte, size *pty.Winsize) (int, error) {
+	if code, err := lookCommand(cmdArgs[0]); err != nil {
+		return code, err
+	}
 	cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
 
-	ptmx, err := pty.Start(cmd)
+	// pty.Start leaves a stderr that is already set alone.
+	var stderrW *os.File
+	var stderrDone chan struct{}
+	if errLinker != nil {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return 1, fmt.Errorf("failed to create stderr pipe: %w", err)
+		}
+		defer r.Close() //nolint:errcheck
+		cmd.Stderr, stderrW = w, w
+		stderrDone = make(chan struct{})
+		go func() {
+			defer restoreOnPanic()
+			defer close(stderrDone)
+			_, _ = errLinker.ReadFrom(r)
+		}()
+	}
+
+	// Size the pty before the command starts, so it never sees a default
+	// 80x24 that a later resize would have to correct.
+	if ws, err := pty.GetsizeFull(os.Stdin); err == nil {
+		size = ws
+	}
+	ptmx, err := pty.StartWithSize(cmd, size)
+	if stderrW != nil {
+		// Only the command may hold the write end, or the copy never ends.
+		_ = stderrW.Close()
+	}
 	if err != nil {
 		return 1, fmt.Errorf("failed to start pty: %w", err)
 	}
 	defer ptmx.Close() //nolint:errcheck
 
 	handleResize(ptmx)
-	forwardSignals(cmd)
 
 	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
 	if err == nil {
+		rawState.Store(oldState)
 		defer func() {
 			_, _ = os.Stdout.WriteString("\033[0m")
-			_ = term.Restore(int(os.Stdin.Fd()), oldState)
+			if state := rawState.Swap(nil); state != nil {
+				_ = term.Restore(int(os.Stdin.Fd()), state)
+			}
 		}()
 	}
+	forwardSignals(cmd, oldState)
 
-	go func() { _, _ = io.Copy(ptmx, os.Stdin) }()
+	go func() {
+		defer restoreOnPanic()
+		if len(typeahead) > 0 {
+			_, _ = ptmx.Write(typeahead)
+		}
+		_, _ = io.Copy(ptmx, os.Stdin)
+	}()
 
-	if _, err := io.Copy(linker, ptmx); err != nil {
+	// Linux fails reads from the pty master with EIO once the command and
+	// its children have closed their side: the end of the output.
+	if _, err := linker.ReadFrom(ptmx); err != nil && !errors.Is(err, syscall.EIO) {
 		return 1, err
 	}
-
-	if err := linker.Flush(); err != nil {
-		return 1, err
+	if errLinker != nil {
+		<-stderrDone
 	}
 
 	_ = cmd.Wait()
 
 	if cmd.ProcessState != nil {
-		return cmd.ProcessState.ExitCode(), nil
+		return exitStatus(cmd.ProcessState), nil
 	}
 	return 0, nil
 }
 
+// runNoPTYMode runs cmdArgs with --no-pty: the command's stdout and stderr
+// are pipes that linker and errLinker link, as if its output were piped
+// into osc8wrap, and stdin is osc8wrap's own. The command shares
+// osc8wrap's process group, so it gets the terminal's SIGINT and SIGQUIT
+// directly; osc8wrap outlives them to flush what the command wrote last,
+// and passes on SIGTERM and SIGHUP, which may be meant for it alone.
+func runNoPTYMode(linker, errLinker *Linker, cmdArgs []string) (int, error) {
+	if code, err := lookCommand(cmdArgs[0]); err != nil {
+		return code, err
+	}
+	cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = linker
+	cmd.Stderr = errLinker
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGHUP)
+	defer func() {
+		signal.Stop(ch)
+		close(ch)
+	}()
+
+	if err := cmd.Start(); err != nil {
+		return 1, err
+	}
+	go func() {
+		defer restoreOnPanic()
+		for sig := range ch {
+			if sig == syscall.SIGTERM || sig == syscall.SIGHUP {
+				_ = cmd.Process.Signal(sig)
+			}
+		}
+	}()
+
+	// Wait returns once the command has exited and its output is copied
+	// through the Linkers' ReadFrom, which flushes them.
+	err := cmd.Wait()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return 1, err
+	}
+	return exitStatus(cmd.ProcessState), nil
+}
+
+// crlfWriter turns each \n not preceded by \r into \r\n. Output that
+// bypasses the pty, such as --separate-stderr's, needs it while the
+// terminal is in raw mode and no longer does that translation itself.
+type crlfWriter struct {
+	w    io.Writer
+	last byte // last byte of the previous Write
+}
+
+func (c *crlfWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	out := make([]byte, 0, len(p)+bytes.Count(p, []byte("\n")))
+	prev := c.last
+	for _, b := range p {
+		if b == '\n' && prev != '\r' {
+			out = append(out, '\r')
+		}
+		out = append(out, b)
+		prev = b
+	}
+	c.last = prev
+	if _, err := c.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// lookCommand checks that name can be run, looking it up the way
+// exec.Command does. If not, it returns the status a shell exits with and a
+// shell-like message: 127 for a command that does not exist, 126 for one
+// that cannot be executed.
+func lookCommand(name string) (int, error) {
+	_, err := exec.LookPath(name)
+	if err == nil {
+		return 0, nil
+	}
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+		return 127, fmt.Errorf("command not found: %s", name)
+	}
+	var execErr *exec.Error
+	if errors.As(err, &execErr) {
+		err = execErr.Err
+	}
+	return 126, fmt.Errorf("%s: %v", name, err)
+}
+
+// rawState is the terminal mode of stdin from before runPTYMode put it in
+// raw mode, nil while stdin is not in raw mode. Whoever restores it first,
+// runPTYMode on return or restoreTerminal, takes it.
+var rawState atomic.Pointer[term.State]
+
+// restoreTerminal puts the terminal back in order when osc8wrap ends
+// abnormally: stdin leaves raw mode, and modes the command may have left
+// set are reset with termreset. Deferred cleanup does not run when another
+// goroutine panics, so this is called from restoreOnPanic.
+func restoreTerminal() {
+	if state := rawState.Swap(nil); state != nil {
+		_ = term.Restore(int(os.Stdin.Fd()), state)
+	}
+	if term.IsTerminal(int(os.Stdout.Fd())) {
+		_ = termreset.Write(os.Stdout)
+	}
+}
+
+// restoreOnPanic restores the terminal if the goroutine it is deferred in
+// panics, and then lets the panic go on to crash the program as usual.
+func restoreOnPanic() {
+	if r := recover(); r != nil {
+		restoreTerminal()
+		panic(r)
+	}
+}
+
+// exitOnSIGTERM makes pipe mode flush what it holds, write the --manifest
+// and restore the terminal before SIGTERM ends it. PTY mode passes SIGTERM
+// on to the command instead, see forwardSignals, and ends when the command
+// does.
+func exitOnSIGTERM(linker *Linker) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGTERM)
+
+	go func() {
+		<-ch
+		_ = linker.Close()
+		restoreTerminal()
+		os.Exit(128 + int(syscall.SIGTERM))
+	}()
+}
+
 func handleResize(ptmx *os.File) {
 	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, syscall.SIGWINCH)
 
 	go func() {
+		defer restoreOnPanic()
 		for range ch {
 			_ = pty.InheritSize(os.Stdin, ptmx)
 		}
@@ -205,15 +1145,44 @@ func handleResize(ptmx *os.File) {
 	ch <- syscall.SIGWINCH
 }
 
-func forwardSignals(cmd *exec.Cmd) {
+// forwardSignals relays the signals osc8wrap gets to the command, which
+// runs in a session of its own and would not see them otherwise. SIGTSTP
+// suspends both, see suspend. oldState is the terminal mode to restore
+// while suspended, nil if stdin is not a terminal.
+func forwardSignals(cmd *exec.Cmd, oldState *term.State) {
 	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP, syscall.SIGTSTP, syscall.SIGCONT)
 
 	go func() {
+		defer restoreOnPanic()
 		for sig := range ch {
-			if cmd.Process != nil {
-				_ = cmd.Process.Signal(sig)
+			if cmd.Process == nil {
+				continue
 			}
+			if sig == syscall.SIGTSTP {
+				suspend(cmd, oldState)
+				continue
+			}
+			_ = cmd.Process.Signal(sig)
 		}
 	}()
 }
+
+// suspend stops the command and then osc8wrap itself, with the terminal out
+// of raw mode, so the shell regains control. The command gets SIGSTOP: as
+// the leader of a session of its own it is an orphaned process group, for
+// which the kernel discards SIGTSTP. Once osc8wrap is continued (fg), it
+// puts the terminal back in raw mode and continues the command, which the
+// shell's SIGCONT does not reach.
+func suspend(cmd *exec.Cmd, oldState *term.State) {
+	fd := int(os.Stdin.Fd())
+	_ = cmd.Process.Signal(syscall.SIGSTOP)
+	if oldState != nil {
+		_ = term.Restore(fd, oldState)
+	}
+	_ = syscall.Kill(os.Getpid(), syscall.SIGSTOP)
+	if oldState != nil {
+		_, _ = term.MakeRaw(fd)
+	}
+	_ = cmd.Process.Signal(syscall.SIGCONT)
+}
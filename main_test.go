@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/creack/pty"
+	"golang.org/x/term"
+)
+
+func TestLookCommand(t *testing.T) {
+	tmpDir := t.TempDir()
+	script := filepath.Join(tmpDir, "script.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		command  string
+		wantCode int
+		wantErr  string
+	}{
+		{name: "found in PATH", command: "sh", wantCode: 0},
+		{name: "not in PATH", command: "osc8wrap-no-such-command", wantCode: 127, wantErr: "command not found: osc8wrap-no-such-command"},
+		{name: "missing path", command: filepath.Join(tmpDir, "missing"), wantCode: 127, wantErr: "command not found: " + filepath.Join(tmpDir, "missing")},
+		{name: "not executable", command: script, wantCode: 126, wantErr: script + ": permission denied"},
+		{name: "directory", command: tmpDir, wantCode: 126, wantErr: tmpDir + ": is a directory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := lookCommand(tt.command)
+			if code != tt.wantCode {
+				t.Errorf("lookCommand(%q) code = %d, want %d", tt.command, code, tt.wantCode)
+			}
+			gotErr := ""
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if gotErr != tt.wantErr {
+				t.Errorf("lookCommand(%q) error = %q, want %q", tt.command, gotErr, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestForwardSignals(t *testing.T) {
+	tests := []struct {
+		name string
+		sig  syscall.Signal
+		trap string
+		want int
+	}{
+		{name: "SIGHUP", sig: syscall.SIGHUP, trap: "HUP", want: 3},
+		{name: "SIGQUIT", sig: syscall.SIGQUIT, trap: "QUIT", want: 4},
+		{name: "SIGTERM", sig: syscall.SIGTERM, trap: "TERM", want: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer signal.Reset(syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP, syscall.SIGTSTP, syscall.SIGCONT)
+
+			// The command reports the signal through its exit status.
+			cmd := exec.Command("sh", "-c", "trap 'exit "+strconv.Itoa(tt.want)+"' "+tt.trap+"; echo ready; while :; do sleep 0.01; done")
+			stdout, err := cmd.StdoutPipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := stdout.Read(make([]byte, 6)); err != nil {
+				t.Fatal(err)
+			}
+			forwardSignals(cmd, nil)
+
+			if err := syscall.Kill(os.Getpid(), tt.sig); err != nil {
+				t.Fatal(err)
+			}
+			done := make(chan struct{})
+			go func() {
+				_ = cmd.Wait()
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				_ = cmd.Process.Kill()
+				t.Fatalf("%v was not forwarded", tt.sig)
+			}
+			if got := cmd.ProcessState.ExitCode(); got != tt.want {
+				t.Errorf("exit code = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestoreOnPanic(t *testing.T) {
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		t.Skipf("pty.Open: %v", err)
+	}
+	defer ptmx.Close() //nolint:errcheck
+	defer tty.Close()  //nolint:errcheck
+
+	oldStdin := os.Stdin
+	os.Stdin = tty
+	defer func() { os.Stdin = oldStdin }()
+
+	state, err := term.MakeRaw(int(tty.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawState.Store(state)
+
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("recovered %v, want the original panic", r)
+			}
+		}()
+		defer restoreOnPanic()
+		panic("boom")
+	}()
+
+	if rawState.Load() != nil {
+		t.Error("rawState still set after restoreOnPanic")
+	}
+	got, err := term.GetState(int(tty.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, state) {
+		t.Error("terminal still in raw mode after restoreOnPanic")
+	}
+}
+
+func TestRunCatMode(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tmpDir, "docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	setup := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "docs", "setup.md"))
+	notes := filepath.Join(tmpDir, "docs", "notes.md")
+	if err := os.WriteFile(notes, []byte("See ./setup.md:3 first.\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err := runCatMode(LinkerOptions{
+		Output:          &buf,
+		Hostname:        "testhost",
+		Scheme:          "vscode",
+		Domains:         []string{"github.com"},
+		ResolveBasename: true,
+	}, []string{notes})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "See \x1b]8;;vscode://file" + setup + ":3\x1b\\./setup.md:3\x1b]8;;\x1b\\ first.\n"
+	if got := buf.String(); got != want {
+		t.Errorf("runCatMode() wrote %q, want %q", got, want)
+	}
+
+	if err := runCatMode(LinkerOptions{Output: &buf}, []string{filepath.Join(tmpDir, "missing.md")}); err == nil {
+		t.Error("runCatMode() with a missing file: want an error")
+	}
+}
+
+func TestRunPTYModeSeparateStderr(t *testing.T) {
+	defer signal.Reset(syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP, syscall.SIGTSTP, syscall.SIGCONT, syscall.SIGWINCH)
+
+	tmpDir := t.TempDir()
+	testFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "main.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+
+	var out, errOut bytes.Buffer
+	newLinker := func(buf *bytes.Buffer) *Linker {
+		return NewLinker(LinkerOptions{
+			Output:   buf,
+			Cwd:      tmpDir,
+			Hostname: "testhost",
+			Scheme:   "vscode",
+			Domains:  []string{"github.com"},
+		})
+	}
+	linker, errLinker := newLinker(&out), newLinker(&errOut)
+	errLinker.ShareIndex(linker)
+
+	code, err := runPTYMode(linker, errLinker, []string{"sh", "-c", "echo out; echo error in main.go:3 >&2; exit 2"}, nil, nil)
+	if err != nil {
+		t.Skipf("runPTYMode: %v", err)
+	}
+	if code != 2 {
+		t.Errorf("runPTYMode() code = %d, want 2", code)
+	}
+	if got := out.String(); got != "out\r\n" {
+		t.Errorf("stdout = %q, want %q", got, "out\r\n")
+	}
+	want := "error in \x1b]8;;vscode://file" + testFile + ":3\x1b\\main.go:3\x1b]8;;\x1b\\\n"
+	if got := errOut.String(); got != want {
+		t.Errorf("stderr = %q, want %q", got, want)
+	}
+}
+
+func TestRunNoPTYMode(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "main.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+
+	var out, errOut bytes.Buffer
+	newLinker := func(buf *bytes.Buffer) *Linker {
+		return NewLinker(LinkerOptions{
+			Output:   buf,
+			Cwd:      tmpDir,
+			Hostname: "testhost",
+			Scheme:   "vscode",
+			Domains:  []string{"github.com"},
+		})
+	}
+	linker, errLinker := newLinker(&out), newLinker(&errOut)
+	errLinker.ShareIndex(linker)
+
+	script := `if [ -t 1 ]; then echo tty; fi; printf 'see main.go:3'; echo failed >&2; exit 3`
+	code, err := runNoPTYMode(linker, errLinker, []string{"sh", "-c", script})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != 3 {
+		t.Errorf("runNoPTYMode() code = %d, want 3", code)
+	}
+	want := "see \x1b]8;;vscode://file" + testFile + ":3\x1b\\main.go:3\x1b]8;;\x1b\\"
+	if got := out.String(); got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+	if got := errOut.String(); got != "failed\n" {
+		t.Errorf("stderr = %q, want %q", got, "failed\n")
+	}
+
+	if code, err := runNoPTYMode(linker, errLinker, []string{"osc8wrap-no-such-command"}); code != 127 || err == nil {
+		t.Errorf("runNoPTYMode() with a missing command = %d, %v; want 127 and an error", code, err)
+	}
+}
+
+func TestCRLFWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{name: "bare newlines", writes: []string{"a\nb\n"}, want: "a\r\nb\r\n"},
+		{name: "already CRLF", writes: []string{"a\r\nb\r\n"}, want: "a\r\nb\r\n"},
+		{name: "CR ends the previous write", writes: []string{"a\r", "\nb\n"}, want: "a\r\nb\r\n"},
+		{name: "newline starts a write", writes: []string{"a", "\n"}, want: "a\r\n"},
+		{name: "blank lines", writes: []string{"\n\n"}, want: "\r\n\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := &crlfWriter{w: &buf}
+			for _, s := range tt.writes {
+				n, err := w.Write([]byte(s))
+				if err != nil || n != len(s) {
+					t.Fatalf("Write(%q) = %d, %v", s, n, err)
+				}
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("wrote %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestVersionIgnoresConfig checks that --version prints the version even
+// when the config file or the environment would make osc8wrap exit.
+func TestVersionIgnoresConfig(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs osc8wrap with go run")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go not in PATH")
+	}
+	broken := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(broken, []byte("scheme = \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		env  []string
+		args []string
+	}{
+		{name: "broken config file", env: []string{"OSC8WRAP_CONFIG=" + broken}, args: []string{"--version"}},
+		{name: "broken --config", args: []string{"--config=" + broken, "--version"}},
+		{name: "bad environment value", env: []string{"OSC8WRAP_ENABLE=nonsense"}, args: []string{"--version"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(goTool, append([]string{"run", "."}, tt.args...)...)
+			cmd.Env = append(os.Environ(), tt.env...)
+			var stderr bytes.Buffer
+			cmd.Stderr = &stderr
+			out, err := cmd.Output()
+			if err != nil {
+				t.Fatalf("osc8wrap --version: %v\n%s", err, stderr.String())
+			}
+			if !bytes.HasPrefix(out, []byte("osc8wrap ")) {
+				t.Errorf("got %q, want the version", out)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// manifestLink is one entry of the --manifest file.
+type manifestLink struct {
+	Target  string `json:"target"`
+	Display string `json:"display"`
+	Kind    string `json:"kind"`   // "file", "url" or "symbol"
+	Offset  int64  `json:"offset"` // of the link's opening OSC 8 sequence in the output
+}
+
+// linkManifest collects the links a Linker writes, for --manifest. Links
+// are noted as they are made and given their offset once the output that
+// holds them is written, see wrote.
+type linkManifest struct {
+	w       io.Writer
+	pending []manifestLink // made since the last write to the output
+	links   []manifestLink
+	offset  int64 // bytes written to the output so far
+}
+
+// linkKind tells file links from web links by their URL. File links use
+// file:// or an editor's scheme; everything else osc8wrap links is https.
+func linkKind(url string) string {
+	if strings.HasPrefix(url, "https://") || strings.HasPrefix(url, "http://") {
+		return "url"
+	}
+	return "file"
+}
+
+func (m *linkManifest) add(kind, target string, display []byte) {
+	m.pending = append(m.pending, manifestLink{Target: target, Display: string(display), Kind: kind})
+}
+
+// wrote records that b was written to the output. Each pending link is
+// looked for in b after the one before it; a link that is not there was
+// made and then thrown away, as when a retry with other settings won, and
+// is dropped.
+func (m *linkManifest) wrote(b []byte) {
+	pos := 0
+	for _, link := range m.pending {
+		i := bytes.Index(b[pos:], []byte(";"+link.Target))
+		if i < 0 {
+			continue
+		}
+		i += pos
+		link.Offset = m.offset + int64(bytes.LastIndex(b[:i], []byte("\x1b]8;")))
+		m.links = append(m.links, link)
+		pos = i + 1 + len(link.Target)
+	}
+	m.pending = m.pending[:0]
+	m.offset += int64(len(b))
+}
+
+// write writes the manifest as a JSON object whose "links" lists the links
+// in output order.
+func (m *linkManifest) write() error {
+	links := m.links
+	if links == nil {
+		links = []manifestLink{}
+	}
+	enc := json.NewEncoder(m.w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Links []manifestLink `json:"links"`
+	}{links})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLinker_Manifest(t *testing.T) {
+	tmpDir := t.TempDir()
+	mainGo := writeTestFileAndResolvePath(t, filepath.Join(tmpDir, "main.go"))
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+
+	var out, manifest bytes.Buffer
+	linker := NewLinker(LinkerOptions{
+		Output:      &out,
+		Cwd:         tmpDir,
+		Hostname:    "testhost",
+		Scheme:      "vscode",
+		Domains:     []string{"github.com"},
+		SymbolLinks: true,
+	})
+	linker.SetManifest(&manifest)
+
+	writes := []string{
+		"see main.go:3 and https://example.com/x\n",
+		"call \x1b[1mNewLinker\x1b[0m() next\n",
+	}
+	for _, w := range writes {
+		if _, err := linker.Write([]byte(w)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := linker.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		Links []manifestLink `json:"links"`
+	}
+	if err := json.Unmarshal(manifest.Bytes(), &got); err != nil {
+		t.Fatalf("manifest is not JSON: %v\n%s", err, manifest.String())
+	}
+
+	offset := func(target string) int64 {
+		return int64(strings.Index(out.String(), "\x1b]8;;"+target))
+	}
+	symbolURL := "vscode://maaashjp.symbol-opener?symbol=NewLinker&cwd=" + tmpDir
+	want := []manifestLink{
+		{Target: "vscode://file" + mainGo + ":3", Display: "main.go:3", Kind: "file", Offset: 4},
+		{Target: "https://example.com/x", Display: "https://example.com/x", Kind: "url", Offset: offset("https://example.com/x")},
+		{Target: symbolURL, Display: "NewLinker", Kind: "symbol", Offset: offset(symbolURL)},
+	}
+	if diff := cmp.Diff(want, got.Links); diff != "" {
+		t.Errorf("manifest links mismatch (-want +got):\n%s", diff)
+	}
+	if strings.Contains(manifest.String(), `\u0026`) {
+		t.Errorf("manifest escapes & in URLs:\n%s", manifest.String())
+	}
+}
+
+func TestLinker_ManifestEmpty(t *testing.T) {
+	var out, manifest bytes.Buffer
+	linker := NewLinker(LinkerOptions{Output: &out, Cwd: t.TempDir()})
+	linker.SetManifest(&manifest)
+	if _, err := linker.Write([]byte("nothing to link\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := linker.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := manifest.String(), "{\n  \"links\": []\n}\n"; got != want {
+		t.Errorf("manifest = %q, want %q", got, want)
+	}
+}
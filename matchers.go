@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Matcher categories that --enable and --disable switch on and off. They
+// cover the matchers that run by default; opt-in ones such as
+// --link-go-mod keep their own flags.
+const (
+	matchFile   uint8 = 1 << iota // file paths
+	matchURL                      // https:// URLs
+	matchDomain                   // bare domains from Domains, e.g. github.com/...
+	matchSymbol                   // identifiers in styled text (SymbolLinks)
+	matchHunk                     // diff hunk headers
+)
+
+const allMatchers = matchFile | matchURL | matchDomain | matchSymbol | matchHunk
+
+// matcherNames maps --enable/--disable names to matcher bits.
+var matcherNames = map[string]uint8{
+	"file":   matchFile,
+	"url":    matchURL,
+	"domain": matchDomain,
+	"symbol": matchSymbol,
+	"hunk":   matchHunk,
+}
+
+// parseMatchers parses a comma-separated list of matcherNames into a set
+// of matcher bits.
+func parseMatchers(s string) (uint8, error) {
+	var set uint8
+	for name := range strings.SplitSeq(s, ",") {
+		name = strings.TrimSpace(name)
+		bits, ok := matcherNames[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown matcher %q (want %s)", name, formatMatchers(allMatchers))
+		}
+		set |= bits
+	}
+	return set, nil
+}
+
+// formatMatchers is the inverse of parseMatchers, for display. An empty set
+// is "none".
+func formatMatchers(set uint8) string {
+	if set == 0 {
+		return "none"
+	}
+	var names []string
+	for name, bits := range matcherNames {
+		if set&bits != 0 {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return strings.Join(names, ",")
+}
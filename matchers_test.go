@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestParseMatchers(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    uint8
+		wantErr bool
+	}{
+		{input: "file", want: matchFile},
+		{input: "file,url", want: matchFile | matchURL},
+		{input: "domain, symbol", want: matchDomain | matchSymbol},
+		{input: "file,url,domain,symbol,hunk", want: allMatchers},
+		{input: "", wantErr: true},
+		{input: "file,email", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseMatchers(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseMatchers(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseMatchers(%q) = %#x, want %#x", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestFormatMatchers(t *testing.T) {
+	tests := []struct {
+		set  uint8
+		want string
+	}{
+		{set: 0, want: "none"},
+		{set: matchURL | matchFile, want: "file,url"},
+		{set: allMatchers, want: "domain,file,hunk,symbol,url"},
+	}
+
+	for _, tt := range tests {
+		if got := formatMatchers(tt.set); got != tt.want {
+			t.Errorf("formatMatchers(%#x) = %q, want %q", tt.set, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// probeQuery asks the terminal for its name and version (XTVERSION) and
+// then for its primary device attributes (DA1). Nearly every terminal
+// answers DA1, and answers in order, so the DA1 reply marks the end of the
+// response whether or not XTVERSION was understood.
+const probeQuery = "\x1b[>0q\x1b[c"
+
+// probeTimeout bounds how long --probe-terminal waits for the terminal's
+// reply before falling back to the environment guess.
+const probeTimeout = 200 * time.Millisecond
+
+var (
+	xtversionReply = regexp.MustCompile(`\x1bP>\|([^\x1b\x07]*)(?:\x1b\\|\x07)`)
+	da1Reply       = regexp.MustCompile(`\x1b\[\?[0-9;]*c`)
+)
+
+// Prefixes of XTVERSION names of terminals that render OSC 8 hyperlinks.
+var osc8XTVersions = []string{
+	"kitty",
+	"WezTerm",
+	"ghostty",
+	"foot",
+	"contour",
+	"iTerm2",
+	"mintty",
+	"WindowsTerminal",
+}
+
+// probeTerminal asks the terminal on in and out which program it is, for
+// --probe-terminal. It reports whether the reply names a terminal known to
+// render OSC 8; false means no reply, an unknown name or a failed probe,
+// and leaves the decision to terminalSupportsOSC8. in is put in raw mode
+// for the duration of the probe only. Anything read from in that is not
+// part of the reply, such as keys typed meanwhile, is returned as
+// typeahead for the wrapped program.
+func probeTerminal(in, out *os.File, timeout time.Duration) (supported bool, typeahead []byte) {
+	fd := int(in.Fd())
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return false, nil
+	}
+	defer term.Restore(fd, oldState) //nolint:errcheck
+
+	if _, err := out.WriteString(probeQuery); err != nil {
+		return false, nil
+	}
+
+	var buf []byte
+	chunk := make([]byte, 256)
+	deadline := time.Now().Add(timeout)
+	for {
+		if name, rest, ok := parseProbeReply(buf); ok {
+			return xtversionSupportsOSC8(name), rest
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return false, buf
+		}
+		// Poll rather than read in a goroutine: a read left blocked after
+		// the timeout would swallow the first keys meant for the program.
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, int(wait/time.Millisecond)+1)
+		if errors.Is(err, unix.EINTR) || err == nil && n == 0 {
+			continue
+		}
+		if err != nil {
+			return false, buf
+		}
+		n, err = in.Read(chunk)
+		if err != nil {
+			return false, buf
+		}
+		buf = append(buf, chunk[:n]...)
+	}
+}
+
+// parseProbeReply looks for the DA1 reply that ends the answer to
+// probeQuery in buf. Once it is there, parseProbeReply returns the
+// XTVERSION name, if the terminal sent one, and buf without either reply.
+func parseProbeReply(buf []byte) (name string, rest []byte, ok bool) {
+	loc := da1Reply.FindIndex(buf)
+	if loc == nil {
+		return "", nil, false
+	}
+	rest = append(append([]byte{}, buf[:loc[0]]...), buf[loc[1]:]...)
+	if m := xtversionReply.FindSubmatchIndex(rest); m != nil {
+		name = string(rest[m[2]:m[3]])
+		rest = append(rest[:m[0]], rest[m[1]:]...)
+	}
+	return name, rest, true
+}
+
+// xtversionSupportsOSC8 reports whether an XTVERSION name such as
+// "kitty(0.35.2)" or "WezTerm 20240203" belongs to a terminal in
+// osc8XTVersions.
+func xtversionSupportsOSC8(name string) bool {
+	for _, prefix := range osc8XTVersions {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/creack/pty"
+)
+
+func TestParseProbeReply(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		wantName string
+		wantRest string
+		wantOK   bool
+	}{
+		{name: "empty", input: "", wantOK: false},
+		{name: "XTVERSION without DA1 yet", input: "\x1bP>|kitty(0.35.2)\x1b\\", wantOK: false},
+		{name: "XTVERSION and DA1", input: "\x1bP>|kitty(0.35.2)\x1b\\\x1b[?62;c", wantName: "kitty(0.35.2)", wantOK: true},
+		{name: "BEL terminated", input: "\x1bP>|WezTerm 20240203\x07\x1b[?65;4;6;18;22c", wantName: "WezTerm 20240203", wantOK: true},
+		{name: "DA1 only", input: "\x1b[?6c", wantOK: true},
+		{name: "typeahead around the reply", input: "ls\x1bP>|foot(1.16.2)\x1b\\\x1b[?62;4;22c\r", wantName: "foot(1.16.2)", wantRest: "ls\r", wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, rest, ok := parseProbeReply([]byte(tt.input))
+			if ok != tt.wantOK || name != tt.wantName || string(rest) != tt.wantRest {
+				t.Errorf("parseProbeReply(%q) = %q, %q, %v; want %q, %q, %v",
+					tt.input, name, rest, ok, tt.wantName, tt.wantRest, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestXTVersionSupportsOSC8(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "kitty(0.35.2)", want: true},
+		{name: "WezTerm 20240203-110809-5046fc22", want: true},
+		{name: "ghostty 1.0.0", want: true},
+		{name: "XTerm(390)", want: false},
+		{name: "tmux 3.4", want: false},
+		{name: "", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := xtversionSupportsOSC8(tt.name); got != tt.want {
+			t.Errorf("xtversionSupportsOSC8(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestProbeTerminal(t *testing.T) {
+	tests := []struct {
+		name          string
+		reply         string
+		wantSupported bool
+		wantTypeahead string
+	}{
+		{name: "known terminal", reply: "\x1bP>|kitty(0.35.2)\x1b\\\x1b[?62;c", wantSupported: true},
+		{name: "unknown terminal", reply: "\x1bP>|XTerm(390)\x1b\\\x1b[?64;1;2;6;9;15;18;21;22c", wantSupported: false},
+		{name: "keys typed during the probe", reply: "q\x1b[?62;c", wantSupported: false, wantTypeahead: "q"},
+		{name: "no reply", reply: "", wantSupported: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ptmx, tty, err := pty.Open()
+			if err != nil {
+				t.Skipf("no pty: %v", err)
+			}
+			defer ptmx.Close() //nolint:errcheck
+			defer tty.Close()  //nolint:errcheck
+
+			// Play the terminal: wait for the query, then answer it.
+			queried := make(chan []byte, 1)
+			go func() {
+				buf := make([]byte, len(probeQuery))
+				_, _ = io.ReadFull(ptmx, buf)
+				queried <- buf
+				if tt.reply != "" {
+					_, _ = ptmx.WriteString(tt.reply)
+				}
+			}()
+
+			supported, typeahead := probeTerminal(tty, tty, 500*time.Millisecond)
+			if supported != tt.wantSupported {
+				t.Errorf("supported = %v, want %v", supported, tt.wantSupported)
+			}
+			if string(typeahead) != tt.wantTypeahead {
+				t.Errorf("typeahead = %q, want %q", typeahead, tt.wantTypeahead)
+			}
+			if q := <-queried; !bytes.Equal(q, []byte(probeQuery)) {
+				t.Errorf("query = %q, want %q", q, probeQuery)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/creack/pty"
+)
+
+// The size programs assume when a pty reports none; used for whichever of
+// $COLUMNS and $LINES is missing.
+const defaultCols, defaultRows = 80, 24
+
+// parseSize parses a --size value, COLSxROWS such as "120x40".
+func parseSize(s string) (*pty.Winsize, error) {
+	cols, rows, ok := strings.Cut(strings.ToLower(s), "x")
+	if !ok {
+		return nil, fmt.Errorf("%q is not COLSxROWS, e.g. 120x40", s)
+	}
+	c, err1 := strconv.ParseUint(cols, 10, 16)
+	r, err2 := strconv.ParseUint(rows, 10, 16)
+	if err1 != nil || err2 != nil || c == 0 || r == 0 {
+		return nil, fmt.Errorf("%q is not COLSxROWS, e.g. 120x40", s)
+	}
+	return &pty.Winsize{Cols: uint16(c), Rows: uint16(r)}, nil
+}
+
+// fallbackSize returns the window size for the pty when stdin is not a
+// terminal to copy it from: size (a --size value) if set, else $COLUMNS and
+// $LINES as getenv reports them, else nil to leave the kernel's default.
+func fallbackSize(size string, getenv func(string) string) *pty.Winsize {
+	if ws, err := parseSize(size); err == nil {
+		return ws
+	}
+	cols, colsErr := strconv.ParseUint(getenv("COLUMNS"), 10, 16)
+	rows, rowsErr := strconv.ParseUint(getenv("LINES"), 10, 16)
+	colsOK, rowsOK := colsErr == nil && cols > 0, rowsErr == nil && rows > 0
+	if !colsOK && !rowsOK {
+		return nil
+	}
+	if !colsOK {
+		cols = defaultCols
+	}
+	if !rowsOK {
+		rows = defaultRows
+	}
+	return &pty.Winsize{Cols: uint16(cols), Rows: uint16(rows)}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/creack/pty"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    pty.Winsize
+		wantErr bool
+	}{
+		{input: "120x40", want: pty.Winsize{Cols: 120, Rows: 40}},
+		{input: "80X24", want: pty.Winsize{Cols: 80, Rows: 24}},
+		{input: "120", wantErr: true},
+		{input: "0x40", wantErr: true},
+		{input: "120x-1", wantErr: true},
+		{input: "70000x40", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSize(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSize(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if err == nil && *got != tt.want {
+			t.Errorf("parseSize(%q) = %+v, want %+v", tt.input, *got, tt.want)
+		}
+	}
+}
+
+func TestFallbackSize(t *testing.T) {
+	tests := []struct {
+		name string
+		size string
+		env  map[string]string
+		want *pty.Winsize
+	}{
+		{name: "flag", size: "120x40", env: map[string]string{"COLUMNS": "100", "LINES": "30"}, want: &pty.Winsize{Cols: 120, Rows: 40}},
+		{name: "COLUMNS and LINES", env: map[string]string{"COLUMNS": "100", "LINES": "30"}, want: &pty.Winsize{Cols: 100, Rows: 30}},
+		{name: "COLUMNS only", env: map[string]string{"COLUMNS": "100"}, want: &pty.Winsize{Cols: 100, Rows: 24}},
+		{name: "LINES only", env: map[string]string{"LINES": "30"}, want: &pty.Winsize{Cols: 80, Rows: 30}},
+		{name: "invalid env", env: map[string]string{"COLUMNS": "wide", "LINES": "0"}, want: nil},
+		{name: "nothing", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fallbackSize(tt.size, func(k string) string { return tt.env[k] })
+			if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+				t.Errorf("fallbackSize() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
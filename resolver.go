@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// resolverTimeout bounds each --resolver-cmd call. A resolver that is slower
+// than this counts as having found nothing, so a hung script cannot stall
+// the output for more than this per unknown path.
+const resolverTimeout = 500 * time.Millisecond
+
+// maxResolverCache caps the cached answers; the cache is dropped when it
+// fills up, which only costs fresh resolver calls.
+const maxResolverCache = 4096
+
+// externalResolver asks a user command where a path that osc8wrap could not
+// resolve lives. The command runs through sh -c in the working directory,
+// gets the path and a newline on stdin, and prints the absolute path on the
+// first line of stdout; no output, a relative path, a non-zero exit status
+// or a timeout all mean "unknown". Answers, including unknowns, are cached
+// per path.
+type externalResolver struct {
+	command string
+	dir     string
+	timeout time.Duration
+	cache   map[string]string
+}
+
+func newExternalResolver(command, dir string) *externalResolver {
+	return &externalResolver{
+		command: command,
+		dir:     dir,
+		timeout: resolverTimeout,
+		cache:   make(map[string]string),
+	}
+}
+
+// Resolve returns the absolute path the command gives for path, or "".
+func (r *externalResolver) Resolve(path string) string {
+	if absPath, ok := r.cache[path]; ok {
+		return absPath
+	}
+	absPath := r.run(path)
+	if len(r.cache) >= maxResolverCache {
+		clear(r.cache)
+	}
+	r.cache[path] = absPath
+	return absPath
+}
+
+func (r *externalResolver) run(path string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", r.command)
+	cmd.Dir = r.dir
+	cmd.Stdin = strings.NewReader(path + "\n")
+	// Children of sh may hold stdout open after sh is killed; stop
+	// waiting for them shortly after the timeout.
+	cmd.WaitDelay = 100 * time.Millisecond
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	line, _, _ := bytes.Cut(out, []byte("\n"))
+	absPath := strings.TrimSpace(string(line))
+	if !filepath.IsAbs(absPath) {
+		return ""
+	}
+	return filepath.Clean(absPath)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExternalResolver(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		path    string
+		want    string
+	}{
+		{name: "absolute answer", command: `read p; echo "/repo/pkg/$p"`, path: "main.go", want: "/repo/pkg/main.go"},
+		{name: "first line only", command: `echo /a/b.go; echo /c/d.go`, path: "b.go", want: "/a/b.go"},
+		{name: "cleaned", command: `echo /a/./x/../b.go`, path: "b.go", want: "/a/b.go"},
+		{name: "no output", command: `true`, path: "b.go", want: ""},
+		{name: "relative answer", command: `echo pkg/b.go`, path: "b.go", want: ""},
+		{name: "failure", command: `echo /a/b.go; exit 1`, path: "b.go", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newExternalResolver(tt.command, t.TempDir())
+			if got := r.Resolve(tt.path); got != tt.want {
+				t.Errorf("Resolve(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExternalResolver_Cache(t *testing.T) {
+	dir := t.TempDir()
+	r := newExternalResolver(`read p; echo "$p" >> calls; echo "/src/$p"`, dir)
+
+	for range 3 {
+		if got := r.Resolve("a.go"); got != "/src/a.go" {
+			t.Fatalf("Resolve(a.go) = %q", got)
+		}
+	}
+	r.Resolve("b.go")
+
+	calls, err := os.ReadFile(filepath.Join(dir, "calls"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Fields(string(calls)); len(got) != 2 {
+		t.Errorf("resolver ran for %v, want once per path", got)
+	}
+}
+
+func TestExternalResolver_Timeout(t *testing.T) {
+	r := newExternalResolver(`sleep 5; echo /a/b.go`, t.TempDir())
+	r.timeout = 50 * time.Millisecond
+
+	start := time.Now()
+	if got := r.Resolve("b.go"); got != "" {
+		t.Errorf("Resolve() = %q, want no answer after the timeout", got)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Resolve() took %v, want it cut off by the timeout", elapsed)
+	}
+}
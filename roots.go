@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// resolutionRoots returns the directories relative paths are resolved
+// against, in priority order. pathRoots (--path-root) replaces the default
+// list of cwd, the git work tree root and the Go module root above cwd;
+// relative entries are taken relative to cwd. Duplicates and roots that
+// could not be found are dropped.
+func resolutionRoots(cwd string, pathRoots []string) []string {
+	roots := []string{cwd}
+	if len(pathRoots) > 0 {
+		roots = roots[:0]
+		for _, root := range pathRoots {
+			if !filepath.IsAbs(root) {
+				root = filepath.Join(cwd, root)
+			}
+			roots = append(roots, filepath.Clean(root))
+		}
+	} else if cwd != "" {
+		roots = append(roots, findUpward(cwd, ".git"), findUpward(cwd, "go.mod"))
+	}
+
+	var unique []string
+	for _, root := range roots {
+		if root != "" && !slices.Contains(unique, root) {
+			unique = append(unique, root)
+		}
+	}
+	if len(unique) == 0 {
+		return []string{cwd}
+	}
+	return unique
+}
+
+// findUpward returns the nearest directory from dir upwards that contains
+// name, or "" if there is none.
+func findUpward(dir, name string) string {
+	for {
+		if _, err := os.Lstat(filepath.Join(dir, name)); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
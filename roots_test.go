@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestResolutionRoots(t *testing.T) {
+	tmpDir := t.TempDir()
+	repo := filepath.Join(tmpDir, "repo")
+	module := filepath.Join(repo, "svc")
+	cwd := filepath.Join(module, "cmd")
+	for _, dir := range []string{filepath.Join(repo, ".git"), cwd} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(module, "go.mod"), []byte("module svc\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		cwd       string
+		pathRoots []string
+		want      []string
+	}{
+		{name: "defaults", cwd: cwd, want: []string{cwd, repo, module}},
+		{name: "outside any repository", cwd: tmpDir, want: []string{tmpDir}},
+		{name: "module root is the cwd", cwd: module, want: []string{module, repo}},
+		{name: "flags replace the defaults", cwd: cwd, pathRoots: []string{"/srv/app", "..", "."}, want: []string{"/srv/app", module, cwd}},
+		{name: "duplicates dropped", cwd: cwd, pathRoots: []string{".", cwd + "/"}, want: []string{cwd}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolutionRoots(tt.cwd, tt.pathRoots); !slices.Equal(got, tt.want) {
+				t.Errorf("resolutionRoots(%q, %q) = %q, want %q", tt.cwd, tt.pathRoots, got, tt.want)
+			}
+		})
+	}
+}
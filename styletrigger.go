@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mash/osc8wrap/ansitoken"
+)
+
+// triggerNames maps --symbol-trigger names to trigger bits.
+var triggerNames = map[string]uint16{
+	"fg":            ansitoken.TriggerFg,
+	"bg":            ansitoken.TriggerBg,
+	"bold":          ansitoken.AttrBold,
+	"faint":         ansitoken.AttrFaint,
+	"italic":        ansitoken.AttrItalic,
+	"underline":     ansitoken.AttrUnderline,
+	"blink":         ansitoken.AttrBlinkSlow | ansitoken.AttrBlinkRapid,
+	"inverse":       ansitoken.AttrInverse,
+	"conceal":       ansitoken.AttrConceal,
+	"strikethrough": ansitoken.AttrStrikethrough,
+}
+
+// parseStyleTrigger parses a comma-separated list of triggerNames into a
+// trigger mask for ansitoken.Tokenizer.SetTrigger.
+func parseStyleTrigger(s string) (uint16, error) {
+	var mask uint16
+	for name := range strings.SplitSeq(s, ",") {
+		name = strings.TrimSpace(name)
+		bits, ok := triggerNames[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown style %q", name)
+		}
+		mask |= bits
+	}
+	return mask, nil
+}
+
+// formatStyleTrigger is the inverse of parseStyleTrigger, for display. A
+// zero mask, meaning any style, is "any".
+func formatStyleTrigger(mask uint16) string {
+	if mask == 0 {
+		return "any"
+	}
+	var names []string
+	for name, bits := range triggerNames {
+		if mask&bits == bits {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return strings.Join(names, ",")
+}
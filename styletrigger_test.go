@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mash/osc8wrap/ansitoken"
+)
+
+func TestParseStyleTrigger(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    uint16
+		wantErr bool
+	}{
+		{input: "fg", want: ansitoken.TriggerFg},
+		{input: "fg,bg", want: ansitoken.TriggerFg | ansitoken.TriggerBg},
+		{input: "fg, bold", want: ansitoken.TriggerFg | ansitoken.AttrBold},
+		{input: "blink", want: ansitoken.AttrBlinkSlow | ansitoken.AttrBlinkRapid},
+		{input: "", wantErr: true},
+		{input: "fg,colour", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseStyleTrigger(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseStyleTrigger(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseStyleTrigger(%q) = %#x, want %#x", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestFormatStyleTrigger(t *testing.T) {
+	tests := []struct {
+		mask uint16
+		want string
+	}{
+		{mask: 0, want: "any"},
+		{mask: ansitoken.TriggerFg, want: "fg"},
+		{mask: ansitoken.TriggerFg | ansitoken.AttrBold | ansitoken.TriggerBg, want: "bg,bold,fg"},
+		{mask: ansitoken.AttrBlinkSlow | ansitoken.AttrBlinkRapid, want: "blink"},
+	}
+
+	for _, tt := range tests {
+		if got := formatStyleTrigger(tt.mask); got != tt.want {
+			t.Errorf("formatStyleTrigger(%#x) = %q, want %q", tt.mask, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Terminals that are known not to render OSC 8 and instead print the escape
+// sequences (or their parameters) as garbage.
+var noOSC8Terms = map[string]bool{
+	"dumb":   true,
+	"linux":  true, // Linux virtual console
+	"cons25": true,
+}
+
+var noOSC8TermPrograms = map[string]bool{
+	"Apple_Terminal": true,
+}
+
+var osc8TermPrograms = map[string]bool{
+	"iTerm.app":    true,
+	"WezTerm":      true,
+	"vscode":       true,
+	"Hyper":        true,
+	"ghostty":      true,
+	"Tabby":        true,
+	"rio":          true,
+	"WarpTerminal": true,
+}
+
+var osc8Terms = map[string]bool{
+	"xterm-kitty":   true,
+	"xterm-ghostty": true,
+	"wezterm":       true,
+	"alacritty":     true,
+	"foot":          true,
+	"foot-extra":    true,
+	"contour":       true,
+}
+
+// Environment variables whose mere presence identifies an OSC 8 capable
+// terminal.
+var osc8EnvHints = []string{
+	"KITTY_WINDOW_ID",
+	"WEZTERM_EXECUTABLE",
+	"GHOSTTY_RESOURCES_DIR",
+	"WT_SESSION", // Windows Terminal
+	"ALACRITTY_WINDOW_ID",
+}
+
+// terminalSupportsOSC8 guesses from environment variables (in os.Environ
+// form) whether the terminal renders OSC 8 hyperlinks. Known-good hints win;
+// otherwise only terminals known to mangle OSC 8 are rejected. Unknown
+// terminals are assumed capable, since conforming terminals ignore OSC
+// sequences they don't understand.
+func terminalSupportsOSC8(environ []string) bool {
+	env := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+
+	for _, k := range osc8EnvHints {
+		if _, ok := env[k]; ok {
+			return true
+		}
+	}
+	if osc8TermPrograms[env["TERM_PROGRAM"]] || osc8Terms[env["TERM"]] {
+		return true
+	}
+	// VTE (GNOME Terminal, Tilix, ...) supports OSC 8 since 0.50.
+	if v, err := strconv.Atoi(env["VTE_VERSION"]); err == nil {
+		return v >= 5000
+	}
+	// Konsole supports OSC 8 since 20.04 (KONSOLE_VERSION=200400).
+	if v, err := strconv.Atoi(env["KONSOLE_VERSION"]); err == nil {
+		return v >= 200400
+	}
+
+	if noOSC8TermPrograms[env["TERM_PROGRAM"]] {
+		return false
+	}
+	return !noOSC8Terms[env["TERM"]]
+}
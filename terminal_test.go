@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTerminalSupportsOSC8(t *testing.T) {
+	tests := []struct {
+		name    string
+		environ []string
+		want    bool
+	}{
+		{name: "dumb terminal", environ: []string{"TERM=dumb"}, want: false},
+		{name: "linux console", environ: []string{"TERM=linux"}, want: false},
+		{name: "Apple Terminal", environ: []string{"TERM=xterm-256color", "TERM_PROGRAM=Apple_Terminal"}, want: false},
+		{name: "iTerm2", environ: []string{"TERM=xterm-256color", "TERM_PROGRAM=iTerm.app"}, want: true},
+		{name: "kitty by TERM", environ: []string{"TERM=xterm-kitty"}, want: true},
+		{name: "kitty by env hint", environ: []string{"TERM=xterm-256color", "KITTY_WINDOW_ID=1"}, want: true},
+		{name: "Windows Terminal", environ: []string{"WT_SESSION=abc"}, want: true},
+		{name: "recent VTE", environ: []string{"TERM=xterm-256color", "VTE_VERSION=7600"}, want: true},
+		{name: "old VTE", environ: []string{"TERM=xterm-256color", "VTE_VERSION=4205"}, want: false},
+		{name: "old Konsole", environ: []string{"TERM=xterm-256color", "KONSOLE_VERSION=190800"}, want: false},
+		{name: "recent Konsole", environ: []string{"TERM=xterm-256color", "KONSOLE_VERSION=230800"}, want: true},
+		{name: "env hint beats dumb TERM", environ: []string{"TERM=dumb", "WEZTERM_EXECUTABLE=/usr/bin/wezterm"}, want: true},
+		{name: "unknown terminal assumed capable", environ: []string{"TERM=xterm-256color"}, want: true},
+		{name: "empty environment assumed capable", environ: nil, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := terminalSupportsOSC8(tt.environ); got != tt.want {
+				t.Errorf("terminalSupportsOSC8(%q) = %v, want %v", tt.environ, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinker_DetectTerminal(t *testing.T) {
+	tmpDir := t.TempDir()
+	input := "see https://example.com\n"
+	linked := "see \x1b]8;;https://example.com\x1b\\https://example.com\x1b]8;;\x1b\\\n"
+
+	tests := []struct {
+		name     string
+		detect   bool
+		environ  []string
+		expected string
+	}{
+		{name: "unsupported terminal passes through", detect: true, environ: []string{"TERM=dumb"}, expected: input},
+		{name: "supported terminal links", detect: true, environ: []string{"TERM=xterm-kitty"}, expected: linked},
+		{name: "detection off always links", detect: false, environ: []string{"TERM=dumb"}, expected: linked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			linker := NewLinker(LinkerOptions{
+				Output:         &buf,
+				Cwd:            tmpDir,
+				Hostname:       "testhost",
+				Scheme:         "file",
+				Domains:        []string{"github.com"},
+				DetectTerminal: tt.detect,
+				Environ:        tt.environ,
+			})
+
+			assertWrite(t, linker, input, tt.expected)
+		})
+	}
+}
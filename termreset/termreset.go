@@ -0,0 +1,20 @@
+package termreset
+
+import "io"
+
+// Sequence undoes the terminal modes that full-screen and interactive
+// programs commonly set, for when they stop without undoing them. Each part
+// is harmless on a terminal that is already in its default state.
+const Sequence = "\x1b[<u" + // pop keyboard mode (Kitty protocol)
+	"\x1b[?1004l" + // disable focus reporting
+	"\x1b[?2004l" + // disable bracketed paste
+	"\x1b[?2026l" + // disable synchronized output
+	"\x1b[r" + // reset scroll region
+	"\x1b[0m" + // reset SGR attributes
+	"\x1b[?25h" // show cursor
+
+// Write writes Sequence to w.
+func Write(w io.Writer) error {
+	_, err := io.WriteString(w, Sequence)
+	return err
+}
@@ -0,0 +1,23 @@
+package termreset
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	if got != Sequence {
+		t.Errorf("Write() wrote %q, want %q", got, Sequence)
+	}
+	// Attributes are reset after the scroll region, whose reset must not
+	// be undone, and the cursor is shown last.
+	if !strings.HasSuffix(got, "\x1b[r\x1b[0m\x1b[?25h") {
+		t.Errorf("Write() = %q, want it to end by resetting the scroll region, attributes and cursor", got)
+	}
+}